@@ -0,0 +1,9 @@
+package constants
+
+// archive modes of tasks beyond retention, which are deleted without being
+// archived if the mode is empty
+const (
+	TaskArchiveModeNone       = ""
+	TaskArchiveModeCollection = "collection"
+	TaskArchiveModeFile       = "file"
+)
@@ -3,4 +3,7 @@ package constants
 const (
 	DependencyTypePython = "python"
 	DependencyTypeNode   = "node"
+	DependencyTypeGo     = "go"
+	DependencyTypeSystem = "system"
+	DependencyTypeMaven  = "maven"
 )
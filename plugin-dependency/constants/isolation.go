@@ -0,0 +1,15 @@
+package constants
+
+const (
+	IsolationModeGlobal = "global"
+	IsolationModeSpider = "spider"
+)
+
+const EnvsDirName = ".envs"
+
+const DefaultPythonCmd = "python3"
+
+const (
+	DefaultPoetryCmd = "poetry"
+	DefaultPipenvCmd = "pipenv"
+)
@@ -0,0 +1,6 @@
+package constants
+
+const (
+	LogStreamStdout = "stdout"
+	LogStreamStderr = "stderr"
+)
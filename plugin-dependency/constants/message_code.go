@@ -15,6 +15,31 @@ const (
 )
 
 const (
-	MessageCodeUpdateTask = "update-task"
-	MessageCodeInsertLogs = "insert-logs"
+	MessageCodeGoUpdate    = "update-go"
+	MessageCodeGoSave      = "save-go"
+	MessageCodeGoInstall   = "install-go"
+	MessageCodeGoUninstall = "uninstall-go"
+)
+
+const (
+	MessageCodeSystemUpdate    = "update-system"
+	MessageCodeSystemSave      = "save-system"
+	MessageCodeSystemInstall   = "install-system"
+	MessageCodeSystemUninstall = "uninstall-system"
+)
+
+const (
+	MessageCodeMavenUpdate    = "update-maven"
+	MessageCodeMavenSave      = "save-maven"
+	MessageCodeMavenInstall   = "install-maven"
+	MessageCodeMavenUninstall = "uninstall-maven"
+)
+
+const (
+	MessageCodeUpdateTask    = "update-task"
+	MessageCodeInsertLogs    = "insert-logs"
+	MessageCodeCancelTask    = "cancel-task"
+	MessageCodeAckTask       = "ack-task"
+	MessageCodeHeartbeatTask = "heartbeat-task"
+	MessageCodeTaskVersions  = "task-versions"
 )
@@ -4,3 +4,6 @@ const DependencySettingsColName = "dependency_settings"
 const DependenciesColName = "dependencies"
 const DependencyTasksColName = "dependency_tasks"
 const DependencyLogsColName = "dependency_logs"
+const DependencySnapshotsColName = "dependency_snapshots"
+const DependencyTaskArchivesColName = "dependency_task_archives"
+const DependencyPolicyAuditsColName = "dependency_policy_audits"
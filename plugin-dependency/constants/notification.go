@@ -0,0 +1,7 @@
+package constants
+
+const DefaultNotificationEndpoint = "http://localhost:39999"
+
+const NotificationEndpointEnvName = "CRAWLAB_PLUGIN_DEPENDENCY_NOTIFICATION_ENDPOINT"
+
+const NotificationEventDrift = "plugin:dependency:drift"
@@ -0,0 +1,20 @@
+package constants
+
+const (
+	RegistryTypePypi       = "pypi"
+	RegistryTypePypiSimple = "pypi-simple"
+	RegistryTypeDevpi      = "devpi"
+	RegistryTypeNexusPypi  = "nexus-pypi"
+	RegistryTypeNpm        = "npm"
+	RegistryTypeGoproxy    = "goproxy"
+	RegistryTypeMaven      = "maven"
+)
+
+const MavenCentralSearchUrl = "https://search.maven.org/solrsearch/select"
+
+const (
+	DefaultRegistryUrlPypi    = "https://pypi.org"
+	DefaultRegistryUrlNpm     = "https://registry.npmjs.org"
+	DefaultRegistryUrlGoproxy = "https://proxy.golang.org"
+	DefaultRegistryUrlMaven   = "https://repo1.maven.org/maven2"
+)
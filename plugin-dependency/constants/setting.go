@@ -0,0 +1,26 @@
+package constants
+
+// DefaultVersionCacheTtl is the default time in seconds for which latest
+// versions fetched from registries are cached.
+const DefaultVersionCacheTtl = 60 * 60
+
+// DefaultInstallTimeout is the default time in seconds after which install
+// and uninstall tasks are killed.
+const DefaultInstallTimeout = 30 * 60
+
+// intervals and timeouts in seconds of task acknowledgements and heartbeats,
+// after which the task is marked as error by the reaper
+const (
+	TaskAckTimeout        = 60
+	TaskHeartbeatInterval = 15
+	TaskHeartbeatTimeout  = 60
+	TaskReaperInterval    = 30
+)
+
+// DefaultTaskRetentionDays is the default number of days for which tasks
+// and their logs are kept before they are archived or deleted.
+const DefaultTaskRetentionDays = 30
+
+// TaskCleanupInterval is the interval in seconds of the cleanup of tasks
+// beyond retention.
+const TaskCleanupInterval = 60 * 60
@@ -2,5 +2,18 @@ package constants
 
 const (
 	DependencyConfigRequirementsTxt = "requirements.txt"
+	DependencyConfigPyprojectToml   = "pyproject.toml"
+	DependencyConfigPoetryLock      = "poetry.lock"
+	DependencyConfigPipfile         = "Pipfile"
+	DependencyConfigPipfileLock     = "Pipfile.lock"
 	DependencyConfigPackageJson     = "package.json"
+	DependencyConfigPackageLockJson = "package-lock.json"
+	DependencyConfigGoMod           = "go.mod"
+	DependencyConfigPomXml          = "pom.xml"
+)
+
+const (
+	// ManifestNoteMarkersEvaluatedOnMaster notes that environment markers of
+	// requirements are evaluated with the python of the master node.
+	ManifestNoteMarkersEvaluatedOnMaster = "markers_evaluated_on_master"
 )
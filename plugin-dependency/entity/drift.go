@@ -0,0 +1,38 @@
+package entity
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// DriftResult is a dependency whose installed versions differ between
+// active nodes, or which is missing on some of them.
+type DriftResult struct {
+	Type           string               `json:"type"`
+	Name           string               `json:"name"`
+	Versions       []DriftVersion       `json:"versions"`
+	MissingNodeIds []primitive.ObjectID `json:"missing_node_ids"`
+}
+
+type DriftVersion struct {
+	Version string               `json:"version"`
+	NodeIds []primitive.ObjectID `json:"node_ids"`
+}
+
+type DriftAlignPayload struct {
+	Type    string               `json:"type"`
+	Name    string               `json:"name"`
+	Version string               `json:"version"`
+	Mode    string               `json:"mode"`
+	NodeIds []primitive.ObjectID `json:"node_ids"`
+}
+
+// DriftAlert is the event data sent to the notification plugin.
+type DriftAlert struct {
+	Type    string        `json:"type"`
+	Total   int           `json:"total"`
+	Summary string        `json:"summary"`
+	Results []DriftResult `json:"results"`
+}
+
+type NotificationEvent struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
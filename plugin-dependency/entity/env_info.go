@@ -0,0 +1,11 @@
+package entity
+
+// EnvInfo describes the environment in which dependencies of a spider are
+// installed, so that the task runner can locate its interpreter.
+type EnvInfo struct {
+	Isolated    bool   `json:"isolated"`
+	Path        string `json:"path,omitempty"`
+	Interpreter string `json:"interpreter,omitempty"`
+	BinPath     string `json:"bin_path,omitempty"`
+	NodePath    string `json:"node_path,omitempty"`
+}
@@ -0,0 +1,20 @@
+package entity
+
+type GoproxyInfo struct {
+	Version string `json:"Version"`
+	Time    string `json:"Time"`
+}
+
+// GoModule is a module listed by "go list -m -json".
+type GoModule struct {
+	Path     string         `json:"Path"`
+	Version  string         `json:"Version"`
+	Main     bool           `json:"Main"`
+	Indirect bool           `json:"Indirect"`
+	Replace  *GoModule      `json:"Replace"`
+	Error    *GoModuleError `json:"Error"`
+}
+
+type GoModuleError struct {
+	Err string `json:"Err"`
+}
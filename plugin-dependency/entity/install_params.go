@@ -3,11 +3,17 @@ package entity
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type InstallParams struct {
-	TaskId    primitive.ObjectID `json:"task_id"`
-	Cmd       string             `json:"cmd"`
-	Names     []string           `json:"names"`
-	Upgrade   bool               `json:"upgrade"`
-	Proxy     string             `json:"proxy"`
-	UseConfig bool               `json:"use_config"`
-	SpiderId  primitive.ObjectID `json:"spider_id"`
+	TaskId     primitive.ObjectID `json:"task_id"`
+	Cmd        string             `json:"cmd"`
+	Names      []string           `json:"names"`
+	Versions   map[string]string  `json:"versions"`
+	Specifiers map[string]string  `json:"specifiers"`
+	Upgrade    bool               `json:"upgrade"`
+	Proxy      string             `json:"proxy"`
+	UseConfig  bool               `json:"use_config"`
+	SpiderId   primitive.ObjectID `json:"spider_id"`
+	Isolated   bool               `json:"isolated"`
+	Config     string             `json:"config"`
+	Timeout    int                `json:"timeout"` // seconds
+	DryRun     bool               `json:"dry_run"`
 }
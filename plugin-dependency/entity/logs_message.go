@@ -1,8 +1,23 @@
 package entity
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
 
 type LogsMessage struct {
 	TaskId primitive.ObjectID `json:"task_id"`
-	Lines  []string           `json:"lines"`
+	Logs   []LogLine          `json:"logs"`
+
+	// plain lines sent by nodes of earlier versions
+	Lines []string `json:"lines,omitempty"`
+}
+
+// LogLine is a line of output of a task with the stream it is written to
+// and its sequence number in the task.
+type LogLine struct {
+	Stream  string    `json:"stream"`
+	Seq     int64     `json:"seq"`
+	Content string    `json:"content"`
+	Ts      time.Time `json:"ts"`
 }
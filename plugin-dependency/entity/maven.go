@@ -0,0 +1,38 @@
+package entity
+
+type MavenMetadata struct {
+	GroupId    string               `xml:"groupId"`
+	ArtifactId string               `xml:"artifactId"`
+	Versioning MavenMetadataVersion `xml:"versioning"`
+}
+
+type MavenMetadataVersion struct {
+	Latest   string   `xml:"latest"`
+	Release  string   `xml:"release"`
+	Versions []string `xml:"versions>version"`
+}
+
+type MavenSearchResult struct {
+	Response MavenSearchResponse `json:"response"`
+}
+
+type MavenSearchResponse struct {
+	NumFound int              `json:"numFound"`
+	Docs     []MavenSearchDoc `json:"docs"`
+}
+
+type MavenSearchDoc struct {
+	GroupId       string `json:"g"`
+	ArtifactId    string `json:"a"`
+	LatestVersion string `json:"latestVersion"`
+}
+
+type MavenPom struct {
+	Dependencies []MavenPomDependency `xml:"dependencies>dependency"`
+}
+
+type MavenPomDependency struct {
+	GroupId    string `xml:"groupId"`
+	ArtifactId string `xml:"artifactId"`
+	Version    string `xml:"version"`
+}
@@ -1,31 +1,47 @@
 package entity
 
-type NpmResponseList struct {
-	Total   int         `json:"total"`
-	Results []NpmResult `json:"results"`
+type NpmListResult struct {
+	Dependencies map[string]NpmListPackage `json:"dependencies"`
 }
 
-type NpmResult struct {
-	Package NpmPackage `json:"package"`
+type NpmListPackage struct {
+	Version string `json:"version"`
 }
 
-type NpmPackage struct {
-	Name    string `json:"name"`
-	Version string `json:"version"`
+type NpmRegistrySearchResult struct {
+	Total   int                       `json:"total"`
+	Objects []NpmRegistrySearchObject `json:"objects"`
 }
 
-type NpmListResult struct {
-	Dependencies map[string]NpmListPackage `json:"dependencies"`
+type NpmRegistrySearchObject struct {
+	Package NpmRegistryPackage `json:"package"`
 }
 
-type NpmListPackage struct {
-	Version string `json:"version"`
+type NpmRegistryPackage struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type NpmRegistryPackument struct {
+	Name     string                 `json:"name"`
+	DistTags map[string]string      `json:"dist-tags"`
+	Versions map[string]interface{} `json:"versions"`
 }
 
-type NpmResponseDetail struct {
-	Collected NpmCollected `json:"collected"`
+type NpmPackageJson struct {
+	Name            string            `json:"name"`
+	Version         string            `json:"version"`
+	Dependencies    map[string]string `json:"dependencies"`
+	DevDependencies map[string]string `json:"devDependencies"`
 }
 
-type NpmCollected struct {
-	Metadata NpmPackage `json:"metadata"`
+type NpmPackageLock struct {
+	LockfileVersion int                              `json:"lockfileVersion"`
+	Dependencies    map[string]NpmPackageLockPackage `json:"dependencies"`
+	Packages        map[string]NpmPackageLockPackage `json:"packages"`
+}
+
+type NpmPackageLockPackage struct {
+	Version string `json:"version"`
 }
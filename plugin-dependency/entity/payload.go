@@ -9,10 +9,24 @@ type InstallPayload struct {
 	NodeIds   []primitive.ObjectID `json:"node_ids"`
 	UseConfig bool                 `json:"use_config"`
 	SpiderId  primitive.ObjectID   `json:"spider_id"`
+	Config    string               `json:"config"`
+	Versions  map[string]string    `json:"versions"`
+	DryRun    bool                 `json:"dry_run"`
+	Packages  []PackageSpec        `json:"packages"`
+}
+
+// PackageSpec is a package to install with either an exact version or a
+// version specifier, e.g. ">=2.0,<3" for python or "^4.17.0" for node.
+type PackageSpec struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	Specifier string `json:"specifier"`
 }
 
 type UninstallPayload struct {
-	Names   []string             `json:"names"`
-	Mode    string               `json:"mode"`
-	NodeIds []primitive.ObjectID `json:"node_ids"`
+	Names    []string             `json:"names"`
+	Mode     string               `json:"mode"`
+	NodeIds  []primitive.ObjectID `json:"node_ids"`
+	SpiderId primitive.ObjectID   `json:"spider_id"`
+	Config   string               `json:"config"`
 }
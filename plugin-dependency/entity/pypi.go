@@ -0,0 +1,68 @@
+package entity
+
+type PypiSimpleIndex struct {
+	Projects []PypiSimpleProject `json:"projects"`
+}
+
+type PypiSimpleProject struct {
+	Name string `json:"name"`
+}
+
+type PypiProjectDetail struct {
+	Info     PypiProjectInfo        `json:"info"`
+	Releases map[string]interface{} `json:"releases"`
+}
+
+type PypiProjectInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Summary string `json:"summary"`
+}
+
+type DevpiProjectDetail struct {
+	Result map[string]interface{} `json:"result"`
+}
+
+// PypiXmlRpcSearchResponse is the response of the XML-RPC "search" method,
+// which is a list of structs with name, version and summary members.
+type PypiXmlRpcSearchResponse struct {
+	Results []PypiXmlRpcStruct `xml:"params>param>value>array>data>value>struct"`
+	Fault   *PypiXmlRpcStruct  `xml:"fault>value>struct"`
+}
+
+type PypiXmlRpcStruct struct {
+	Members []PypiXmlRpcMember `xml:"member"`
+}
+
+type PypiXmlRpcMember struct {
+	Name  string `xml:"name"`
+	Value struct {
+		String string `xml:"string"`
+		Text   string `xml:",chardata"` // untyped values are strings
+	} `xml:"value"`
+}
+
+// NexusSearchResult is a page of components found by the search API of
+// Nexus Repository Manager.
+type NexusSearchResult struct {
+	Items             []NexusComponent `json:"items"`
+	ContinuationToken string           `json:"continuationToken"`
+}
+
+type NexusComponent struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// PipInstallReport is the report of "pip install --dry-run --report".
+type PipInstallReport struct {
+	Install []PipInstallReportItem `json:"install"`
+}
+
+type PipInstallReportItem struct {
+	Requested bool `json:"requested"`
+	Metadata  struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	} `json:"metadata"`
+}
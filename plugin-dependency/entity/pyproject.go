@@ -0,0 +1,49 @@
+package entity
+
+type PyprojectToml struct {
+	Project PyprojectProject `toml:"project"`
+	Tool    PyprojectTool    `toml:"tool"`
+}
+
+type PyprojectProject struct {
+	Name                 string              `toml:"name"`
+	Dependencies         []string            `toml:"dependencies"`
+	OptionalDependencies map[string][]string `toml:"optional-dependencies"`
+}
+
+type PyprojectTool struct {
+	Poetry *PoetryConfig `toml:"poetry"`
+}
+
+type PoetryConfig struct {
+	Dependencies    map[string]interface{} `toml:"dependencies"`
+	DevDependencies map[string]interface{} `toml:"dev-dependencies"`
+	Group           map[string]PoetryGroup `toml:"group"`
+}
+
+type PoetryGroup struct {
+	Dependencies map[string]interface{} `toml:"dependencies"`
+}
+
+type PoetryLock struct {
+	Package []PoetryLockPackage `toml:"package"`
+}
+
+type PoetryLockPackage struct {
+	Name    string `toml:"name"`
+	Version string `toml:"version"`
+}
+
+type Pipfile struct {
+	Packages    map[string]interface{} `toml:"packages"`
+	DevPackages map[string]interface{} `toml:"dev-packages"`
+}
+
+type PipfileLock struct {
+	Default map[string]PipfileLockPackage `json:"default"`
+	Develop map[string]PipfileLockPackage `json:"develop"`
+}
+
+type PipfileLockPackage struct {
+	Version string `json:"version"`
+}
@@ -0,0 +1,39 @@
+package entity
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type SnapshotPayload struct {
+	Type        string             `json:"type"`
+	NodeId      primitive.ObjectID `json:"node_id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+}
+
+type SnapshotApplyPayload struct {
+	Mode    string               `json:"mode"`
+	NodeIds []primitive.ObjectID `json:"node_ids"`
+	Prune   bool                 `json:"prune"`
+
+	// confirmation of pruning system packages, which removes every OS
+	// package that is not in the snapshot
+	ConfirmPrune bool `json:"confirm_prune"`
+}
+
+// SnapshotDiff is the difference between two lists of dependencies, which
+// is the changes needed to converge the source to the target.
+type SnapshotDiff struct {
+	Added   []SnapshotDiffItem `json:"added"`
+	Removed []SnapshotDiffItem `json:"removed"`
+	Changed []SnapshotDiffItem `json:"changed"`
+}
+
+type SnapshotDiffItem struct {
+	Name        string `json:"name"`
+	FromVersion string `json:"from_version,omitempty"`
+	ToVersion   string `json:"to_version,omitempty"`
+}
+
+type SnapshotApplyResult struct {
+	NodeId primitive.ObjectID `json:"node_id"`
+	Diff   SnapshotDiff       `json:"diff"`
+}
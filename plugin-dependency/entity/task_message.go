@@ -6,4 +6,12 @@ type TaskMessage struct {
 	TaskId primitive.ObjectID `json:"task_id"`
 	Status string             `json:"status"`
 	Error  string             `json:"error"`
+	Result *TaskResult        `json:"result,omitempty"`
+
+	// sequence number of the last log line sent before the status
+	LastLogSeq int64 `json:"last_log_seq,omitempty"`
+
+	// versions of dependencies before and after the task
+	BeforeVersions []DependencyVersion `json:"before_versions,omitempty"`
+	AfterVersions  []DependencyVersion `json:"after_versions,omitempty"`
 }
@@ -0,0 +1,20 @@
+package entity
+
+// TaskResult is the result of a dry-run install task, i.e. dependencies
+// that would be installed, upgraded or downgraded on the node.
+type TaskResult struct {
+	Install   []DependencyChange `json:"install" bson:"install"`
+	Upgrade   []DependencyChange `json:"upgrade" bson:"upgrade"`
+	Downgrade []DependencyChange `json:"downgrade" bson:"downgrade"`
+}
+
+type DependencyVersion struct {
+	Name    string `json:"name" bson:"name"`
+	Version string `json:"version" bson:"version"`
+}
+
+type DependencyChange struct {
+	Name        string `json:"name" bson:"name"`
+	FromVersion string `json:"from_version,omitempty" bson:"from_version,omitempty"`
+	ToVersion   string `json:"to_version" bson:"to_version"`
+}
@@ -3,7 +3,10 @@ package entity
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type UninstallParams struct {
-	TaskId primitive.ObjectID `json:"task_id"`
-	Names  []string           `json:"names"`
-	Cmd    string             `json:"cmd"`
+	TaskId   primitive.ObjectID `json:"task_id"`
+	Names    []string           `json:"names"`
+	Cmd      string             `json:"cmd"`
+	SpiderId primitive.ObjectID `json:"spider_id"`
+	Isolated bool               `json:"isolated"`
+	Timeout  int                `json:"timeout"` // seconds
 }
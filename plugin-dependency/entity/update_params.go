@@ -1,5 +1,9 @@
 package entity
 
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
 type UpdateParams struct {
-	Cmd string `json:"cmd"`
+	Cmd      string             `json:"cmd"`
+	SpiderId primitive.ObjectID `json:"spider_id"`
+	Isolated bool               `json:"isolated"`
 }
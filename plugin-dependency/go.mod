@@ -3,16 +3,19 @@ module github.com/crawlab-team/plugin-dependency
 go 1.16
 
 require (
+	github.com/Masterminds/semver/v3 v3.1.1
 	github.com/PuerkitoBio/goquery v1.7.1
-	github.com/blang/semver/v4 v4.0.0
 	github.com/cenkalti/backoff/v4 v4.1.0
 	github.com/crawlab-team/crawlab-core v0.6.0-beta.20211219.1940
 	github.com/crawlab-team/crawlab-db v0.1.3
 	github.com/crawlab-team/crawlab-grpc v0.6.0-beta.20211219.1930
 	github.com/crawlab-team/crawlab-plugin v0.6.0-beta.20211219.2058
 	github.com/crawlab-team/go-trace v0.1.1
+	github.com/gin-contrib/sse v0.1.0
 	github.com/gin-gonic/gin v1.7.4
 	github.com/imroc/req v0.3.0
+	github.com/pelletier/go-toml v1.7.0
+	github.com/robfig/cron/v3 v3.0.1
 	go.mongodb.org/mongo-driver v1.8.0
 	go.uber.org/dig v1.10.0
 )
@@ -8,6 +8,7 @@ import (
 type Dependency struct {
 	Id            primitive.ObjectID      `json:"_id" bson:"_id"`
 	NodeId        primitive.ObjectID      `json:"node_id" bson:"node_id"`
+	SpiderId      primitive.ObjectID      `json:"spider_id,omitempty" bson:"spider_id,omitempty"`
 	Type          string                  `json:"type" bson:"type"`
 	Name          string                  `json:"name" bson:"name"`
 	Version       string                  `json:"version" bson:"version"`
@@ -15,3 +16,10 @@ type Dependency struct {
 	Description   string                  `json:"description" bson:"description"`
 	Result        entity.DependencyResult `json:"result" bson:"-"`
 }
+
+// DependencyList is the list of dependencies installed in an environment
+// of a node, which is either global or isolated for a spider.
+type DependencyList struct {
+	SpiderId     primitive.ObjectID `json:"spider_id"`
+	Dependencies []Dependency       `json:"dependencies"`
+}
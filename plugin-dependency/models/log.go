@@ -8,6 +8,9 @@ import (
 type Log struct {
 	Id       primitive.ObjectID `json:"_id" bson:"_id"`
 	TaskId   primitive.ObjectID `json:"task_id" bson:"task_id"`
+	Stream   string             `json:"stream" bson:"stream"`
+	Seq      int64              `json:"seq" bson:"seq"`
 	Content  string             `json:"content" bson:"content"`
+	Ts       time.Time          `json:"ts" bson:"ts"`
 	UpdateTs time.Time          `json:"update_ts" bson:"update_ts"`
 }
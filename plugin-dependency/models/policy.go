@@ -0,0 +1,36 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Policy restricts dependencies to install with a setting. Name patterns
+// are shell patterns such as "django-*", matched against normalized names.
+type Policy struct {
+	AllowedNames  []string             `json:"allowed_names" bson:"allowed_names"` // all names are allowed if empty
+	BlockedNames  []string             `json:"blocked_names" bson:"blocked_names"`
+	VersionRanges []PolicyVersionRange `json:"version_ranges" bson:"version_ranges"`
+}
+
+// PolicyVersionRange is a version range that dependencies matching the name
+// pattern must satisfy, e.g. "<3" for python or "^4.17.0" for node.
+type PolicyVersionRange struct {
+	Name  string `json:"name" bson:"name"`
+	Range string `json:"range" bson:"range"`
+}
+
+// PolicyAudit is a record of an install request rejected by the policy.
+type PolicyAudit struct {
+	Id         primitive.ObjectID   `json:"_id" bson:"_id"`
+	SettingId  primitive.ObjectID   `json:"setting_id" bson:"setting_id"`
+	Type       string               `json:"type" bson:"type"`
+	DepNames   []string             `json:"dep_names" bson:"dep_names"`
+	Versions   map[string]string    `json:"versions" bson:"versions"`
+	Specifiers map[string]string    `json:"specifiers" bson:"specifiers"`
+	Mode       string               `json:"mode" bson:"mode"`
+	NodeIds    []primitive.ObjectID `json:"node_ids" bson:"node_ids"`
+	SpiderId   primitive.ObjectID   `json:"spider_id" bson:"spider_id"`
+	Reason     string               `json:"reason" bson:"reason"`
+	CreateTs   time.Time            `json:"create_ts" bson:"create_ts"`
+}
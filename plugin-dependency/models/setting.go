@@ -6,12 +6,25 @@ import (
 )
 
 type Setting struct {
-	Id           primitive.ObjectID `json:"_id" bson:"_id"`
-	Key          string             `json:"key" bson:"key"`
-	Name         string             `json:"name" bson:"name"`
-	Description  string             `json:"description" bson:"description"`
-	Enabled      bool               `json:"enabled" bson:"enabled"`
-	Cmd          string             `json:"cmd" bson:"cmd"`
-	Proxy        string             `json:"proxy" bson:"proxy"`
-	LastUpdateTs time.Time          `json:"last_update_ts" bson:"last_update_ts"`
+	Id                primitive.ObjectID `json:"_id" bson:"_id"`
+	Key               string             `json:"key" bson:"key"`
+	Name              string             `json:"name" bson:"name"`
+	Description       string             `json:"description" bson:"description"`
+	Enabled           bool               `json:"enabled" bson:"enabled"`
+	Cmd               string             `json:"cmd" bson:"cmd"`
+	Proxy             string             `json:"proxy" bson:"proxy"`
+	IsolationMode     string             `json:"isolation_mode" bson:"isolation_mode"`
+	RegistryType      string             `json:"registry_type" bson:"registry_type"`
+	RegistryUrl       string             `json:"registry_url" bson:"registry_url"`
+	RegistryUsername  string             `json:"registry_username" bson:"registry_username"`
+	RegistryPassword  string             `json:"registry_password" bson:"registry_password"`
+	InstallTimeout    int                `json:"install_timeout" bson:"install_timeout"` // seconds
+	UpdateCron        string             `json:"update_cron" bson:"update_cron"`
+	VersionCacheTtl   int                `json:"version_cache_ttl" bson:"version_cache_ttl"` // seconds
+	DriftCheckCron    string             `json:"drift_check_cron" bson:"drift_check_cron"`
+	TaskRetentionDays int                `json:"task_retention_days" bson:"task_retention_days"`
+	TaskArchiveMode   string             `json:"task_archive_mode" bson:"task_archive_mode"`
+	TaskArchivePath   string             `json:"task_archive_path" bson:"task_archive_path"`
+	Policy            Policy             `json:"policy" bson:"policy"`
+	LastUpdateTs      time.Time          `json:"last_update_ts" bson:"last_update_ts"`
 }
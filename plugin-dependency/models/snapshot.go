@@ -0,0 +1,24 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Snapshot is a lock document of dependencies installed on a node, which is
+// versioned per dependency type and node.
+type Snapshot struct {
+	Id           primitive.ObjectID   `json:"_id" bson:"_id"`
+	Type         string               `json:"type" bson:"type"`
+	NodeId       primitive.ObjectID   `json:"node_id" bson:"node_id"`
+	Name         string               `json:"name" bson:"name"`
+	Description  string               `json:"description" bson:"description"`
+	Version      int                  `json:"version" bson:"version"`
+	Dependencies []SnapshotDependency `json:"dependencies" bson:"dependencies"`
+	CreateTs     time.Time            `json:"create_ts" bson:"create_ts"`
+}
+
+type SnapshotDependency struct {
+	Name    string `json:"name" bson:"name"`
+	Version string `json:"version" bson:"version"`
+}
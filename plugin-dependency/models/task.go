@@ -1,6 +1,7 @@
 package models
 
 import (
+	"github.com/crawlab-team/plugin-dependency/entity"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
@@ -15,5 +16,22 @@ type Task struct {
 	Action    string             `json:"action" bson:"action"`
 	DepNames  []string           `json:"dep_names" bson:"dep_names"`
 	Upgrade   bool               `json:"upgrade" bson:"upgrade"`
+	DryRun    bool               `json:"dry_run" bson:"dry_run"`
+	Result    *entity.TaskResult `json:"result,omitempty" bson:"result,omitempty"`
+	SpiderId  primitive.ObjectID `json:"spider_id,omitempty" bson:"spider_id,omitempty"`
 	UpdateTs  time.Time          `json:"update_ts" bson:"update_ts"`
+
+	// sequence number of the last log line sent by the node when the task
+	// is finished, up to which log streams wait for lines
+	LastLogSeq int64 `json:"last_log_seq,omitempty" bson:"last_log_seq,omitempty"`
+
+	// acknowledgement and last heartbeat of the node running the task
+	AckTs       time.Time `json:"ack_ts,omitempty" bson:"ack_ts,omitempty"`
+	HeartbeatTs time.Time `json:"heartbeat_ts,omitempty" bson:"heartbeat_ts,omitempty"`
+
+	// versions of dependencies on the node before and after the task, by
+	// which the task can be rolled back
+	BeforeVersions []entity.DependencyVersion `json:"before_versions,omitempty" bson:"before_versions,omitempty"`
+	AfterVersions  []entity.DependencyVersion `json:"after_versions,omitempty" bson:"after_versions,omitempty"`
+	RollbackTs     time.Time                  `json:"rollback_ts,omitempty" bson:"rollback_ts,omitempty"`
 }
@@ -0,0 +1,15 @@
+package models
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// TaskArchive is a task beyond retention archived with its logs, which are
+// stored as gzip-compressed json.
+type TaskArchive struct {
+	Id        primitive.ObjectID `json:"_id" bson:"_id"`
+	Task      Task               `json:"task" bson:"task"`
+	Logs      []byte             `json:"-" bson:"logs"`
+	ArchiveTs time.Time          `json:"archive_ts" bson:"archive_ts"`
+}
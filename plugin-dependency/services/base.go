@@ -3,7 +3,7 @@ package services
 import (
 	"encoding/json"
 	"errors"
-	"github.com/blang/semver/v4"
+	"fmt"
 	constants2 "github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/controllers"
 	"github.com/crawlab-team/crawlab-core/interfaces"
@@ -19,11 +19,24 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	mongo2 "go.mongodb.org/mongo-driver/mongo"
+	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// updateWaitTimeout is the max duration to wait for the dependency list of
+// a node on update, e.g. if the node goes offline.
+const updateWaitTimeout = 5 * time.Minute
+
+type versionCacheItem struct {
+	version string
+	ts      time.Time
+}
+
 type baseService struct {
 	svc        DependencyService
 	parent     *Service
@@ -32,8 +45,26 @@ type baseService struct {
 	s          models.Setting
 	key        string
 	codes      entity.MessageCodes
-	vCache     sync.Map
+	vCache     sync.Map // latest versions keyed by name
 	defaultCmd string
+	updating   int32 // 1 if update is running
+
+	// registry
+	defaultRegistryType string
+	reg                 DependencyRegistry
+	regKey              string
+	regMu               sync.Mutex
+}
+
+// Init registers the api routes of the dependency type. Dependency services
+// with additional routes should override it and call it in turn.
+func (svc *baseService) Init() {
+	svc.api.GET("/"+svc.key, svc.getList)
+	svc.api.POST("/"+svc.key+"/update", svc.update)
+	svc.api.POST("/"+svc.key+"/install", svc.install)
+	svc.api.POST("/"+svc.key+"/uninstall", svc.uninstall)
+	svc.api.GET("/"+svc.key+"/versions", svc.getVersions)
+	svc.api.GET("/"+svc.key+"/:name/versions", svc.getVersions)
 }
 
 func (svc *baseService) Start() {
@@ -68,6 +99,43 @@ func (svc *baseService) update(c *gin.Context) {
 	controllers.HandleSuccess(c)
 }
 
+// getVersions returns released versions of the dependency from the
+// registry, latest first. The name is given either in the route or by the
+// "name" query parameter, e.g. for scoped npm packages.
+func (svc *baseService) getVersions(c *gin.Context) {
+	// name
+	name := c.Param("name")
+	if name == "" {
+		name = c.Query("name")
+	}
+	if name == "" {
+		controllers.HandleErrorBadRequest(c, errors.New("name is required"))
+		return
+	}
+
+	// setting
+	if err := svc._getSetting(); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// registry
+	reg, err := svc._getRegistry()
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// versions
+	versions, err := reg.GetVersions(name)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, versions)
+}
+
 func (svc *baseService) install(c *gin.Context) {
 	// payload
 	var payload entity.InstallPayload
@@ -76,29 +144,57 @@ func (svc *baseService) install(c *gin.Context) {
 		return
 	}
 
+	// spider id from route of spider dependencies
+	if payload.SpiderId.IsZero() {
+		payload.SpiderId, _ = primitive.ObjectIDFromHex(c.Param("id"))
+	}
+
+	// install
+	if _, err := svc._install(payload); err != nil {
+		handleInstallError(c, err)
+		return
+	}
+
+	controllers.HandleSuccess(c)
+}
+
+// _install creates install tasks on the nodes of the payload and sends
+// them to the nodes, returning ids of the tasks.
+func (svc *baseService) _install(payload entity.InstallPayload) (taskIds []primitive.ObjectID, err error) {
 	// setting
 	if err := svc._getSetting(); err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
+		return nil, err
+	}
+
+	// dry run
+	if payload.DryRun {
+		if _, ok := svc.svc.(DependencyDryRunService); !ok {
+			return nil, errors.New(fmt.Sprintf("dry run is not supported for %s", svc.key))
+		}
+	}
+
+	// packages with versions or version specifiers
+	specifiers, err := svc._mergePackages(&payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// policy
+	specifiers, err = svc._checkPolicy(payload, specifiers)
+	if err != nil {
+		return nil, err
 	}
 
 	// nodes
-	query := bson.M{}
-	if payload.Mode == constants.InstallModeAll {
-		query["active"] = true
-	} else {
-		query["node_id"] = bson.M{"$in": payload.NodeIds}
+	query := bson.M{"active": true}
+	if payload.Mode != constants.InstallModeAll {
+		query["_id"] = bson.M{"$in": payload.NodeIds}
 	}
 	nodes, err := svc.parent._getNodes(query)
 	if err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
+		return nil, err
 	}
 
-	// wait group
-	wg := sync.WaitGroup{}
-	wg.Add(len(nodes))
-
 	// iterate nodes
 	for _, n := range nodes {
 		// task
@@ -110,22 +206,31 @@ func (svc *baseService) install(c *gin.Context) {
 			NodeId:    n.Id,
 			DepNames:  payload.Names,
 			Action:    constants.ActionInstall,
+			Upgrade:   payload.Upgrade,
+			DryRun:    payload.DryRun,
+			SpiderId:  payload.SpiderId,
 			UpdateTs:  time.Now(),
 		}
 		if _, err := svc.parent.colT.Insert(t); err != nil {
-			controllers.HandleErrorInternalServerError(c, err)
-			return
+			return nil, err
 		}
+		taskIds = append(taskIds, t.Id)
 
 		// params
 		params := &entity.InstallParams{
-			TaskId:    t.Id,
-			Upgrade:   payload.Upgrade,
-			Names:     payload.Names,
-			Proxy:     svc.s.Proxy,
-			Cmd:       svc._getCmd(),
-			UseConfig: payload.UseConfig,
-			SpiderId:  payload.SpiderId,
+			TaskId:     t.Id,
+			Upgrade:    payload.Upgrade,
+			Names:      payload.Names,
+			Versions:   payload.Versions,
+			Specifiers: specifiers,
+			Proxy:      svc.s.Proxy,
+			Cmd:        svc._getCmd(),
+			UseConfig:  payload.UseConfig,
+			Config:     payload.Config,
+			SpiderId:   payload.SpiderId,
+			Isolated:   svc._isIsolated(payload.SpiderId),
+			Timeout:    svc.s.InstallTimeout,
+			DryRun:     payload.DryRun,
 		}
 
 		// message data
@@ -146,14 +251,13 @@ func (svc *baseService) install(c *gin.Context) {
 		}
 
 		// send message
-		if err := svc.parent.msgStream.Send(msg); err != nil {
-			trace.PrintError(err)
-			wg.Done()
-			return
+		if err := svc.parent._send(msg); err != nil {
+			svc.parent.taskSvc._setTaskError(t.Id, fmt.Sprintf("failed to send task to node: %v", err))
+			return nil, trace.TraceError(err)
 		}
 	}
 
-	controllers.HandleSuccess(c)
+	return taskIds, nil
 }
 
 func (svc *baseService) uninstall(c *gin.Context) {
@@ -164,28 +268,51 @@ func (svc *baseService) uninstall(c *gin.Context) {
 		return
 	}
 
-	// setting
-	if err := svc._getSetting(); err != nil {
+	// spider id from route of spider dependencies
+	if payload.SpiderId.IsZero() {
+		payload.SpiderId, _ = primitive.ObjectIDFromHex(c.Param("id"))
+	}
+
+	// uninstall
+	if _, err := svc._uninstall(payload); err != nil {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
 
+	controllers.HandleSuccess(c)
+}
+
+// _uninstall creates uninstall tasks on the nodes where the dependencies of
+// the payload are installed and sends them to the nodes, returning ids of
+// the tasks.
+func (svc *baseService) _uninstall(payload entity.UninstallPayload) (taskIds []primitive.ObjectID, err error) {
+	// setting
+	if err := svc._getSetting(); err != nil {
+		return nil, err
+	}
+
 	// node model service
 	nodeModelSvc, err := svc.parent.GetModelService().NewBaseServiceDelegate(interfaces.ModelIdNode)
 	if err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
+		return nil, err
+	}
+
+	// environment of dependencies
+	envSpiderId := primitive.NilObjectID
+	if svc._isIsolated(payload.SpiderId) {
+		envSpiderId = payload.SpiderId
 	}
 
 	// dependencies
 	var deps []models.Dependency
-	query := bson.M{
-		"type": svc.key,
-		"name": bson.M{"$in": payload.Names},
+	query := svc._getScopeQuery(envSpiderId)
+	query["type"] = svc.key
+	query["name"] = bson.M{"$in": payload.Names}
+	if payload.Mode != constants.InstallModeAll {
+		query["node_id"] = bson.M{"$in": payload.NodeIds}
 	}
 	if err := svc.parent.colD.Find(query, nil).All(&deps); err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
+		return nil, err
 	}
 
 	// nodeMap
@@ -199,10 +326,10 @@ func (svc *baseService) uninstall(c *gin.Context) {
 		if !ok {
 			doc, err := nodeModelSvc.GetById(d.NodeId)
 			if err != nil {
-				controllers.HandleErrorInternalServerError(c, err)
-				return
+				return nil, err
 			}
 			n, _ = doc.(interfaces.Node)
+			nodeMap[d.NodeId] = n
 		}
 
 		// skip if not active
@@ -229,25 +356,28 @@ func (svc *baseService) uninstall(c *gin.Context) {
 			NodeId:    n.GetId(),
 			DepNames:  depNames,
 			Action:    constants.ActionUninstall,
+			SpiderId:  payload.SpiderId,
 			UpdateTs:  time.Now(),
 		}
 		if _, err := svc.parent.colT.Insert(t); err != nil {
-			controllers.HandleErrorInternalServerError(c, err)
-			return
+			return nil, err
 		}
+		taskIds = append(taskIds, t.Id)
 
 		// params
 		params := &entity.UninstallParams{
-			TaskId: t.Id,
-			Cmd:    svc._getCmd(),
-			Names:  depNames,
+			TaskId:   t.Id,
+			Cmd:      svc._getCmd(),
+			Names:    depNames,
+			SpiderId: payload.SpiderId,
+			Isolated: svc._isIsolated(payload.SpiderId),
+			Timeout:  svc.s.InstallTimeout,
 		}
 
 		// data
 		data, err := json.Marshal(params)
 		if err != nil {
-			controllers.HandleErrorInternalServerError(c, err)
-			return
+			return nil, trace.TraceError(err)
 		}
 
 		// message data
@@ -257,8 +387,7 @@ func (svc *baseService) uninstall(c *gin.Context) {
 		}
 		msgData, err := json.Marshal(msgDataObj)
 		if err != nil {
-			controllers.HandleErrorInternalServerError(c, err)
-			return
+			return nil, trace.TraceError(err)
 		}
 
 		// stream message
@@ -271,11 +400,120 @@ func (svc *baseService) uninstall(c *gin.Context) {
 		}
 
 		// send message
-		if err := svc.parent.msgStream.Send(msg); err != nil {
-			controllers.HandleErrorInternalServerError(c, err)
-			return
+		if err := svc.parent._send(msg); err != nil {
+			svc.parent.taskSvc._setTaskError(t.Id, fmt.Sprintf("failed to send task to node: %v", err))
+			return nil, trace.TraceError(err)
+		}
+	}
+
+	return taskIds, nil
+}
+
+func (svc *baseService) _getRepoList(c *gin.Context) {
+	// query
+	query := c.Query("query")
+	pagination := controllers.MustGetPagination(c)
+
+	// validate
+	if query == "" {
+		controllers.HandleErrorBadRequest(c, errors.New("empty query"))
+		return
+	}
+
+	// setting
+	if err := svc._getSetting(); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// registry
+	reg, err := svc._getRegistry()
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// search
+	deps, total, err := reg.Search(query, pagination.Page, pagination.Size)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	svc._handleRepoListResults(c, deps, total)
+}
+
+// _handleRepoListResults attaches installed versions and nodes to the
+// dependencies found in the repository and sends them as list data.
+func (svc *baseService) _handleRepoListResults(c *gin.Context, deps []models.Dependency, total int) {
+	// empty results
+	if total == 0 {
+		controllers.HandleSuccess(c)
+		return
+	}
+
+	// dependency names
+	var depNames []string
+	for _, d := range deps {
+		depNames = append(depNames, d.Name)
+	}
+
+	// dependencies in db
+	var depsResults []entity.DependencyResult
+	pipelines := mongo2.Pipeline{
+		{{
+			"$match",
+			bson.M{
+				"type": svc.key,
+				"name": bson.M{
+					"$in": depNames,
+				},
+				"spider_id": bson.M{
+					"$exists": false,
+				},
+			},
+		}},
+		{{
+			"$group",
+			bson.M{
+				"_id": "$name",
+				"node_ids": bson.M{
+					"$push": "$node_id",
+				},
+				"versions": bson.M{
+					"$addToSet": "$version",
+				},
+			},
+		}},
+		{{
+			"$project",
+			bson.M{
+				"name":     "$_id",
+				"node_ids": "$node_ids",
+				"versions": "$versions",
+			},
+		}},
+	}
+	if err := svc.parent.colD.Aggregate(pipelines, nil).All(&depsResults); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// dependencies map
+	depsResultsMap := map[string]entity.DependencyResult{}
+	for _, dr := range depsResults {
+		depsResultsMap[dr.Name] = dr
+	}
+
+	// iterate dependencies
+	for i, d := range deps {
+		dr, ok := depsResultsMap[d.Name]
+		if ok {
+			deps[i].Result = dr
 		}
 	}
+
+	controllers.HandleSuccessWithListData(c, deps, total)
 }
 
 func (svc *baseService) _getInstalledList(c *gin.Context) {
@@ -284,7 +522,7 @@ func (svc *baseService) _getInstalledList(c *gin.Context) {
 	pagination := controllers.MustGetPagination(c)
 
 	// query
-	query := bson.M{}
+	query := svc._getScopeQuery(primitive.NilObjectID)
 	query["type"] = svc.key
 	if searchQuery != "" {
 		query["name"] = primitive.Regex{
@@ -343,21 +581,10 @@ func (svc *baseService) _getInstalledList(c *gin.Context) {
 			continue
 		}
 
-		// latest version
-		lv, err := semver.Make(dr.LatestVersion)
-		if err != nil {
-			continue
-		}
-
 		for _, v := range dr.Versions {
-			// current version
-			cv, err := semver.Make(v)
-			if err != nil {
-				continue
-			}
-
 			// compare with the latest version
-			if lv.Compare(cv) > 0 {
+			res, ok := svc._compareVersions(dr.LatestVersion, v)
+			if ok && res > 0 {
 				depsResults[i].Upgradable = true
 				break
 			}
@@ -386,6 +613,12 @@ func (svc *baseService) _getInstalledList(c *gin.Context) {
 }
 
 func (svc *baseService) _update() (err error) {
+	// skip if update is running, e.g. triggered by schedule and manually
+	if !atomic.CompareAndSwapInt32(&svc.updating, 0, 1) {
+		return nil
+	}
+	defer atomic.StoreInt32(&svc.updating, 0)
+
 	// setting
 	if err := svc._getSetting(); err != nil {
 		return err
@@ -404,8 +637,13 @@ func (svc *baseService) _update() (err error) {
 	// iterate nodes
 	for _, n := range nodes {
 		go func(n models2.Node) {
-			// notify channel
-			ch := svc._getDefaultCh()
+			// notify channel of the node, drained of notifications of
+			// dependency lists saved before
+			ch := svc._getCh(n.GetKey())
+			select {
+			case <-ch:
+			default:
+			}
 
 			// params data
 			data, _ := json.Marshal(&entity.UpdateParams{
@@ -428,14 +666,18 @@ func (svc *baseService) _update() (err error) {
 			}
 
 			// send message
-			if err := svc.parent.msgStream.Send(msg); err != nil {
+			if err := svc.parent._send(msg); err != nil {
 				trace.PrintError(err)
 				wg.Done()
 				return
 			}
 
-			// wait
-			<-ch
+			// wait for the dependency list of the node
+			select {
+			case <-ch:
+			case <-time.After(updateWaitTimeout):
+				trace.PrintError(errors.New(fmt.Sprintf("timed out waiting for dependency list of node %s", n.GetKey())))
+			}
 			wg.Done()
 		}(n)
 	}
@@ -443,6 +685,15 @@ func (svc *baseService) _update() (err error) {
 	// wait for all nodes to finish
 	wg.Wait()
 
+	// update timestamp
+	if err := svc.parent.colS.UpdateId(svc.s.Id, bson.M{
+		"$set": bson.M{
+			"last_update_ts": time.Now(),
+		},
+	}); err != nil {
+		trace.PrintError(err)
+	}
+
 	// update latest version
 	go svc._updateDependenciesLatestVersion()
 
@@ -466,8 +717,16 @@ func (svc *baseService) updateDependencyList(msg *grpc.StreamMessage, msgData en
 		return
 	}
 
+	// dependency list
+	depList := models.DependencyList{
+		Dependencies: deps,
+	}
+	if params.Isolated {
+		depList.SpiderId = params.SpiderId
+	}
+
 	// data
-	data, err := json.Marshal(deps)
+	data, err := json.Marshal(depList)
 	if err != nil {
 		trace.PrintError(err)
 		return
@@ -494,23 +753,23 @@ func (svc *baseService) updateDependencyList(msg *grpc.StreamMessage, msgData en
 	}
 
 	// send message
-	if err := svc.parent.msgStream.Send(msg); err != nil {
+	if err := svc.parent._send(msg); err != nil {
 		trace.PrintError(err)
 		return
 	}
 }
 
 func (svc *baseService) _saveDependencyList(msg *grpc.StreamMessage, msgData entity.MessageData) {
-	// notify channel
-	ch := svc._getDefaultCh()
+	// notify update of the node, whether saved or not
+	defer svc._notify(msg.NodeKey)
 
 	// dependencies
-	var deps []models.Dependency
-	if err := json.Unmarshal(msgData.Data, &deps); err != nil {
+	var depList models.DependencyList
+	if err := json.Unmarshal(msgData.Data, &depList); err != nil {
 		trace.PrintError(err)
-		ch <- true
 		return
 	}
+	deps := depList.Dependencies
 
 	// installed dependency names
 	var depNames []string
@@ -522,7 +781,6 @@ func (svc *baseService) _saveDependencyList(msg *grpc.StreamMessage, msgData ent
 	nodeModelSvc, err := svc.parent.GetModelService().NewBaseServiceDelegate(interfaces.ModelIdNode)
 	if err != nil {
 		trace.PrintError(err)
-		ch <- true
 		return
 	}
 
@@ -530,32 +788,29 @@ func (svc *baseService) _saveDependencyList(msg *grpc.StreamMessage, msgData ent
 	doc, err := nodeModelSvc.Get(bson.M{"key": msg.NodeKey}, nil)
 	if err != nil {
 		trace.PrintError(err)
-		ch <- true
 		return
 	}
 	n, ok := doc.(interfaces.Node)
 	if !ok {
 		trace.PrintError(errors.New("invalid type"))
-		ch <- true
 		return
 	}
 
 	// run transaction to update dependencies
 	err = mongo.RunTransaction(func(ctx mongo2.SessionContext) (err error) {
 		// remove non-existing dependencies
-		if err := svc.parent.colD.Delete(bson.M{
-			"type":    svc.key,
-			"node_id": n.GetId(),
-			"name":    bson.M{"$nin": depNames},
-		}); err != nil {
+		queryDelete := svc._getScopeQuery(depList.SpiderId)
+		queryDelete["type"] = svc.key
+		queryDelete["node_id"] = n.GetId()
+		queryDelete["name"] = bson.M{"$nin": depNames}
+		if err := svc.parent.colD.Delete(queryDelete); err != nil {
 			return err
 		}
 
 		// existing dependencies
-		query := bson.M{
-			"type":    svc.key,
-			"node_id": n.GetId(),
-		}
+		query := svc._getScopeQuery(depList.SpiderId)
+		query["type"] = svc.key
+		query["node_id"] = n.GetId()
 		var depsDb []models.Dependency
 		if err := svc.parent.colD.Find(query, nil).All(&depsDb); err != nil {
 			return err
@@ -565,6 +820,21 @@ func (svc *baseService) _saveDependencyList(msg *grpc.StreamMessage, msgData ent
 			depsDbMap[d.Name] = d
 		}
 
+		// update versions of upgraded or downgraded dependencies
+		for _, d := range deps {
+			dDb, ok := depsDbMap[d.Name]
+			if !ok || dDb.Version == d.Version {
+				continue
+			}
+			if err := svc.parent.colD.UpdateId(dDb.Id, bson.M{
+				"$set": bson.M{
+					"version": d.Version,
+				},
+			}); err != nil {
+				return err
+			}
+		}
+
 		// new dependencies
 		var depsNew []interface{}
 		for _, d := range deps {
@@ -572,6 +842,7 @@ func (svc *baseService) _saveDependencyList(msg *grpc.StreamMessage, msgData ent
 				d.Id = primitive.NewObjectID()
 				d.Type = svc.key
 				d.NodeId = n.GetId()
+				d.SpiderId = depList.SpiderId
 				depsNew = append(depsNew, d)
 			}
 		}
@@ -589,12 +860,8 @@ func (svc *baseService) _saveDependencyList(msg *grpc.StreamMessage, msgData ent
 	})
 	if err != nil {
 		trace.PrintError(err)
-		ch <- true
 		return
 	}
-
-	// notify update success
-	ch <- true
 }
 
 func (svc *baseService) installDependency(msg *grpc.StreamMessage, msgData entity.MessageData) {
@@ -606,15 +873,51 @@ func (svc *baseService) installDependency(msg *grpc.StreamMessage, msgData entit
 		return
 	}
 
+	// task context, which is done if cancelled or timed out
+	ctx := svc.parent._newTaskContext(params.TaskId, svc._getTimeout(params.Timeout))
+	defer svc.parent._deleteTaskContext(params.TaskId)
+
+	// acknowledgement and heartbeats
+	go svc.parent._keepTaskAlive(ctx, params.TaskId)
+
+	// dry run
+	if params.DryRun {
+		result, err := svc._dryRunInstall(params)
+		if err != nil {
+			trace.PrintError(err)
+			svc.parent._sendTaskResult(ctx, params.TaskId, err)
+			return
+		}
+		svc.parent._sendTaskMessage(constants.MessageCodeUpdateTask, &entity.TaskMessage{
+			TaskId: params.TaskId,
+			Status: constants2.TaskStatusFinished,
+			Result: result,
+		})
+		return
+	}
+
+	// versions before install
+	updateParams := entity.UpdateParams{
+		Cmd:      params.Cmd,
+		SpiderId: params.SpiderId,
+		Isolated: params.Isolated,
+	}
+	beforeVersions := svc._getDependencyVersions(updateParams)
+
 	// install
-	if err := svc.svc.InstallDependencies(params); err != nil {
+	err := svc.svc.InstallDependencies(params)
+
+	// versions after install
+	svc._sendTaskVersions(params.TaskId, updateParams, beforeVersions)
+
+	if err != nil {
 		trace.PrintError(err)
-		svc.parent._sendTaskStatus(params.TaskId, constants2.TaskStatusError, err)
+		svc.parent._sendTaskResult(ctx, params.TaskId, err)
 		return
 	}
 
 	// success
-	svc.parent._sendTaskStatus(params.TaskId, constants2.TaskStatusFinished, nil)
+	svc.parent._sendTaskResult(ctx, params.TaskId, nil)
 
 	// update dependencies
 	svc.updateDependencyList(msg, msgData)
@@ -629,88 +932,243 @@ func (svc *baseService) uninstallDependency(msg *grpc.StreamMessage, msgData ent
 		return
 	}
 
+	// task context, which is done if cancelled or timed out
+	ctx := svc.parent._newTaskContext(params.TaskId, svc._getTimeout(params.Timeout))
+	defer svc.parent._deleteTaskContext(params.TaskId)
+
+	// acknowledgement and heartbeats
+	go svc.parent._keepTaskAlive(ctx, params.TaskId)
+
+	// versions before uninstall
+	updateParams := entity.UpdateParams{
+		Cmd:      params.Cmd,
+		SpiderId: params.SpiderId,
+		Isolated: params.Isolated,
+	}
+	beforeVersions := svc._getDependencyVersions(updateParams)
+
 	// uninstall
-	if err := svc.svc.UninstallDependencies(params); err != nil {
+	err := svc.svc.UninstallDependencies(params)
+
+	// versions after uninstall
+	svc._sendTaskVersions(params.TaskId, updateParams, beforeVersions)
+
+	if err != nil {
 		trace.PrintError(err)
-		svc.parent._sendTaskStatus(params.TaskId, constants2.TaskStatusError, err)
+		svc.parent._sendTaskResult(ctx, params.TaskId, err)
 		return
 	}
 
 	// success
-	svc.parent._sendTaskStatus(params.TaskId, constants2.TaskStatusFinished, nil)
+	svc.parent._sendTaskResult(ctx, params.TaskId, nil)
 
 	// update dependencies
 	svc.updateDependencyList(msg, msgData)
 }
 
-func (svc *baseService) _updateDependenciesLatestVersion() {
-	// dependencies
-	var deps []models.Dependency
-	query := bson.M{
-		"latest_version": bson.M{
-			"$exists": false,
-		},
-	}
-	if err := svc.parent.colD.Find(query, nil).All(&deps); err != nil {
+// _getDependencyVersions returns versions of installed dependencies sorted
+// by name, which is nil if they cannot be listed.
+func (svc *baseService) _getDependencyVersions(params entity.UpdateParams) (versions []entity.DependencyVersion) {
+	deps, err := svc.svc.GetDependencies(params)
+	if err != nil {
 		trace.PrintError(err)
+		return nil
+	}
+	versions = []entity.DependencyVersion{}
+	for _, d := range deps {
+		versions = append(versions, entity.DependencyVersion{
+			Name:    d.Name,
+			Version: d.Version,
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Name < versions[j].Name
+	})
+	return versions
+}
+
+// _sendTaskVersions sends versions of dependencies before and after the task
+// to the master node, skipped if versions before the task are unknown.
+func (svc *baseService) _sendTaskVersions(taskId primitive.ObjectID, params entity.UpdateParams, beforeVersions []entity.DependencyVersion) {
+	if beforeVersions == nil {
+		return
+	}
+	afterVersions := svc._getDependencyVersions(params)
+	if afterVersions == nil {
 		return
 	}
+	svc.parent._sendTaskMessage(constants.MessageCodeTaskVersions, &entity.TaskMessage{
+		TaskId:         taskId,
+		BeforeVersions: beforeVersions,
+		AfterVersions:  afterVersions,
+	})
+}
 
-	// iterate dependencies
+// _dryRunInstall resolves dependencies to install without installing them,
+// and compares them with installed dependencies.
+func (svc *baseService) _dryRunInstall(params entity.InstallParams) (result *entity.TaskResult, err error) {
+	// dry run service
+	dryRunSvc, ok := svc.svc.(DependencyDryRunService)
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("dry run is not supported for %s", svc.key))
+	}
+
+	// installed dependencies
+	installedDeps, err := svc.svc.GetDependencies(entity.UpdateParams{
+		Cmd:      params.Cmd,
+		SpiderId: params.SpiderId,
+		Isolated: params.Isolated,
+	})
+	if err != nil {
+		return nil, err
+	}
+	installedVersions := map[string]string{}
+	for _, d := range installedDeps {
+		installedVersions[svc._normalizeName(d.Name)] = d.Version
+	}
+
+	// resolved dependencies
+	deps, err := dryRunSvc.DryRunInstallDependencies(params)
+	if err != nil {
+		return nil, err
+	}
+
+	// changes
+	result = &entity.TaskResult{}
 	for _, d := range deps {
-		svc._updateDependencyLatestVersion(d)
+		change := entity.DependencyChange{
+			Name:      d.Name,
+			ToVersion: d.Version,
+		}
+		v, ok := installedVersions[svc._normalizeName(d.Name)]
+		if !ok {
+			result.Install = append(result.Install, change)
+			continue
+		}
+		if v == d.Version {
+			continue
+		}
+		change.FromVersion = v
+		if res, ok := svc._compareVersions(d.Version, v); ok && res < 0 {
+			result.Downgrade = append(result.Downgrade, change)
+		} else {
+			result.Upgrade = append(result.Upgrade, change)
+		}
 	}
-}
 
-func (svc *baseService) _updateDependencyLatestVersion(dep models.Dependency) {
-	// version
-	var v string
+	return result, nil
+}
 
-	// attempt to load from cache
-	r, ok := svc.vCache.Load(dep.Name)
-	if ok {
-		// exists in cache
-		v, _ = r.(string)
-	} else {
-		// version
-		var err error
-		v, err = svc.svc.GetLatestVersion(dep)
-		if err != nil {
+// _updateDependenciesLatestVersion re-checks latest versions of all
+// installed dependencies of the type, so that upgradable flags stay correct
+// when new versions are released.
+func (svc *baseService) _updateDependenciesLatestVersion() {
+	// dependency names
+	var depsResults []entity.DependencyResult
+	pipelines := mongo2.Pipeline{
+		{{"$match", bson.M{"type": svc.key}}},
+		{{"$group", bson.M{"_id": "$name"}}},
+		{{"$project", bson.M{"name": "$_id"}}},
+	}
+	if err := svc.parent.colD.Aggregate(pipelines, nil).All(&depsResults); err != nil {
+		if err.Error() != mongo2.ErrNoDocuments.Error() {
 			trace.PrintError(err)
-			return
 		}
+		return
+	}
+
+	// iterate dependencies
+	for _, dr := range depsResults {
+		svc._updateDependencyLatestVersion(models.Dependency{
+			Type: svc.key,
+			Name: dr.Name,
+		})
+	}
+}
 
-		// store in cache
-		svc.vCache.Store(dep.Name, v)
+// _updateDependencyLatestVersion updates the latest version of records of
+// the dependency on all nodes.
+func (svc *baseService) _updateDependencyLatestVersion(dep models.Dependency) {
+	// version
+	v, err := svc._getLatestVersion(dep)
+	if err != nil {
+		trace.PrintError(err)
+		return
 	}
 
 	// update
+	query := bson.M{
+		"type": svc.key,
+		"name": dep.Name,
+	}
 	update := bson.M{
 		"$set": bson.M{
 			"latest_version": v,
 		},
 	}
-	if err := svc.parent.colD.UpdateId(dep.Id, update); err != nil {
+	if err := svc.parent.colD.Update(query, update); err != nil {
 		trace.PrintError(err)
 		return
 	}
 }
 
-func (svc *baseService) _getDefaultCh() (ch chan bool) {
-	return svc._getCh(svc.parent.currentNode.GetKey())
-}
-
-func (svc *baseService) _getCh(key string) (ch chan bool) {
-	res, ok := svc.chMap.Load(key)
+// _getLatestVersion returns the latest version of the dependency, which is
+// cached for the version cache ttl of the setting.
+func (svc *baseService) _getLatestVersion(dep models.Dependency) (v string, err error) {
+	// attempt to load from cache
+	r, ok := svc.vCache.Load(dep.Name)
 	if ok {
-		ch, ok := res.(chan bool)
-		if ok {
-			return ch
+		item, _ := r.(versionCacheItem)
+		if time.Since(item.ts) < svc._getVersionCacheTtl() {
+			return item.version, nil
 		}
 	}
-	ch = make(chan bool)
-	svc.chMap.Store(key, ch)
-	return ch
+
+	// version
+	v, err = svc.svc.GetLatestVersion(dep)
+	if err != nil {
+		return "", err
+	}
+
+	// store in cache
+	svc.vCache.Store(dep.Name, versionCacheItem{
+		version: v,
+		ts:      time.Now(),
+	})
+
+	return v, nil
+}
+
+// _getTimeout returns the timeout of install and uninstall tasks given in
+// seconds, or the default timeout if not set.
+func (svc *baseService) _getTimeout(timeout int) time.Duration {
+	if timeout <= 0 {
+		return constants.DefaultInstallTimeout * time.Second
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+func (svc *baseService) _getVersionCacheTtl() (ttl time.Duration) {
+	if svc.s.VersionCacheTtl <= 0 {
+		return constants.DefaultVersionCacheTtl * time.Second
+	}
+	return time.Duration(svc.s.VersionCacheTtl) * time.Second
+}
+
+// _getCh returns the notify channel of the node, which buffers one
+// notification so that it is not lost before the update waits for it.
+func (svc *baseService) _getCh(nodeKey string) (ch chan bool) {
+	res, _ := svc.chMap.LoadOrStore(nodeKey, make(chan bool, 1))
+	return res.(chan bool)
+}
+
+// _notify notifies the update waiting for the dependency list of the node,
+// without blocking if there is none, e.g. for lists saved after installs.
+func (svc *baseService) _notify(nodeKey string) {
+	select {
+	case svc._getCh(nodeKey) <- true:
+	default:
+	}
 }
 
 func (svc *baseService) _getSetting() (err error) {
@@ -720,6 +1178,37 @@ func (svc *baseService) _getSetting() (err error) {
 	return nil
 }
 
+// _getRegistry returns the package registry configured in the setting.
+// The client is reused as long as the registry options stay the same, so
+// that cached data such as the simple index survives between requests.
+func (svc *baseService) _getRegistry() (reg DependencyRegistry, err error) {
+	svc.regMu.Lock()
+	defer svc.regMu.Unlock()
+
+	// registry key
+	key := strings.Join([]string{
+		svc.s.RegistryType,
+		svc.s.RegistryUrl,
+		svc.s.RegistryUsername,
+		svc.s.RegistryPassword,
+	}, "|")
+
+	// reuse
+	if svc.reg != nil && svc.regKey == key {
+		return svc.reg, nil
+	}
+
+	// new registry
+	reg, err = newRegistry(svc.s, svc.defaultRegistryType)
+	if err != nil {
+		return nil, err
+	}
+	svc.reg = reg
+	svc.regKey = key
+
+	return reg, nil
+}
+
 func (svc *baseService) _getCmd() (cmd string) {
 	if svc.s.Cmd == "" {
 		return svc.defaultCmd
@@ -742,6 +1231,122 @@ func (svc *baseService) _getInstallWorkspacePath(params entity.InstallParams) (w
 	return fsSvc.GetWorkspacePath(), nil
 }
 
+// _normalizeName normalizes a dependency name for comparison, as python
+// project names are case-insensitive and treat separators as equivalent.
+func (svc *baseService) _normalizeName(name string) string {
+	if svc.key == constants.DependencyTypePython {
+		return normalizePythonName(name)
+	}
+	return name
+}
+
+// _compareVersions compares two versions in the versioning scheme of the
+// dependency type. ok is false if any of the versions is invalid.
+func (svc *baseService) _compareVersions(a, b string) (res int, ok bool) {
+	switch svc.key {
+	case constants.DependencyTypePython:
+		// python versions as per PEP 440
+		return comparePythonVersions(a, b)
+	case constants.DependencyTypeMaven:
+		return compareMavenVersions(a, b), true
+	case constants.DependencyTypeSystem:
+		if isApk(svc._getCmd()) {
+			return compareApkVersions(a, b)
+		}
+		return compareDebianVersions(a, b), true
+	default:
+		// semantic versions, which may be prefixed with "v" as in go modules
+		return compareSemverVersions(a, b)
+	}
+}
+
+// _getDependencyResultsMap returns installed versions and nodes of the
+// given dependencies in the environment used by the spider, or of all
+// dependencies if names are nil, keyed by dependency name.
+func (svc *baseService) _getDependencyResultsMap(spiderId primitive.ObjectID, depNames []string) (depsResultsMap map[string]entity.DependencyResult, err error) {
+	// setting
+	if err := svc._getSetting(); err != nil {
+		return nil, err
+	}
+
+	// scope
+	envSpiderId := primitive.NilObjectID
+	if svc._isIsolated(spiderId) {
+		envSpiderId = spiderId
+	}
+	query := svc._getScopeQuery(envSpiderId)
+	query["type"] = svc.key
+	if depNames != nil {
+		query["name"] = bson.M{
+			"$in": depNames,
+		}
+	}
+
+	var depsResults []entity.DependencyResult
+	pipelines := mongo2.Pipeline{
+		{{"$match", query}},
+		{{
+			"$group",
+			bson.M{
+				"_id": "$name",
+				"node_ids": bson.M{
+					"$push": "$node_id",
+				},
+				"versions": bson.M{
+					"$addToSet": "$version",
+				},
+			},
+		}},
+		{{
+			"$project",
+			bson.M{
+				"name":     "$_id",
+				"node_ids": "$node_ids",
+				"versions": "$versions",
+			},
+		}},
+	}
+	if err := svc.parent.colD.Aggregate(pipelines, nil).All(&depsResults); err != nil {
+		return nil, err
+	}
+
+	// dependencies map
+	depsResultsMap = map[string]entity.DependencyResult{}
+	for _, dr := range depsResults {
+		depsResultsMap[dr.Name] = dr
+	}
+
+	return depsResultsMap, nil
+}
+
+// _isIsolated returns whether dependencies of the given spider are installed
+// in its own environment instead of the global one.
+func (svc *baseService) _isIsolated(spiderId primitive.ObjectID) (res bool) {
+	return !spiderId.IsZero() && svc.s.IsolationMode == constants.IsolationModeSpider
+}
+
+// _getScopeQuery returns the query of dependency records in the environment
+// of the given spider, or in the global environment if spider id is empty.
+func (svc *baseService) _getScopeQuery(spiderId primitive.ObjectID) (query bson.M) {
+	if spiderId.IsZero() {
+		return bson.M{"spider_id": bson.M{"$exists": false}}
+	}
+	return bson.M{"spider_id": spiderId}
+}
+
+// _getEnvPath returns the path of the isolated environment of a spider. It
+// is kept next to the spider workspace rather than inside it, as syncing the
+// workspace removes files that do not exist in the file system.
+func (svc *baseService) _getEnvPath(spiderId primitive.ObjectID) (envPath string, err error) {
+	// spider fs service
+	fsSvc, err := fs.NewSpiderFsService(spiderId)
+	if err != nil {
+		return envPath, err
+	}
+
+	return path.Join(path.Dir(fsSvc.GetWorkspacePath()), constants.EnvsDirName, spiderId.Hex(), svc.key), nil
+}
+
 func newBaseService(svc DependencyService, parent *Service, key string, codes entity.MessageCodes) (res *baseService) {
 	return &baseService{
 		svc:    svc,
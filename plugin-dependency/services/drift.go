@@ -0,0 +1,380 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/controllers"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-gonic/gin"
+	"github.com/imroc/req"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type DriftService struct {
+	parent *Service
+	api    *gin.Engine
+}
+
+func (svc *DriftService) Init() {
+	svc.api.GET("/drift", svc.getList)
+	svc.api.POST("/drift/check", svc.check)
+	svc.api.POST("/drift/align", svc.align)
+}
+
+func (svc *DriftService) getList(c *gin.Context) {
+	// dependency types
+	keys, err := svc._getKeys(c.Query("type"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// drift results
+	var results []entity.DriftResult
+	for _, key := range keys {
+		res, err := svc._getDriftResults(key)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		results = append(results, res...)
+	}
+
+	controllers.HandleSuccessWithListData(c, results, len(results))
+}
+
+// check detects drift and sends an alert to the notification plugin if any
+// drift is found.
+func (svc *DriftService) check(c *gin.Context) {
+	// dependency types
+	keys, err := svc._getKeys(c.Query("type"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// check
+	var results []entity.DriftResult
+	for _, key := range keys {
+		res, err := svc._check(key)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		results = append(results, res...)
+	}
+
+	controllers.HandleSuccessWithListData(c, results, len(results))
+}
+
+// align installs the given version of a dependency on the nodes where it is
+// missing or installed with another version.
+func (svc *DriftService) align(c *gin.Context) {
+	// payload
+	var payload entity.DriftAlignPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+	if payload.Name == "" || payload.Version == "" {
+		controllers.HandleErrorBadRequest(c, errors.New("name and version are required"))
+		return
+	}
+
+	// dependency service
+	depSvc, err := svc.parent._getDependencyService(payload.Type)
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// nodes
+	query := bson.M{"active": true}
+	if payload.Mode != constants.InstallModeAll {
+		query["_id"] = bson.M{"$in": payload.NodeIds}
+	}
+	nodes, err := svc.parent._getNodes(query)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// nodes with the version installed
+	var deps []models.Dependency
+	if err := svc.parent.colD.Find(bson.M{
+		"spider_id": bson.M{"$exists": false},
+		"type":      payload.Type,
+		"name":      payload.Name,
+		"version":   payload.Version,
+	}, nil).All(&deps); err != nil && err.Error() != mongo.ErrNoDocuments.Error() {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+	alignedNodeIds := map[primitive.ObjectID]bool{}
+	for _, d := range deps {
+		alignedNodeIds[d.NodeId] = true
+	}
+
+	// nodes to install
+	var nodeIds []primitive.ObjectID
+	for _, n := range nodes {
+		if !alignedNodeIds[n.Id] {
+			nodeIds = append(nodeIds, n.Id)
+		}
+	}
+	if len(nodeIds) == 0 {
+		controllers.HandleSuccess(c)
+		return
+	}
+
+	// install
+	if _, err := depSvc._install(entity.InstallPayload{
+		Names:    []string{payload.Name},
+		Mode:     constants.InstallModeSelectedNodes,
+		NodeIds:  nodeIds,
+		Versions: map[string]string{payload.Name: payload.Version},
+	}); err != nil {
+		handleInstallError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, nodeIds)
+}
+
+// _check detects drift of the dependency type and sends an alert if any.
+func (svc *DriftService) _check(key string) (results []entity.DriftResult, err error) {
+	results, err = svc._getDriftResults(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	if err := svc._sendAlert(key, results); err != nil {
+		trace.PrintError(err)
+	}
+	return results, nil
+}
+
+// _getDriftResults returns dependencies of the global environments whose
+// versions differ between active nodes, or which are missing on some of
+// them, sorted by name.
+func (svc *DriftService) _getDriftResults(key string) (results []entity.DriftResult, err error) {
+	// dependency service
+	depSvc, err := svc.parent._getDependencyService(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// active nodes
+	nodes, err := svc.parent._getNodes(bson.M{"active": true})
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) < 2 {
+		return nil, nil
+	}
+	var nodeIds []primitive.ObjectID
+	for _, n := range nodes {
+		nodeIds = append(nodeIds, n.Id)
+	}
+
+	// installed versions grouped by name
+	var groups []driftGroup
+	pipelines := mongo.Pipeline{
+		{{
+			"$match",
+			bson.M{
+				"type":      key,
+				"node_id":   bson.M{"$in": nodeIds},
+				"spider_id": bson.M{"$exists": false},
+			},
+		}},
+		{{
+			"$group",
+			bson.M{
+				"_id": "$name",
+				"nodes": bson.M{
+					"$push": bson.M{
+						"node_id": "$node_id",
+						"version": "$version",
+					},
+				},
+			},
+		}},
+		{{"$sort", bson.D{{"_id", 1}}}},
+	}
+	if err := svc.parent.colD.Aggregate(pipelines, nil).All(&groups); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			return nil, nil
+		}
+		return nil, trace.TraceError(err)
+	}
+
+	// iterate groups
+	for _, g := range groups {
+		// nodes by version
+		versionsMap := map[string][]primitive.ObjectID{}
+		installedNodeIds := map[primitive.ObjectID]bool{}
+		for _, n := range g.Nodes {
+			versionsMap[n.Version] = append(versionsMap[n.Version], n.NodeId)
+			installedNodeIds[n.NodeId] = true
+		}
+
+		// nodes without the dependency
+		var missingNodeIds []primitive.ObjectID
+		for _, id := range nodeIds {
+			if !installedNodeIds[id] {
+				missingNodeIds = append(missingNodeIds, id)
+			}
+		}
+
+		// skip if consistent
+		if len(versionsMap) < 2 && len(missingNodeIds) == 0 {
+			continue
+		}
+
+		// versions from the highest
+		r := entity.DriftResult{
+			Type:           key,
+			Name:           g.Name,
+			MissingNodeIds: missingNodeIds,
+		}
+		for v, ids := range versionsMap {
+			r.Versions = append(r.Versions, entity.DriftVersion{
+				Version: v,
+				NodeIds: ids,
+			})
+		}
+		sort.Slice(r.Versions, func(i, j int) bool {
+			res, ok := depSvc._compareVersions(r.Versions[i].Version, r.Versions[j].Version)
+			if !ok {
+				return r.Versions[i].Version > r.Versions[j].Version
+			}
+			return res > 0
+		})
+
+		results = append(results, r)
+	}
+
+	return results, nil
+}
+
+// _sendAlert sends the drift results as an event to the notification
+// plugin, which notifies as per the settings triggered by the event.
+func (svc *DriftService) _sendAlert(key string, results []entity.DriftResult) (err error) {
+	// node names
+	nodes, err := svc.parent._getNodes(bson.M{})
+	if err != nil {
+		return err
+	}
+	nodeNames := map[primitive.ObjectID]string{}
+	for _, n := range nodes {
+		nodeNames[n.Id] = n.Name
+	}
+
+	// event
+	event := entity.NotificationEvent{
+		Event: constants.NotificationEventDrift,
+		Data: entity.DriftAlert{
+			Type:    key,
+			Total:   len(results),
+			Summary: getDriftSummary(results, nodeNames),
+			Results: results,
+		},
+	}
+
+	// endpoint
+	endpoint := os.Getenv(constants.NotificationEndpointEnvName)
+	if endpoint == "" {
+		endpoint = constants.DefaultNotificationEndpoint
+	}
+	requestUrl := strings.TrimSuffix(endpoint, "/") + "/events"
+
+	// request
+	reqSession := req.New()
+	reqSession.SetTimeout(15 * time.Second)
+	res, err := reqSession.Post(requestUrl, req.BodyJSON(event))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if res.Response().StatusCode != http.StatusOK {
+		return trace.TraceError(errors.New(fmt.Sprintf("request %s failed: %s", requestUrl, res.Response().Status)))
+	}
+
+	return nil
+}
+
+// _getKeys returns the given dependency type, or keys of all enabled
+// settings if it is empty.
+func (svc *DriftService) _getKeys(key string) (keys []string, err error) {
+	if key != "" {
+		if _, err := svc.parent._getDependencyService(key); err != nil {
+			return nil, err
+		}
+		return []string{key}, nil
+	}
+	var settings []models.Setting
+	if err := svc.parent.colS.Find(bson.M{"enabled": true}, nil).All(&settings); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			return nil, nil
+		}
+		return nil, trace.TraceError(err)
+	}
+	for _, s := range settings {
+		keys = append(keys, s.Key)
+	}
+	return keys, nil
+}
+
+type driftGroup struct {
+	Name  string `bson:"_id"`
+	Nodes []struct {
+		NodeId  primitive.ObjectID `bson:"node_id"`
+		Version string             `bson:"version"`
+	} `bson:"nodes"`
+}
+
+// getDriftSummary returns a markdown list of drift results for use in
+// notification templates.
+func getDriftSummary(results []entity.DriftResult, nodeNames map[primitive.ObjectID]string) string {
+	getNames := func(ids []primitive.ObjectID) string {
+		var names []string
+		for _, id := range ids {
+			names = append(names, nodeNames[id])
+		}
+		sort.Strings(names)
+		return strings.Join(names, ", ")
+	}
+
+	var lines []string
+	for _, r := range results {
+		var parts []string
+		for _, v := range r.Versions {
+			parts = append(parts, fmt.Sprintf("%s (%s)", v.Version, getNames(v.NodeIds)))
+		}
+		if len(r.MissingNodeIds) > 0 {
+			parts = append(parts, fmt.Sprintf("missing (%s)", getNames(r.MissingNodeIds)))
+		}
+		lines = append(lines, fmt.Sprintf("- **%s**: %s", r.Name, strings.Join(parts, "; ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func NewDriftService(parent *Service) (svc *DriftService) {
+	svc = &DriftService{
+		parent: parent,
+		api:    parent.GetApi(),
+	}
+	return svc
+}
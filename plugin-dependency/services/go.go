@@ -0,0 +1,355 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+type GoService struct {
+	*baseService
+}
+
+func (svc *GoService) GetRepoList(c *gin.Context) {
+	svc._getRepoList(c)
+}
+
+// GetDependencies lists the Go programs installed with "go install" in the
+// GOBIN directory, reading their package path and module version from the
+// build info embedded in each binary.
+func (svc *GoService) GetDependencies(params entity.UpdateParams) (deps []models.Dependency, err error) {
+	// bin path
+	binPath, err := svc._getBinPath(params.Cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	// skip if bin path does not exist
+	if _, err := os.Stat(binPath); err != nil {
+		return deps, nil
+	}
+
+	// build info of installed binaries
+	cmd := exec.Command(params.Cmd, "version", "-m", binPath)
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	// parse build info
+	var d *models.Dependency
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// new binary
+		if !strings.HasPrefix(line, "\t") {
+			if d != nil && d.Name != "" {
+				deps = append(deps, *d)
+			}
+			d = &models.Dependency{Type: constants.DependencyTypeGo}
+			continue
+		}
+		if d == nil {
+			continue
+		}
+
+		// build info fields
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "path":
+			d.Name = fields[1]
+		case "mod":
+			if len(fields) > 2 {
+				d.Version = fields[2]
+			}
+		}
+	}
+	if d != nil && d.Name != "" {
+		deps = append(deps, *d)
+	}
+
+	return deps, nil
+}
+
+func (svc *GoService) InstallDependencies(params entity.InstallParams) (err error) {
+	// install from config is not supported, as modules in go.mod are
+	// libraries built into the spider rather than installable programs
+	if params.UseConfig {
+		return trace.TraceError(errors.New("installing go modules from config is not supported"))
+	}
+
+	// arguments
+	args := []string{"install"}
+
+	// dependency names
+	for _, depName := range params.Names {
+		// go install requires a version outside a module
+		if v := params.Versions[depName]; v != "" {
+			depName = depName + "@" + v
+		} else if !strings.Contains(depName, "@") {
+			depName = depName + "@latest"
+		}
+		args = append(args, depName)
+	}
+	cmd := exec.Command(params.Cmd, args...)
+
+	// proxy
+	cmd.Env = os.Environ()
+	if params.Proxy != "" {
+		cmd.Env = append(cmd.Env, "GOPROXY="+params.Proxy)
+	}
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (svc *GoService) UninstallDependencies(params entity.UninstallParams) (err error) {
+	// bin path
+	binPath, err := svc._getBinPath(params.Cmd)
+	if err != nil {
+		return err
+	}
+
+	// remove binaries
+	var lines []string
+	for _, depName := range params.Names {
+		filePath := path.Join(binPath, getGoBinaryName(depName))
+		if err := os.Remove(filePath); err != nil {
+			svc.parent._sendLogs(params.TaskId, append(lines, err.Error()))
+			return trace.TraceError(err)
+		}
+		lines = append(lines, fmt.Sprintf("removed %s", filePath))
+	}
+
+	// logging
+	svc.parent._sendLogs(params.TaskId, lines)
+
+	return nil
+}
+
+func (svc *GoService) GetLatestVersion(dep models.Dependency) (v string, err error) {
+	// registry
+	reg, err := svc._getRegistry()
+	if err != nil {
+		return "", err
+	}
+
+	return reg.GetLatestVersion(dep.Name)
+}
+
+// GetManifests returns go dependency manifests in the order of precedence.
+func (svc *GoService) GetManifests() (manifests []string) {
+	return []string{constants.DependencyConfigGoMod}
+}
+
+// GetManifestDependencies returns modules that go.mod of the workspace
+// resolves to, with installed versions of binaries built from packages of
+// the modules.
+func (svc *GoService) GetManifestDependencies(spiderId primitive.ObjectID, workspacePath, manifest string) (deps []models.Dependency, err error) {
+	// resolved modules
+	modules, err := svc._listModules(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range modules {
+		if m.Main {
+			continue
+		}
+		d := models.Dependency{
+			Name:    m.Path,
+			Version: m.Version,
+		}
+		if m.Replace != nil {
+			d.Version = m.Replace.Version
+			if d.Version == "" {
+				// local replacement
+				d.Version = m.Replace.Path
+			}
+		}
+		deps = append(deps, d)
+	}
+
+	// dependencies in db, which are binaries named by package paths
+	depsResultsMap, err := svc._getDependencyResultsMap(spiderId, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// iterate dependencies
+	for i, d := range deps {
+		for name, dr := range depsResultsMap {
+			if name != d.Name && !strings.HasPrefix(name, d.Name+"/") {
+				continue
+			}
+			deps[i].Result = mergeGoDependencyResults(deps[i].Result, dr, d.Version)
+		}
+	}
+
+	return deps, nil
+}
+
+// _listModules returns modules in the build list of the workspace with
+// "go list -m -json all". Modules that cannot be resolved are listed with
+// their errors rather than failing the whole list.
+func (svc *GoService) _listModules(workspacePath string) (modules []entity.GoModule, err error) {
+	// go command
+	goCmd := svc.defaultCmd
+	if err := svc._getSetting(); err == nil {
+		goCmd = svc._getCmd()
+	}
+
+	// list modules
+	cmd := exec.Command(goCmd, "list", "-m", "-e", "-json", "all")
+	cmd.Dir = workspacePath
+	data, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return nil, trace.TraceError(errors.New(fmt.Sprintf("failed to list modules of %s: %s", constants.DependencyConfigGoMod, strings.TrimSpace(string(exitErr.Stderr)))))
+		}
+		return nil, trace.TraceError(err)
+	}
+
+	return parseGoModules(data)
+}
+
+// parseGoModules parses the output of "go list -m -json", which is a stream
+// of json objects.
+func parseGoModules(data []byte) (modules []entity.GoModule, err error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var m entity.GoModule
+		if err := dec.Decode(&m); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, trace.TraceError(err)
+		}
+		modules = append(modules, m)
+	}
+	return modules, nil
+}
+
+// mergeGoDependencyResults merges installed binaries of a module into the
+// result, which is upgradable or downgradable if any binary is built from
+// an older or newer version than the required one.
+func mergeGoDependencyResults(res, dr entity.DependencyResult, version string) entity.DependencyResult {
+	res.Name = dr.Name
+
+	// nodes
+	nodeIdsMap := map[primitive.ObjectID]bool{}
+	for _, id := range res.NodeIds {
+		nodeIdsMap[id] = true
+	}
+	for _, id := range dr.NodeIds {
+		if !nodeIdsMap[id] {
+			nodeIdsMap[id] = true
+			res.NodeIds = append(res.NodeIds, id)
+		}
+	}
+
+	// versions
+	versionsMap := map[string]bool{}
+	for _, v := range res.Versions {
+		versionsMap[v] = true
+	}
+	for _, v := range dr.Versions {
+		if !versionsMap[v] {
+			versionsMap[v] = true
+			res.Versions = append(res.Versions, v)
+		}
+		if c, ok := compareSemverVersions(v, version); ok && c < 0 {
+			res.Upgradable = true
+		} else if ok && c > 0 {
+			res.Downgradable = true
+		}
+	}
+	return res
+}
+
+// GetManifestVersions returns versions that go.mod resolves to, which are
+// always exact versions, except local replacements.
+func (svc *GoService) GetManifestVersions(workspacePath, manifest string, deps []models.Dependency) (versions map[string]string, err error) {
+	versions = map[string]string{}
+	for _, d := range deps {
+		if strings.HasPrefix(d.Version, "v") {
+			versions[d.Name] = d.Version
+		}
+	}
+	return versions, nil
+}
+
+// _getBinPath returns the directory where "go install" puts binaries,
+// i.e. GOBIN or GOPATH/bin.
+func (svc *GoService) _getBinPath(goCmd string) (binPath string, err error) {
+	data, err := exec.Command(goCmd, "env", "GOBIN", "GOPATH").Output()
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) != "" {
+		return strings.TrimSpace(lines[0]), nil
+	}
+	if len(lines) > 1 && strings.TrimSpace(lines[1]) != "" {
+		gopath := filepath.SplitList(strings.TrimSpace(lines[1]))[0]
+		return path.Join(gopath, "bin"), nil
+	}
+	return "", trace.TraceError(errors.New("unable to find GOBIN or GOPATH"))
+}
+
+var goMajorVersionSuffixRegex = regexp.MustCompile("^v[0-9]+$")
+
+// getGoBinaryName returns the name of the binary built from a package path,
+// which is the last path element unless it is a major version suffix.
+func getGoBinaryName(pkgPath string) (name string) {
+	pkgPath = strings.Split(pkgPath, "@")[0]
+	parts := strings.Split(strings.TrimSuffix(pkgPath, "/"), "/")
+	name = parts[len(parts)-1]
+	if goMajorVersionSuffixRegex.MatchString(name) && len(parts) > 1 {
+		name = parts[len(parts)-2]
+	}
+	return name
+}
+
+func NewGoService(parent *Service) (svc *GoService) {
+	svc = &GoService{}
+	baseSvc := newBaseService(
+		svc,
+		parent,
+		constants.DependencyTypeGo,
+		entity.MessageCodes{
+			Update:    constants.MessageCodeGoUpdate,
+			Save:      constants.MessageCodeGoSave,
+			Install:   constants.MessageCodeGoInstall,
+			Uninstall: constants.MessageCodeGoUninstall,
+		},
+	)
+	baseSvc.defaultRegistryType = constants.RegistryTypeGoproxy
+	svc.baseService = baseSvc
+	return svc
+}
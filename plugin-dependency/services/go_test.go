@@ -0,0 +1,59 @@
+package services
+
+import (
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"reflect"
+	"testing"
+)
+
+func TestParseGoModules(t *testing.T) {
+	data := []byte(`{
+	"Path": "example.com/spider",
+	"Main": true
+}
+{
+	"Path": "github.com/gocolly/colly/v2",
+	"Version": "v2.1.0"
+}
+{
+	"Path": "golang.org/x/net",
+	"Version": "v0.17.0",
+	"Indirect": true,
+	"Replace": {
+		"Path": "../net"
+	}
+}
+`)
+	modules, err := parseGoModules(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(modules) != 3 || !modules[0].Main || modules[1].Version != "v2.1.0" || modules[2].Replace == nil || modules[2].Replace.Path != "../net" {
+		t.Errorf("unexpected modules: %+v", modules)
+	}
+
+	if _, err := parseGoModules([]byte(`{"Path": `)); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestMergeGoDependencyResults(t *testing.T) {
+	n1, n2 := primitive.NewObjectID(), primitive.NewObjectID()
+	res := mergeGoDependencyResults(entity.DependencyResult{}, entity.DependencyResult{
+		Name:     "github.com/x/y/cmd/a",
+		NodeIds:  []primitive.ObjectID{n1},
+		Versions: []string{"v1.0.0"},
+	}, "v1.2.0")
+	res = mergeGoDependencyResults(res, entity.DependencyResult{
+		Name:     "github.com/x/y/cmd/b",
+		NodeIds:  []primitive.ObjectID{n1, n2},
+		Versions: []string{"v1.2.0"},
+	}, "v1.2.0")
+	if !reflect.DeepEqual(res.NodeIds, []primitive.ObjectID{n1, n2}) || !reflect.DeepEqual(res.Versions, []string{"v1.0.0", "v1.2.0"}) {
+		t.Errorf("unexpected result: %+v", res)
+	}
+	if !res.Upgradable || res.Downgradable {
+		t.Errorf("expected upgradable only: %+v", res)
+	}
+}
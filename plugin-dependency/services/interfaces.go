@@ -4,6 +4,7 @@ import (
 	"github.com/crawlab-team/plugin-dependency/entity"
 	"github.com/crawlab-team/plugin-dependency/models"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type DependencyService interface {
@@ -14,3 +15,37 @@ type DependencyService interface {
 	UninstallDependencies(params entity.UninstallParams) (err error)
 	GetLatestVersion(dep models.Dependency) (v string, err error)
 }
+
+// DependencyEnvService is implemented by dependency services that support
+// isolated environments per spider.
+type DependencyEnvService interface {
+	GetEnvInfo(spiderId primitive.ObjectID) (info entity.EnvInfo, err error)
+}
+
+// DependencyDryRunService is implemented by dependency services that can
+// resolve dependencies to install without installing them.
+type DependencyDryRunService interface {
+	DryRunInstallDependencies(params entity.InstallParams) (deps []models.Dependency, err error)
+}
+
+// DependencyManifestService is implemented by dependency services that
+// install dependencies declared in manifests of spiders, e.g.
+// requirements.txt.
+type DependencyManifestService interface {
+	GetManifests() (manifests []string) // file names in the order of precedence
+	GetManifestDependencies(spiderId primitive.ObjectID, workspacePath, manifest string) (deps []models.Dependency, err error)
+	GetManifestVersions(workspacePath, manifest string, deps []models.Dependency) (versions map[string]string, err error) // exact versions keyed by name
+}
+
+// DependencyManifestNoteService is implemented by dependency services that
+// note how dependencies of manifests are resolved, e.g. with the environment
+// of the master node, which may differ from other nodes.
+type DependencyManifestNoteService interface {
+	GetManifestNotes(workspacePath, manifest string) (notes []string, err error) // codes of notes
+}
+
+type DependencyRegistry interface {
+	Search(query string, page, size int) (deps []models.Dependency, total int, err error)
+	GetLatestVersion(name string) (v string, err error)
+	GetVersions(name string) (versions []string, err error) // released versions from the latest
+}
@@ -0,0 +1,230 @@
+package services
+
+import (
+	"errors"
+	constants2 "github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/controllers"
+	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// logStreamPollInterval is the interval at which streams re-check logs and
+// status of the task, in case of updates without notifications, e.g. by the
+// reaper.
+const logStreamPollInterval = 5 * time.Second
+
+// logStreamFinishTimeout is the maximum time to wait for log lines up to the
+// last sequence number reported by the node when the task is finished, after
+// which lines are streamed regardless of gaps, e.g. of lost messages.
+const logStreamFinishTimeout = 10 * time.Second
+
+// logBroker notifies streams of tasks that their logs or status are updated.
+type logBroker struct {
+	mu   sync.Mutex
+	subs map[primitive.ObjectID]map[chan struct{}]bool
+}
+
+func (b *logBroker) subscribe(taskId primitive.ObjectID) (ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ch = make(chan struct{}, 1)
+	if b.subs[taskId] == nil {
+		b.subs[taskId] = map[chan struct{}]bool{}
+	}
+	b.subs[taskId][ch] = true
+	return ch
+}
+
+func (b *logBroker) unsubscribe(taskId primitive.ObjectID, ch chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs[taskId], ch)
+	if len(b.subs[taskId]) == 0 {
+		delete(b.subs, taskId)
+	}
+}
+
+func (b *logBroker) notify(taskId primitive.ObjectID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[taskId] {
+		// skip if a notification is pending
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func newLogBroker() (b *logBroker) {
+	return &logBroker{
+		subs: map[primitive.ObjectID]map[chan struct{}]bool{},
+	}
+}
+
+// streamLogs streams log lines of the task as server-sent events. Each line
+// is sent as a "log" event with its sequence number as id, so that clients
+// can resume after the sequence number given by the "offset" query parameter
+// or the Last-Event-ID header. A "status" event is sent when the task is
+// finished, after which the stream is closed.
+func (svc *TaskService) streamLogs(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// offset
+	offsetStr := c.Query("offset")
+	if offsetStr == "" {
+		offsetStr = c.GetHeader("Last-Event-ID")
+	}
+	var offset int64
+	if offsetStr != "" {
+		offset, err = strconv.ParseInt(offsetStr, 10, 64)
+		if err != nil || offset < 0 {
+			controllers.HandleErrorBadRequest(c, errors.New("invalid offset"))
+			return
+		}
+	}
+
+	// task
+	var t models.Task
+	if err := svc.parent.colT.FindId(id).One(&t); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// subscribe before reading logs so that no update is missed
+	ch := svc.parent.logBroker.subscribe(id)
+	defer svc.parent.logBroker.unsubscribe(id, ch)
+
+	// headers
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	ticker := time.NewTicker(logStreamPollInterval)
+	defer ticker.Stop()
+
+	// sequence number of the last line sent
+	lastSeq := offset
+	sendLogs := func(all bool) (err error) {
+		logList, err := svc._getLogsAfter(id, lastSeq, all)
+		if err != nil {
+			return err
+		}
+		for _, l := range logList {
+			c.Render(-1, sse.Event{
+				Id:    strconv.FormatInt(l.Seq, 10),
+				Event: "log",
+				Data:  l.Content,
+			})
+			lastSeq = l.Seq
+		}
+		c.Writer.Flush()
+		return nil
+	}
+
+	c.Stream(func(w io.Writer) bool {
+		// new lines
+		if err := sendLogs(false); err != nil {
+			trace.PrintError(err)
+			return false
+		}
+
+		// task status
+		if err := svc.parent.colT.FindId(id).One(&t); err != nil {
+			trace.PrintError(err)
+			return false
+		}
+		if isTaskFinished(t.Status) {
+			// lines up to the last one reported by the node, which may be
+			// inserted after the status
+			timeout := time.After(logStreamFinishTimeout)
+		wait:
+			for lastSeq < t.LastLogSeq {
+				select {
+				case <-c.Request.Context().Done():
+					return false
+				case <-timeout:
+					break wait
+				case <-ch:
+				}
+				if err := sendLogs(false); err != nil {
+					trace.PrintError(err)
+					return false
+				}
+			}
+
+			// remaining lines regardless of gaps
+			if err := sendLogs(true); err != nil {
+				trace.PrintError(err)
+			}
+
+			// final status
+			c.Render(-1, sse.Event{
+				Event: "status",
+				Data: gin.H{
+					"status": t.Status,
+					"error":  t.Error,
+				},
+			})
+			return false
+		}
+
+		// wait for updates
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ch:
+		case <-ticker.C:
+		}
+		return true
+	})
+}
+
+// _getLogsAfter returns log lines of the task with sequence numbers after
+// the given one in order. As batches of lines are inserted concurrently, a
+// later batch may be visible before an earlier one, so lines are returned
+// only up to the first gap in sequence numbers unless all is true.
+func (svc *TaskService) _getLogsAfter(taskId primitive.ObjectID, afterSeq int64, all bool) (logList []models.Log, err error) {
+	var list []models.Log
+	if err := svc.parent.colL.Find(bson.M{
+		"task_id": taskId,
+		"seq":     bson.M{"$gt": afterSeq},
+	}, &mongo2.FindOptions{
+		Sort: bson.D{{"seq", 1}},
+	}).All(&list); err != nil && err.Error() != mongo.ErrNoDocuments.Error() {
+		return nil, trace.TraceError(err)
+	}
+	for _, l := range list {
+		if !all && l.Seq != afterSeq+1 {
+			break
+		}
+		logList = append(logList, l)
+		afterSeq = l.Seq
+	}
+	return logList, nil
+}
+
+// isTaskFinished returns whether the task of the status is not running.
+func isTaskFinished(status string) bool {
+	switch status {
+	case constants2.TaskStatusFinished, constants2.TaskStatusError, constants2.TaskStatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,407 @@
+package services
+
+import (
+	"encoding/xml"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MavenService manages Maven artifacts ("groupId:artifactId") in the local
+// repository of each node.
+type MavenService struct {
+	*baseService
+}
+
+func (svc *MavenService) GetRepoList(c *gin.Context) {
+	svc._getRepoList(c)
+}
+
+// GetDependencies lists artifacts in the local repository by their pom
+// files, keeping the highest version of each artifact.
+func (svc *MavenService) GetDependencies(params entity.UpdateParams) (deps []models.Dependency, err error) {
+	// local repository
+	repoPath, err := getMavenLocalRepositoryPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// skip if local repository does not exist
+	if _, err := os.Stat(repoPath); err != nil {
+		return deps, nil
+	}
+
+	// walk pom files, i.e. <group path>/<artifact>/<version>/<artifact>-<version>.pom
+	depsMap := map[string]models.Dependency{}
+	err = filepath.Walk(repoPath, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(p, ".pom") {
+			return nil
+		}
+		relPath, err := filepath.Rel(repoPath, p)
+		if err != nil {
+			return nil
+		}
+		parts := strings.Split(filepath.ToSlash(relPath), "/")
+		if len(parts) < 4 {
+			return nil
+		}
+		version := parts[len(parts)-2]
+		artifactId := parts[len(parts)-3]
+		groupId := strings.Join(parts[:len(parts)-3], ".")
+		if info.Name() != fmt.Sprintf("%s-%s.pom", artifactId, version) {
+			return nil
+		}
+		name := groupId + ":" + artifactId
+		if d, ok := depsMap[name]; ok && compareMavenVersions(d.Version, version) >= 0 {
+			return nil
+		}
+		depsMap[name] = models.Dependency{
+			Type:    constants.DependencyTypeMaven,
+			Name:    name,
+			Version: version,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	for _, d := range depsMap {
+		deps = append(deps, d)
+	}
+
+	return deps, nil
+}
+
+func (svc *MavenService) InstallDependencies(params entity.InstallParams) (err error) {
+	// arguments
+	var args []string
+
+	// batch mode
+	args = append(args, "-B")
+
+	// proxy (remote repository)
+	if params.Proxy != "" {
+		args = append(args, "-DremoteRepositories="+params.Proxy)
+	}
+
+	// command
+	var cmd *exec.Cmd
+
+	if params.UseConfig {
+		// workspace path
+		workspacePath, err := svc._getInstallWorkspacePath(params)
+		if err != nil {
+			return err
+		}
+
+		// resolve dependencies in pom.xml
+		args = append(args, "dependency:resolve")
+		cmd = exec.Command(params.Cmd, args...)
+		cmd.Dir = workspacePath
+
+		// logging
+		svc.parent._configureLogging(params.TaskId, cmd)
+
+		// run
+		if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	// dependency:get only accepts one artifact at a time
+	for _, depName := range params.Names {
+		// artifact with version, defaulting to the latest release
+		artifact := depName
+		if v := params.Versions[depName]; v != "" {
+			artifact = depName + ":" + v
+		} else if strings.Count(depName, ":") < 2 {
+			artifact = depName + ":RELEASE"
+		}
+
+		// command
+		cmd = exec.Command(params.Cmd, append(args, "dependency:get", "-Dartifact="+artifact)...)
+
+		// logging
+		svc.parent._configureLogging(params.TaskId, cmd)
+
+		// run
+		if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (svc *MavenService) UninstallDependencies(params entity.UninstallParams) (err error) {
+	// local repository
+	repoPath, err := getMavenLocalRepositoryPath()
+	if err != nil {
+		return err
+	}
+
+	// remove artifact directories
+	var lines []string
+	for _, depName := range params.Names {
+		groupId, artifactId, err := parseMavenArtifactName(depName)
+		if err != nil {
+			return err
+		}
+		dirPath := filepath.Join(repoPath, filepath.FromSlash(strings.ReplaceAll(groupId, ".", "/")), artifactId)
+		if err := os.RemoveAll(dirPath); err != nil {
+			svc.parent._sendLogs(params.TaskId, append(lines, err.Error()))
+			return trace.TraceError(err)
+		}
+		lines = append(lines, fmt.Sprintf("removed %s", dirPath))
+	}
+
+	// logging
+	svc.parent._sendLogs(params.TaskId, lines)
+
+	return nil
+}
+
+func (svc *MavenService) GetLatestVersion(dep models.Dependency) (v string, err error) {
+	// registry
+	reg, err := svc._getRegistry()
+	if err != nil {
+		return "", err
+	}
+
+	return reg.GetLatestVersion(dep.Name)
+}
+
+// GetManifests returns maven dependency manifests in the order of
+// precedence.
+func (svc *MavenService) GetManifests() (manifests []string) {
+	return []string{constants.DependencyConfigPomXml}
+}
+
+// GetManifestDependencies returns dependencies declared in pom.xml with
+// installed versions.
+func (svc *MavenService) GetManifestDependencies(spiderId primitive.ObjectID, workspacePath, manifest string) (deps []models.Dependency, err error) {
+	// file path
+	filePath := path.Join(workspacePath, constants.DependencyConfigPomXml)
+
+	// file content
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// parse pom
+	var pom entity.MavenPom
+	if err := xml.Unmarshal(data, &pom); err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// dependency names
+	var depNames []string
+
+	// iterate dependencies
+	for _, pd := range pom.Dependencies {
+		d := models.Dependency{
+			Name:    pd.GroupId + ":" + pd.ArtifactId,
+			Version: pd.Version,
+		}
+
+		// add to dependency names
+		depNames = append(depNames, d.Name)
+
+		// add to dependencies
+		deps = append(deps, d)
+	}
+
+	// dependencies in db
+	depsResultsMap, err := svc._getDependencyResultsMap(spiderId, depNames)
+	if err != nil {
+		return nil, err
+	}
+
+	// iterate dependencies
+	for i, d := range deps {
+		dr, ok := depsResultsMap[d.Name]
+		if !ok {
+			continue
+		}
+		deps[i].Result = dr
+	}
+
+	return deps, nil
+}
+
+// GetManifestVersions returns versions declared in pom.xml, except version
+// ranges and unresolved properties.
+func (svc *MavenService) GetManifestVersions(workspacePath, manifest string, deps []models.Dependency) (versions map[string]string, err error) {
+	versions = map[string]string{}
+	for _, d := range deps {
+		if d.Version == "" || strings.ContainsAny(d.Version, "[(${") {
+			continue
+		}
+		versions[d.Name] = d.Version
+	}
+	return versions, nil
+}
+
+// getMavenLocalRepositoryPath returns the default local repository path,
+// which can be overridden by the MAVEN_REPO_LOCAL environment variable.
+func getMavenLocalRepositoryPath() (repoPath string, err error) {
+	if repoPath = os.Getenv("MAVEN_REPO_LOCAL"); repoPath != "" {
+		return repoPath, nil
+	}
+	homePath, err := os.UserHomeDir()
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	return filepath.Join(homePath, ".m2", "repository"), nil
+}
+
+// compareMavenVersions compares two versions in the way of Maven's
+// ComparableVersion, e.g. "1.0-alpha" < "1.0-rc1" < "1.0" < "1.0-sp" < "1.0.1".
+func compareMavenVersions(a, b string) int {
+	ia := parseMavenVersion(a)
+	ib := parseMavenVersion(b)
+	for i := 0; i < len(ia) || i < len(ib); i++ {
+		var x, y mavenVersionItem
+		if i < len(ia) {
+			x = ia[i]
+		}
+		if i < len(ib) {
+			y = ib[i]
+		}
+		if res := x.compare(y); res != 0 {
+			return res
+		}
+	}
+	return 0
+}
+
+// mavenQualifiers are well-known qualifiers in ascending order. An empty
+// qualifier is a release, and unknown qualifiers come after all of them.
+var mavenQualifiers = []string{"alpha", "beta", "milestone", "rc", "snapshot", "", "sp"}
+
+var mavenQualifierAliases = map[string]string{
+	"a":       "alpha",
+	"b":       "beta",
+	"m":       "milestone",
+	"cr":      "rc",
+	"ga":      "",
+	"final":   "",
+	"release": "",
+}
+
+// mavenVersionItem is a numeric or a qualifier item of a maven version. The
+// zero value is padding, which equals to a release or zero.
+type mavenVersionItem struct {
+	isNumber  bool
+	number    int
+	qualifier string
+}
+
+func (i mavenVersionItem) compare(o mavenVersionItem) int {
+	switch {
+	case i.isNumber && o.isNumber:
+		return compareInt(i.number, o.number)
+	case i.isNumber:
+		if i.number == 0 && o.qualifier == "" {
+			return 0
+		}
+		return 1
+	case o.isNumber:
+		return -o.compare(i)
+	}
+	ri, rj := getMavenQualifierRank(i.qualifier), getMavenQualifierRank(o.qualifier)
+	if ri != rj {
+		return compareInt(ri, rj)
+	}
+	return strings.Compare(i.qualifier, o.qualifier)
+}
+
+func getMavenQualifierRank(q string) int {
+	for i, v := range mavenQualifiers {
+		if v == q {
+			return i
+		}
+	}
+	return len(mavenQualifiers)
+}
+
+// parseMavenVersion splits a version into items at separators and at
+// transitions between digits and letters, dropping trailing release items.
+func parseMavenVersion(v string) (items []mavenVersionItem) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	start := 0
+	flush := func(end int) {
+		if start >= end {
+			return
+		}
+		s := v[start:end]
+		if n, err := strconv.Atoi(s); err == nil {
+			items = append(items, mavenVersionItem{isNumber: true, number: n})
+		} else {
+			if alias, ok := mavenQualifierAliases[s]; ok {
+				s = alias
+			}
+			items = append(items, mavenVersionItem{qualifier: s})
+		}
+	}
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c == '.' || c == '-' || c == '_' {
+			flush(i)
+			start = i + 1
+			continue
+		}
+		if i > start && isDigit(c) != isDigit(v[i-1]) {
+			flush(i)
+			start = i
+		}
+	}
+	flush(len(v))
+
+	// trailing zeros and release qualifiers, e.g. "1.0.0" equals to "1"
+	for len(items) > 0 {
+		last := items[len(items)-1]
+		if (last.isNumber && last.number != 0) || (!last.isNumber && last.qualifier != "") {
+			break
+		}
+		items = items[:len(items)-1]
+	}
+
+	return items
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func NewMavenService(parent *Service) (svc *MavenService) {
+	svc = &MavenService{}
+	baseSvc := newBaseService(
+		svc,
+		parent,
+		constants.DependencyTypeMaven,
+		entity.MessageCodes{
+			Update:    constants.MessageCodeMavenUpdate,
+			Save:      constants.MessageCodeMavenSave,
+			Install:   constants.MessageCodeMavenInstall,
+			Uninstall: constants.MessageCodeMavenUninstall,
+		},
+	)
+	baseSvc.defaultRegistryType = constants.RegistryTypeMaven
+	svc.baseService = baseSvc
+	return svc
+}
@@ -4,151 +4,51 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/crawlab-team/crawlab-core/controllers"
+	"github.com/Masterminds/semver/v3"
+	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/crawlab-team/go-trace"
 	"github.com/crawlab-team/plugin-dependency/constants"
 	"github.com/crawlab-team/plugin-dependency/entity"
 	"github.com/crawlab-team/plugin-dependency/models"
 	"github.com/gin-gonic/gin"
-	"github.com/imroc/req"
-	"go.mongodb.org/mongo-driver/bson"
-	mongo2 "go.mongodb.org/mongo-driver/mongo"
-	"net/url"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io/ioutil"
+	"os"
 	"os/exec"
-	"time"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
 )
 
 type NodeService struct {
 	*baseService
 }
 
-func (svc *NodeService) Init() {
-	svc.api.GET("/node", svc.getList)
-	svc.api.POST("/node/update", svc.update)
-	svc.api.POST("/node/install", svc.install)
-	svc.api.POST("/node/uninstall", svc.uninstall)
-}
-
 func (svc *NodeService) GetRepoList(c *gin.Context) {
-	// query
-	query := c.Query("query")
-	pagination := controllers.MustGetPagination(c)
-
-	// validate
-	if query == "" {
-		controllers.HandleErrorBadRequest(c, errors.New("empty query"))
-		return
-	}
-
-	// request session
-	reqSession := req.New()
-
-	// set timeout
-	reqSession.SetTimeout(15 * time.Second)
-
-	// user agent
-	ua := req.Header{"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.61 Safari/537.36"}
-
-	// request url
-	requestUrl := fmt.Sprintf("https://api.npms.io/v2/search?from=%d&q=%s&size=20", (pagination.Page-1)*pagination.Size, url.QueryEscape(query))
+	svc._getRepoList(c)
+}
 
-	// perform request
-	res, err := reqSession.Get(requestUrl, ua)
-	if err != nil {
-		if res != nil {
-			_, _ = c.Writer.Write(res.Bytes())
-			_ = c.AbortWithError(res.Response().StatusCode, err)
-			return
+func (svc *NodeService) GetDependencies(params entity.UpdateParams) (deps []models.Dependency, err error) {
+	// scope arguments
+	scopeArgs := []string{"-g"}
+	if params.Isolated {
+		envPath, err := svc._getEnvPath(params.SpiderId)
+		if err != nil {
+			return nil, err
 		}
-		controllers.HandleErrorInternalServerError(c, err)
-		return
-	}
-
-	// response
-	var npmRes entity.NpmResponseList
-	if err := res.ToJSON(&npmRes); err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
-	}
-
-	// empty results
-	if npmRes.Total == 0 {
-		controllers.HandleSuccess(c)
-		return
-	}
 
-	// dependencies
-	var deps []models.Dependency
-	var depNames []string
-	for _, r := range npmRes.Results {
-		d := models.Dependency{
-			Name:          r.Package.Name,
-			LatestVersion: r.Package.Version,
+		// skip if environment is not created yet
+		if !utils.Exists(envPath) {
+			return deps, nil
 		}
-		deps = append(deps, d)
-		depNames = append(depNames, d.Name)
-	}
-
-	// total
-	total := npmRes.Total
 
-	// dependencies in db
-	var depsResults []entity.DependencyResult
-	pipelines := mongo2.Pipeline{
-		{{
-			"$match",
-			bson.M{
-				"type": constants.DependencyTypeNode,
-				"name": bson.M{
-					"$in": depNames,
-				},
-			},
-		}},
-		{{
-			"$group",
-			bson.M{
-				"_id": "$name",
-				"node_ids": bson.M{
-					"$push": "$node_id",
-				},
-				"versions": bson.M{
-					"$addToSet": "$version",
-				},
-			},
-		}},
-		{{
-			"$project",
-			bson.M{
-				"name":     "$_id",
-				"node_ids": "$node_ids",
-				"versions": "$versions",
-			},
-		}},
-	}
-	if err := svc.parent.colD.Aggregate(pipelines, nil).All(&depsResults); err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
-	}
-
-	// dependencies map
-	depsResultsMap := map[string]entity.DependencyResult{}
-	for _, dr := range depsResults {
-		depsResultsMap[dr.Name] = dr
+		scopeArgs = []string{"--prefix", envPath}
 	}
 
-	// iterate dependencies
-	for i, d := range deps {
-		dr, ok := depsResultsMap[d.Name]
-		if ok {
-			deps[i].Result = dr
-		}
-	}
-
-	controllers.HandleSuccessWithListData(c, deps, total)
-}
-
-func (svc *NodeService) GetDependencies(params entity.UpdateParams) (deps []models.Dependency, err error) {
-	cmd := exec.Command(params.Cmd, "list", "-g", "--json", "--depth", "0")
+	args := append([]string{"list"}, scopeArgs...)
+	args = append(args, "--json", "--depth", "0")
+	cmd := exec.Command(params.Cmd, args...)
 	data, err := cmd.Output()
 	if err != nil {
 		return nil, err
@@ -169,14 +69,30 @@ func (svc *NodeService) GetDependencies(params entity.UpdateParams) (deps []mode
 }
 
 func (svc *NodeService) InstallDependencies(params entity.InstallParams) (err error) {
+	// use config
+	if params.UseConfig {
+		return svc._installDependenciesByConfig(params)
+	}
+
 	// arguments
 	var args []string
 
 	// install
 	args = append(args, "install")
 
-	// global
-	args = append(args, "-g")
+	// scope
+	if params.Isolated {
+		envPath, err := svc._getEnvPath(params.SpiderId)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(envPath, os.FileMode(0766)); err != nil {
+			return trace.TraceError(err)
+		}
+		args = append(args, "--prefix", envPath)
+	} else {
+		args = append(args, "-g")
+	}
 
 	// proxy
 	if params.Proxy != "" {
@@ -184,18 +100,18 @@ func (svc *NodeService) InstallDependencies(params entity.InstallParams) (err er
 		args = append(args, params.Proxy)
 	}
 
-	if params.UseConfig {
-		// use config
-	} else {
-		// dependency names
-		for _, depName := range params.Names {
-			// upgrade
-			if params.Upgrade {
-				depName = depName + "@latest"
-			}
-
-			args = append(args, depName)
+	// dependency names
+	for _, depName := range params.Names {
+		// pinned version, version range or upgrade
+		if v := params.Versions[depName]; v != "" {
+			depName = depName + "@" + v
+		} else if s := params.Specifiers[depName]; s != "" {
+			depName = depName + "@" + s
+		} else if params.Upgrade {
+			depName = depName + "@latest"
 		}
+
+		args = append(args, depName)
 	}
 
 	// command
@@ -204,26 +120,146 @@ func (svc *NodeService) InstallDependencies(params entity.InstallParams) (err er
 	// logging
 	svc.parent._configureLogging(params.TaskId, cmd)
 
-	// start
-	if err := cmd.Start(); err != nil {
-		return trace.TraceError(err)
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// _installDependenciesByConfig installs dependencies in package.json of the
+// spider workspace. In the isolated environment of the spider, "npm ci" is
+// used if package-lock.json exists, so that locked versions are installed.
+// Otherwise, dependencies are installed globally, as node_modules in the
+// workspace would be removed by the next sync of the workspace.
+func (svc *NodeService) _installDependenciesByConfig(params entity.InstallParams) (err error) {
+	// workspace path
+	workspacePath, err := svc._getInstallWorkspacePath(params)
+	if err != nil {
+		return err
 	}
 
-	// wait
-	if err := cmd.Wait(); err != nil {
+	// global environment
+	if !params.Isolated {
+		return svc._installDependenciesByConfigGlobally(params, workspacePath)
+	}
+
+	// install path
+	installPath, err := svc._getEnvPath(params.SpiderId)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(installPath, os.FileMode(0766)); err != nil {
 		return trace.TraceError(err)
 	}
 
+	// copy config files to environment
+	for _, fileName := range []string{
+		constants.DependencyConfigPackageJson,
+		constants.DependencyConfigPackageLockJson,
+	} {
+		src := path.Join(workspacePath, fileName)
+		dst := path.Join(installPath, fileName)
+		if !utils.Exists(src) {
+			_ = os.Remove(dst)
+			continue
+		}
+		if err := utils.CopyFile(src, dst); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	// arguments
+	var args []string
+
+	// install or clean install
+	if utils.Exists(path.Join(installPath, constants.DependencyConfigPackageLockJson)) {
+		args = append(args, "ci")
+	} else {
+		args = append(args, "install")
+	}
+
+	// proxy
+	if params.Proxy != "" {
+		args = append(args, "--registry")
+		args = append(args, params.Proxy)
+	}
+
+	// command
+	cmd := exec.Command(params.Cmd, args...)
+	cmd.Dir = installPath
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// _installDependenciesByConfigGlobally installs dependencies in package.json
+// of the workspace globally, with versions locked in package-lock.json if
+// any, or otherwise with version ranges in package.json.
+func (svc *NodeService) _installDependenciesByConfigGlobally(params entity.InstallParams, workspacePath string) (err error) {
+	// package.json
+	pkg, err := readNpmPackageJson(workspacePath)
+	if err != nil {
+		return err
+	}
+
+	// locked versions
+	lockedVersions, err := getNpmLockedVersions(workspacePath)
+	if err != nil {
+		return err
+	}
+
+	// dependencies with versions
+	installParams := params
+	installParams.UseConfig = false
+	installParams.Names = nil
+	installParams.Versions = map[string]string{}
+	installParams.Specifiers = map[string]string{}
+	for _, m := range []map[string]string{pkg.Dependencies, pkg.DevDependencies} {
+		for name, s := range m {
+			if _, ok := installParams.Specifiers[name]; ok {
+				continue
+			}
+			installParams.Names = append(installParams.Names, name)
+			installParams.Specifiers[name] = s
+			if v, ok := lockedVersions[name]; ok {
+				installParams.Versions[name] = v
+			}
+		}
+	}
+	if len(installParams.Names) == 0 {
+		return nil
+	}
+	sort.Strings(installParams.Names)
+
+	return svc.InstallDependencies(installParams)
+}
+
 func (svc *NodeService) UninstallDependencies(params entity.UninstallParams) (err error) {
 	// arguments
 	var args []string
 
 	// uninstall
 	args = append(args, "uninstall")
-	args = append(args, "-g")
+
+	// scope
+	if params.Isolated {
+		envPath, err := svc._getEnvPath(params.SpiderId)
+		if err != nil {
+			return err
+		}
+		args = append(args, "--prefix", envPath)
+	} else {
+		args = append(args, "-g")
+	}
 
 	// dependency names
 	for _, depName := range params.Names {
@@ -236,50 +272,305 @@ func (svc *NodeService) UninstallDependencies(params entity.UninstallParams) (er
 	// logging
 	svc.parent._configureLogging(params.TaskId, cmd)
 
-	// start
-	if err := cmd.Start(); err != nil {
-		return trace.TraceError(err)
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
 	}
 
-	// wait
-	if err := cmd.Wait(); err != nil {
-		return trace.TraceError(err)
+	return nil
+}
+
+// DryRunInstallDependencies resolves dependencies to install by running
+// "npm install --package-lock-only" for a package.json in a temporary
+// directory, and reads versions of direct dependencies from the resulting
+// package-lock.json. Nothing is installed in the environment.
+func (svc *NodeService) DryRunInstallDependencies(params entity.InstallParams) (deps []models.Dependency, err error) {
+	// temporary directory
+	tmpPath, err := ioutil.TempDir("", "npm-dry-run-")
+	if err != nil {
+		return nil, trace.TraceError(err)
 	}
+	defer os.RemoveAll(tmpPath)
 
-	return nil
+	// package.json and package-lock.json
+	if params.UseConfig {
+		workspacePath, err := svc._getInstallWorkspacePath(params)
+		if err != nil {
+			return nil, err
+		}
+		for _, fileName := range []string{
+			constants.DependencyConfigPackageJson,
+			constants.DependencyConfigPackageLockJson,
+		} {
+			src := path.Join(workspacePath, fileName)
+			if !utils.Exists(src) {
+				continue
+			}
+			if err := utils.CopyFile(src, path.Join(tmpPath, fileName)); err != nil {
+				return nil, trace.TraceError(err)
+			}
+		}
+	} else {
+		pkg := entity.NpmPackageJson{
+			Name:         "crawlab-dry-run",
+			Version:      "0.0.0",
+			Dependencies: map[string]string{},
+		}
+		for _, depName := range params.Names {
+			// pinned version, version range or latest
+			spec := "latest"
+			if v := params.Versions[depName]; v != "" {
+				spec = v
+			} else if s := params.Specifiers[depName]; s != "" {
+				spec = s
+			}
+			pkg.Dependencies[depName] = spec
+		}
+		data, err := json.Marshal(pkg)
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		if err := ioutil.WriteFile(path.Join(tmpPath, constants.DependencyConfigPackageJson), data, os.FileMode(0644)); err != nil {
+			return nil, trace.TraceError(err)
+		}
+	}
+
+	// direct dependencies
+	pkg, err := readNpmPackageJson(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// arguments
+	args := []string{"install", "--package-lock-only", "--ignore-scripts", "--no-audit", "--no-fund"}
+
+	// proxy
+	if params.Proxy != "" {
+		args = append(args, "--registry", params.Proxy)
+	}
+
+	// command
+	cmd := exec.Command(params.Cmd, args...)
+	cmd.Dir = tmpPath
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return nil, err
+	}
+
+	// resolved versions
+	lockedVersions, err := getNpmLockedVersions(tmpPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range []map[string]string{pkg.Dependencies, pkg.DevDependencies} {
+		for name := range m {
+			v, ok := lockedVersions[name]
+			if !ok {
+				return nil, trace.TraceError(errors.New(fmt.Sprintf("%s is not resolved in %s", name, constants.DependencyConfigPackageLockJson)))
+			}
+			deps = append(deps, models.Dependency{
+				Type:    constants.DependencyTypeNode,
+				Name:    name,
+				Version: v,
+			})
+		}
+	}
+
+	return deps, nil
 }
 
 func (svc *NodeService) GetLatestVersion(dep models.Dependency) (v string, err error) {
-	// not exists in cache, request from pypi
-	reqSession := req.New()
+	// registry
+	reg, err := svc._getRegistry()
+	if err != nil {
+		return "", err
+	}
 
-	// set timeout
-	reqSession.SetTimeout(60 * time.Second)
+	return reg.GetLatestVersion(dep.Name)
+}
 
-	// user agent
-	ua := req.Header{"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.61 Safari/537.36"}
+// GetEnvInfo returns the node environment used by tasks of the spider.
+func (svc *NodeService) GetEnvInfo(spiderId primitive.ObjectID) (info entity.EnvInfo, err error) {
+	// setting
+	if err := svc._getSetting(); err != nil {
+		return info, err
+	}
 
-	// request url
-	requestUrl := fmt.Sprintf("https://api.npms.io/v2/package/%s", dep.Name)
+	// global environment
+	if !svc._isIsolated(spiderId) {
+		return info, nil
+	}
 
-	// perform request
-	res, err := reqSession.Get(requestUrl, ua)
+	// isolated environment
+	envPath, err := svc._getEnvPath(spiderId)
 	if err != nil {
-		return "", trace.TraceError(err)
+		return info, err
 	}
+	info.Isolated = true
+	info.Path = envPath
+	info.NodePath = path.Join(envPath, "node_modules")
+	info.BinPath = path.Join(info.NodePath, ".bin")
+
+	return info, nil
+}
 
-	// response
-	var npmRes entity.NpmResponseDetail
-	if err := res.ToJSON(&npmRes); err != nil {
-		return "", trace.TraceError(err)
+// GetManifests returns node dependency manifests in the order of precedence.
+func (svc *NodeService) GetManifests() (manifests []string) {
+	return []string{constants.DependencyConfigPackageJson}
+}
+
+// GetManifestDependencies returns dependencies and dev dependencies in
+// package.json with installed versions compared to the version ranges, or to
+// the locked versions if any.
+func (svc *NodeService) GetManifestDependencies(spiderId primitive.ObjectID, workspacePath, manifest string) (deps []models.Dependency, err error) {
+	// package.json
+	pkg, err := readNpmPackageJson(workspacePath)
+	if err != nil {
+		return nil, err
 	}
 
-	// version
-	v = npmRes.Collected.Metadata.Version
+	// locked versions
+	lockedVersions, err := getNpmLockedVersions(workspacePath)
+	if err != nil {
+		return nil, err
+	}
 
-	return v, nil
+	// dependency names
+	var depNames []string
+	depNamesMap := map[string]bool{}
+
+	// iterate dependencies and dev dependencies
+	for _, m := range []map[string]string{pkg.Dependencies, pkg.DevDependencies} {
+		// sorted names
+		var names []string
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			// skip duplicates
+			if depNamesMap[name] {
+				continue
+			}
+			depNamesMap[name] = true
+
+			// dependency result
+			d := models.Dependency{
+				Name:    name,
+				Version: m[name],
+			}
+
+			// add to dependency names
+			depNames = append(depNames, d.Name)
+
+			// add to dependencies
+			deps = append(deps, d)
+		}
+	}
+
+	// dependencies in db
+	depsResultsMap, err := svc._getDependencyResultsMap(spiderId, depNames)
+	if err != nil {
+		return nil, err
+	}
+
+	// iterate dependencies
+	for i, d := range deps {
+		// dependency result
+		dr, ok := depsResultsMap[d.Name]
+		if !ok {
+			continue
+		}
+		deps[i].Result = dr
+
+		// iterate installed versions
+		for _, v := range dr.Versions {
+			// compare with the required version
+			res := compareNpmVersion(v, d.Version, lockedVersions[d.Name])
+			if res < 0 {
+				deps[i].Result.Upgradable = true
+			} else if res > 0 {
+				deps[i].Result.Downgradable = true
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// GetManifestVersions returns versions locked in package-lock.json, or exact
+// versions in package.json, while dependencies with version ranges only are
+// resolved by npm.
+func (svc *NodeService) GetManifestVersions(workspacePath, manifest string, deps []models.Dependency) (versions map[string]string, err error) {
+	lockedVersions, err := getNpmLockedVersions(workspacePath)
+	if err != nil {
+		return nil, err
+	}
+	versions = map[string]string{}
+	for _, d := range deps {
+		if v, ok := lockedVersions[d.Name]; ok {
+			versions[d.Name] = v
+		} else if v := strings.TrimPrefix(d.Version, "="); isNpmExactVersion(v) {
+			versions[d.Name] = strings.TrimPrefix(v, "v")
+		}
+	}
+	return versions, nil
+}
+
+// compareNpmVersion compares an installed version with the version locked
+// in package-lock.json, or with the version range in package.json if it is
+// not locked. It returns -1 if the installed version should be upgraded, 1
+// if it should be downgraded, and 0 if it is satisfied or not comparable.
+func compareNpmVersion(installed, required, locked string) (res int) {
+	// installed version
+	iv, err := semver.NewVersion(installed)
+	if err != nil {
+		return 0
+	}
+
+	// locked version
+	if locked != "" {
+		lv, err := semver.NewVersion(locked)
+		if err != nil {
+			return 0
+		}
+		return iv.Compare(lv)
+	}
+
+	// version range
+	c, err := semver.NewConstraint(required)
+	if err != nil {
+		return 0
+	}
+	if c.Check(iv) {
+		return 0
+	}
+
+	// compare with the lower bound of the range
+	lb, err := semver.NewVersion(npmVersionPattern.FindString(required))
+	if err != nil {
+		return 0
+	}
+	if iv.LessThan(lb) {
+		return -1
+	}
+	return 1
+}
+
+// isNpmExactVersion returns whether the version of a dependency in
+// package.json is an exact version rather than a version range.
+func isNpmExactVersion(v string) bool {
+	_, err := semver.StrictNewVersion(strings.TrimPrefix(v, "v"))
+	return err == nil
 }
 
+var npmVersionPattern = regexp.MustCompile(`\d+(\.\d+){0,2}`)
+
 func NewNodeService(parent *Service) (svc *NodeService) {
 	svc = &NodeService{}
 	baseSvc := newBaseService(
@@ -293,6 +584,68 @@ func NewNodeService(parent *Service) (svc *NodeService) {
 			Uninstall: constants.MessageCodeNodeUninstall,
 		},
 	)
+	baseSvc.defaultRegistryType = constants.RegistryTypeNpm
 	svc.baseService = baseSvc
 	return svc
 }
+
+// readNpmPackageJson reads package.json in the directory.
+func readNpmPackageJson(dirPath string) (pkg entity.NpmPackageJson, err error) {
+	data, err := ioutil.ReadFile(path.Join(dirPath, constants.DependencyConfigPackageJson))
+	if err != nil {
+		return pkg, trace.TraceError(err)
+	}
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return pkg, trace.TraceError(errors.New(fmt.Sprintf("invalid %s: %v", constants.DependencyConfigPackageJson, err)))
+	}
+	return pkg, nil
+}
+
+// getNpmLockedVersions returns versions of top-level packages locked in
+// package-lock.json of the directory, keyed by package name. Both the legacy
+// format (lockfileVersion 1) and the "packages" format (lockfileVersion 2
+// and 3) are supported.
+func getNpmLockedVersions(dirPath string) (versions map[string]string, err error) {
+	versions = map[string]string{}
+
+	// file path
+	filePath := path.Join(dirPath, constants.DependencyConfigPackageLockJson)
+	if !utils.Exists(filePath) {
+		return versions, nil
+	}
+
+	// file content
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// package-lock.json
+	var lock entity.NpmPackageLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid %s: %v", constants.DependencyConfigPackageLockJson, err)))
+	}
+
+	// packages (lockfileVersion >= 2)
+	for key, p := range lock.Packages {
+		if !strings.HasPrefix(key, "node_modules/") {
+			continue
+		}
+		name := strings.TrimPrefix(key, "node_modules/")
+		if strings.Contains(name, "/node_modules/") {
+			// nested dependency
+			continue
+		}
+		versions[name] = p.Version
+	}
+
+	// dependencies (lockfileVersion 1)
+	for name, p := range lock.Dependencies {
+		if _, ok := versions[name]; ok {
+			continue
+		}
+		versions[name] = p.Version
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/crawlab-team/crawlab-core/controllers"
+	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// PolicyService audits install requests rejected by policies of settings.
+type PolicyService struct {
+	parent *Service
+	api    *gin.Engine
+	col    *mongo2.Col // dependency policy audits
+}
+
+func (svc *PolicyService) Init() {
+	svc.api.GET("/policies/audits", svc.getAuditList)
+}
+
+func (svc *PolicyService) getAuditList(c *gin.Context) {
+	// params
+	pagination := controllers.MustGetPagination(c)
+	query := controllers.MustGetFilterQuery(c)
+
+	// list
+	var list []models.PolicyAudit
+	if err := svc.col.Find(query, &mongo2.FindOptions{
+		Sort:  bson.D{{"_id", -1}},
+		Skip:  pagination.Size * (pagination.Page - 1),
+		Limit: pagination.Size,
+	}).All(&list); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			controllers.HandleSuccessWithListData(c, nil, 0)
+		} else {
+			controllers.HandleErrorInternalServerError(c, err)
+		}
+		return
+	}
+
+	// total count
+	total, err := svc.col.Count(query)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithListData(c, list, total)
+}
+
+// _audit records the install request rejected by the policy of the setting.
+func (svc *PolicyService) _audit(s models.Setting, payload entity.InstallPayload, specifiers map[string]string, reason string) {
+	a := models.PolicyAudit{
+		Id:         primitive.NewObjectID(),
+		SettingId:  s.Id,
+		Type:       s.Key,
+		DepNames:   payload.Names,
+		Versions:   payload.Versions,
+		Specifiers: specifiers,
+		Mode:       payload.Mode,
+		NodeIds:    payload.NodeIds,
+		SpiderId:   payload.SpiderId,
+		Reason:     reason,
+		CreateTs:   time.Now(),
+	}
+	if _, err := svc.col.Insert(a); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+// policyViolationError is returned for install requests rejected by the
+// policy of the setting.
+type policyViolationError struct {
+	reason string
+}
+
+func (err *policyViolationError) Error() string {
+	return "rejected by dependency policy: " + err.reason
+}
+
+// handleInstallError responds with forbidden status for policy violations.
+func handleInstallError(c *gin.Context, err error) {
+	var violation *policyViolationError
+	if errors.As(err, &violation) {
+		controllers.HandleError(http.StatusForbidden, c, err)
+		return
+	}
+	controllers.HandleErrorInternalServerError(c, err)
+}
+
+func newPolicyViolationError(format string, a ...interface{}) error {
+	return &policyViolationError{reason: fmt.Sprintf(format, a...)}
+}
+
+// _checkPolicy checks dependencies of the payload against the policy of the
+// setting. Dependencies without exact versions are constrained to version
+// ranges of the policy by specifiers, which are returned with the ones of
+// the payload. Rejections are audited.
+func (svc *baseService) _checkPolicy(payload entity.InstallPayload, specifiers map[string]string) (res map[string]string, err error) {
+	res, err = svc._applyPolicy(payload, specifiers)
+	if err != nil {
+		var violation *policyViolationError
+		if errors.As(err, &violation) {
+			svc.parent.policySvc._audit(svc.s, payload, specifiers, violation.reason)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// _checkManifestPolicy checks dependencies in the manifest to install by
+// config against the policy of the setting. As installers resolve versions
+// from the manifest, dependencies constrained by version ranges of the policy
+// must have versions locked or pinned in the manifest, which are given by
+// name. Rejections are audited.
+func (svc *baseService) _checkManifestPolicy(payload entity.InstallPayload, names []string, versions map[string]string) (err error) {
+	// setting
+	if err := svc._getSetting(); err != nil {
+		return err
+	}
+
+	if err := svc._applyManifestPolicy(names, versions); err != nil {
+		payload.Names = names
+		payload.Versions = versions
+		svc.parent.policySvc._audit(svc.s, payload, nil, err.(*policyViolationError).reason)
+		return err
+	}
+	return nil
+}
+
+func (svc *baseService) _applyManifestPolicy(names []string, versions map[string]string) (err error) {
+	for _, name := range names {
+		// names
+		if err := svc._checkPolicyName(name); err != nil {
+			return err
+		}
+
+		// version ranges
+		for _, vr := range svc.s.Policy.VersionRanges {
+			if !svc._matchPolicyPattern(vr.Name, name) {
+				continue
+			}
+			v := versions[name]
+			if v == "" {
+				return newPolicyViolationError("%s must be locked or pinned to a version in range \"%s\"", name, vr.Range)
+			}
+			if err := svc._checkPolicyVersion(name, v, vr.Range); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (svc *baseService) _applyPolicy(payload entity.InstallPayload, specifiers map[string]string) (res map[string]string, err error) {
+	p := svc.s.Policy
+
+	// copy specifiers so that the ones of the payload are audited as is
+	res = map[string]string{}
+	for name, s := range specifiers {
+		res[name] = s
+	}
+
+	for _, name := range payload.Names {
+		// names
+		if err := svc._checkPolicyName(name); err != nil {
+			return nil, err
+		}
+
+		// version ranges
+		for _, vr := range p.VersionRanges {
+			if !svc._matchPolicyPattern(vr.Name, name) {
+				continue
+			}
+
+			// exact version
+			if v := payload.Versions[name]; v != "" {
+				if err := svc._checkPolicyVersion(name, v, vr.Range); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			// constrain by specifier
+			s, err := svc._constrainSpecifier(res[name], vr.Range)
+			if err != nil {
+				return nil, newPolicyViolationError("%s must be installed with an exact version in range \"%s\": %v", name, vr.Range, err)
+			}
+			res[name] = s
+		}
+	}
+
+	return res, nil
+}
+
+// _checkPolicyName checks the dependency name against allowed and blocked
+// name patterns of the policy.
+func (svc *baseService) _checkPolicyName(name string) (err error) {
+	p := svc.s.Policy
+
+	// blocked names
+	for _, pattern := range p.BlockedNames {
+		if svc._matchPolicyPattern(pattern, name) {
+			return newPolicyViolationError("%s is blocked by pattern \"%s\"", name, pattern)
+		}
+	}
+
+	// allowed names
+	if len(p.AllowedNames) == 0 {
+		return nil
+	}
+	for _, pattern := range p.AllowedNames {
+		if svc._matchPolicyPattern(pattern, name) {
+			return nil
+		}
+	}
+	return newPolicyViolationError("%s is not in allowed names", name)
+}
+
+// _checkPolicyVersion checks the exact version of the dependency against the
+// version range of the policy.
+func (svc *baseService) _checkPolicyVersion(name, version, r string) (err error) {
+	ok, err := svc._satisfiesRange(version, r)
+	if err != nil {
+		return newPolicyViolationError("version %s of %s cannot be checked against range \"%s\": %v", version, name, r, err)
+	}
+	if !ok {
+		return newPolicyViolationError("version %s of %s is not in range \"%s\"", version, name, r)
+	}
+	return nil
+}
+
+// _matchPolicyPattern returns whether the dependency name matches the name
+// pattern of the policy, both of which are normalized.
+func (svc *baseService) _matchPolicyPattern(pattern, name string) (ok bool) {
+	ok, _ = path.Match(svc._normalizeName(pattern), svc._normalizeName(name))
+	return ok
+}
+
+// _satisfiesRange returns whether the version is in the version range, which
+// is a specifier set for python and a semver constraint otherwise.
+func (svc *baseService) _satisfiesRange(version, r string) (ok bool, err error) {
+	if svc.key == constants.DependencyTypePython {
+		ss, err := parsePythonSpecifierSet(r)
+		if err != nil {
+			return false, err
+		}
+		v, err := parsePythonVersion(version)
+		if err != nil {
+			return false, err
+		}
+		return ss.check(v) == 0, nil
+	}
+
+	c, err := semver.NewConstraint(r)
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	return c.Check(v), nil
+}
+
+// _constrainSpecifier combines the version specifier with the version range,
+// so that installers resolve versions in the range. Only python and node
+// support version specifiers.
+func (svc *baseService) _constrainSpecifier(specifier, r string) (res string, err error) {
+	switch svc.key {
+	case constants.DependencyTypePython:
+		if specifier == "" {
+			return r, nil
+		}
+		return specifier + "," + r, nil
+	case constants.DependencyTypeNode:
+		if specifier == "" {
+			return r, nil
+		}
+		// intersection of ranges is ambiguous with alternatives
+		if strings.Contains(specifier, "||") || strings.Contains(r, "||") {
+			return "", errors.New("ranges with alternatives cannot be combined")
+		}
+		return specifier + " " + r, nil
+	default:
+		return "", errors.New(fmt.Sprintf("version specifiers are not supported for %s", svc.key))
+	}
+}
+
+// validatePolicy validates name patterns and version ranges of the policy
+// of the dependency type.
+func validatePolicy(key string, p models.Policy) (err error) {
+	for _, pattern := range append(append([]string{}, p.AllowedNames...), p.BlockedNames...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return errors.New(fmt.Sprintf("invalid policy name pattern: %s", pattern))
+		}
+	}
+	for _, vr := range p.VersionRanges {
+		if _, err := path.Match(vr.Name, ""); err != nil || vr.Name == "" {
+			return errors.New(fmt.Sprintf("invalid policy name pattern: %s", vr.Name))
+		}
+		if key == constants.DependencyTypePython {
+			_, err = parsePythonSpecifierSet(vr.Range)
+		} else {
+			_, err = semver.NewConstraint(vr.Range)
+		}
+		if err != nil || strings.TrimSpace(vr.Range) == "" {
+			return errors.New(fmt.Sprintf("invalid policy version range of %s: %s", vr.Name, vr.Range))
+		}
+	}
+	return nil
+}
+
+func NewPolicyService(parent *Service) (svc *PolicyService) {
+	svc = &PolicyService{
+		parent: parent,
+		api:    parent.GetApi(),
+		col:    mongo2.GetMongoCol(constants.DependencyPolicyAuditsColName),
+	}
+	return svc
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"testing"
+)
+
+func TestBaseService_ApplyManifestPolicy(t *testing.T) {
+	cases := []struct {
+		key      string
+		versions map[string]string
+		valid    bool
+	}{
+		{constants.DependencyTypePython, map[string]string{"requests": "2.31.0"}, true},
+		{constants.DependencyTypePython, map[string]string{"requests": "3.0.0"}, false},
+		{constants.DependencyTypePython, map[string]string{}, false},
+		{constants.DependencyTypePython, map[string]string{"requests": "2.31.0", "Blocked_Pkg": "1.0"}, false},
+		{constants.DependencyTypeNode, map[string]string{"requests": "2.1.0"}, true},
+		{constants.DependencyTypeNode, map[string]string{"requests": "1.0.0"}, false},
+	}
+	for _, c := range cases {
+		svc := &baseService{key: c.key}
+		svc.s.Policy = models.Policy{
+			BlockedNames: []string{"blocked-pkg"},
+			VersionRanges: []models.PolicyVersionRange{
+				{Name: "requests", Range: "<3"},
+				{Name: "requests", Range: ">=2"},
+			},
+		}
+		var names []string
+		for name := range c.versions {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			names = []string{"requests"}
+		}
+		err := svc._applyManifestPolicy(names, c.versions)
+		if c.valid && err != nil {
+			t.Errorf("%s %v: unexpected error: %v", c.key, c.versions, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s %v: expected policy violation", c.key, c.versions)
+		}
+	}
+}
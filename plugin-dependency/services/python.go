@@ -1,169 +1,53 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"github.com/PuerkitoBio/goquery"
-	"github.com/crawlab-team/crawlab-core/controllers"
+	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/crawlab-team/go-trace"
 	"github.com/crawlab-team/plugin-dependency/constants"
 	"github.com/crawlab-team/plugin-dependency/entity"
 	"github.com/crawlab-team/plugin-dependency/models"
 	"github.com/gin-gonic/gin"
-	"github.com/imroc/req"
-	"go.mongodb.org/mongo-driver/bson"
-	mongo2 "go.mongodb.org/mongo-driver/mongo"
-	"net/url"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path"
-	"strconv"
+	"path/filepath"
+	"regexp"
+	"runtime"
 	"strings"
-	"time"
+	"sync"
 )
 
 type PythonService struct {
 	*baseService
-}
-
-func (svc *PythonService) Init() {
-	svc.api.GET("/python", svc.getList)
-	svc.api.POST("/python/update", svc.update)
-	svc.api.POST("/python/install", svc.install)
-	svc.api.POST("/python/uninstall", svc.uninstall)
+	markerEnv sync.Map // environment markers keyed by python command
 }
 
 func (svc *PythonService) GetRepoList(c *gin.Context) {
-	// query
-	query := c.Query("query")
-	pagination := controllers.MustGetPagination(c)
-
-	// validate
-	if query == "" {
-		controllers.HandleErrorBadRequest(c, errors.New("empty query"))
-		return
-	}
-
-	// request session
-	reqSession := req.New()
-
-	// set timeout
-	reqSession.SetTimeout(15 * time.Second)
-
-	// user agent
-	ua := req.Header{"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.61 Safari/537.36"}
-
-	// request url
-	requestUrl := fmt.Sprintf("https://pypi.org/search?page=%d&q=%s", pagination.Page, url.QueryEscape(query))
+	svc._getRepoList(c)
+}
 
-	// perform request
-	res, err := reqSession.Get(requestUrl, ua)
-	if err != nil {
-		if res != nil {
-			_, _ = c.Writer.Write(res.Bytes())
-			_ = c.AbortWithError(res.Response().StatusCode, err)
-			return
+func (svc *PythonService) GetDependencies(params entity.UpdateParams) (deps []models.Dependency, err error) {
+	// pip command
+	pipCmd := params.Cmd
+	if params.Isolated {
+		envPath, err := svc._getEnvPath(params.SpiderId)
+		if err != nil {
+			return nil, err
 		}
-		controllers.HandleErrorInternalServerError(c, err)
-		return
-	}
 
-	// response bytes
-	data, err := res.ToBytes()
-	if err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
-	}
-	buf := bytes.NewBuffer(data)
-
-	// parse html
-	doc, err := goquery.NewDocumentFromReader(buf)
-	if err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
-	}
-
-	// dependencies
-	var deps []models.Dependency
-	var depNames []string
-	doc.Find(".left-layout__main > form ul > li").Each(func(i int, s *goquery.Selection) {
-		d := models.Dependency{
-			Name:          s.Find(".package-snippet__name").Text(),
-			LatestVersion: s.Find(".package-snippet__version").Text(),
+		// skip if environment is not created yet
+		if !utils.Exists(envPath) {
+			return deps, nil
 		}
-		deps = append(deps, d)
-		depNames = append(depNames, d.Name)
-	})
-
-	// total
-	totalStr := doc.Find(".left-layout__main .split-layout p > strong").Text()
-	totalStr = strings.ReplaceAll(totalStr, ",", "")
-	total, _ := strconv.Atoi(totalStr)
-
-	// empty results
-	if total == 0 {
-		controllers.HandleSuccess(c)
-		return
-	}
-
-	// dependencies in db
-	var depsResults []entity.DependencyResult
-	pipelines := mongo2.Pipeline{
-		{{
-			"$match",
-			bson.M{
-				"type": constants.DependencyTypePython,
-				"name": bson.M{
-					"$in": depNames,
-				},
-			},
-		}},
-		{{
-			"$group",
-			bson.M{
-				"_id": "$name",
-				"node_ids": bson.M{
-					"$push": "$node_id",
-				},
-				"versions": bson.M{
-					"$addToSet": "$version",
-				},
-			},
-		}},
-		{{
-			"$project",
-			bson.M{
-				"name":     "$_id",
-				"node_ids": "$node_ids",
-				"versions": "$versions",
-			},
-		}},
-	}
-	if err := svc.parent.colD.Aggregate(pipelines, nil).All(&depsResults); err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
-	}
-
-	// dependencies map
-	depsResultsMap := map[string]entity.DependencyResult{}
-	for _, dr := range depsResults {
-		depsResultsMap[dr.Name] = dr
-	}
 
-	// iterate dependencies
-	for i, d := range deps {
-		dr, ok := depsResultsMap[d.Name]
-		if ok {
-			deps[i].Result = dr
-		}
+		pipCmd = getPythonEnvBinPath(envPath, "pip")
 	}
 
-	controllers.HandleSuccessWithListData(c, deps, total)
-}
-
-func (svc *PythonService) GetDependencies(params entity.UpdateParams) (deps []models.Dependency, err error) {
-	cmd := exec.Command(params.Cmd, "list", "--format", "json")
+	cmd := exec.Command(pipCmd, "list", "--format", "json")
 	data, err := cmd.Output()
 	if err != nil {
 		return nil, err
@@ -183,6 +67,25 @@ func (svc *PythonService) GetDependencies(params entity.UpdateParams) (deps []mo
 }
 
 func (svc *PythonService) InstallDependencies(params entity.InstallParams) (err error) {
+	// pip command
+	pipCmd := params.Cmd
+	if params.Isolated {
+		pipCmd, err = svc._ensureEnv(params.TaskId, params.SpiderId, params.Cmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	// use other manifests than requirements.txt
+	if params.UseConfig {
+		switch params.Config {
+		case constants.DependencyConfigPyprojectToml:
+			return svc._installPyprojectToml(params, pipCmd)
+		case constants.DependencyConfigPipfile:
+			return svc._installPipfile(params, pipCmd)
+		}
+	}
+
 	// arguments
 	var args []string
 
@@ -216,30 +119,251 @@ func (svc *PythonService) InstallDependencies(params entity.InstallParams) (err
 
 		// dependency names
 		for _, depName := range params.Names {
+			// pinned version or version specifier
+			if v := params.Versions[depName]; v != "" {
+				depName = depName + "==" + v
+			} else if s := params.Specifiers[depName]; s != "" {
+				depName = depName + s
+			}
+
 			args = append(args, depName)
 		}
 	}
 
 	// command
-	cmd := exec.Command(params.Cmd, args...)
+	cmd := exec.Command(pipCmd, args...)
 
 	// logging
 	svc.parent._configureLogging(params.TaskId, cmd)
 
-	// start
-	if err := cmd.Start(); err != nil {
-		return trace.TraceError(err)
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// _installPyprojectToml installs dependencies in pyproject.toml, with Poetry
+// if the project is managed by Poetry, or otherwise with pip.
+func (svc *PythonService) _installPyprojectToml(params entity.InstallParams, pipCmd string) (err error) {
+	// workspace path
+	workspacePath, err := svc._getInstallWorkspacePath(params)
+	if err != nil {
+		return err
 	}
 
-	// wait
-	if err := cmd.Wait(); err != nil {
-		return trace.TraceError(err)
+	// pyproject.toml
+	reqs, isPoetry, err := parsePyprojectToml(path.Join(workspacePath, constants.DependencyConfigPyprojectToml))
+	if err != nil {
+		return err
+	}
+
+	// command
+	var cmd *exec.Cmd
+	if isPoetry {
+		// install into the current environment rather than a virtual
+		// environment managed by poetry
+		cmd = exec.Command(constants.DefaultPoetryCmd, "install", "--no-root", "--no-interaction")
+		cmd.Env = append(svc._getToolEnv(params, pipCmd), "POETRY_VIRTUALENVS_CREATE=false")
+	} else {
+		// skip if no dependencies
+		if len(reqs) == 0 {
+			return nil
+		}
+
+		// arguments
+		args := []string{"install"}
+		if params.Proxy != "" {
+			args = append(args, "-i", params.Proxy)
+		}
+		for _, r := range reqs {
+			args = append(args, r.Line)
+		}
+		cmd = exec.Command(pipCmd, args...)
+	}
+	cmd.Dir = workspacePath
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// _installPipfile installs dependencies in Pipfile with Pipenv. Locked
+// versions are installed if Pipfile.lock exists.
+func (svc *PythonService) _installPipfile(params entity.InstallParams, pipCmd string) (err error) {
+	// workspace path
+	workspacePath, err := svc._getInstallWorkspacePath(params)
+	if err != nil {
+		return err
+	}
+
+	// arguments
+	args := []string{"install", "--system"}
+	if utils.Exists(path.Join(workspacePath, constants.DependencyConfigPipfileLock)) {
+		args = append(args, "--deploy")
+	}
+
+	// command
+	cmd := exec.Command(constants.DefaultPipenvCmd, args...)
+	cmd.Dir = workspacePath
+	cmd.Env = svc._getToolEnv(params, pipCmd)
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
 	}
 
 	return nil
 }
 
+// _getToolEnv returns environment variables for Poetry and Pipenv, which
+// install dependencies with the python interpreter found in PATH. The
+// isolated environment is activated by putting it first in PATH.
+func (svc *PythonService) _getToolEnv(params entity.InstallParams, pipCmd string) (env []string) {
+	env = os.Environ()
+	if params.Proxy != "" {
+		env = append(env, "PIP_INDEX_URL="+params.Proxy)
+	}
+	if params.Isolated {
+		binPath := path.Dir(pipCmd)
+		env = append(env,
+			"VIRTUAL_ENV="+path.Dir(binPath),
+			"PATH="+binPath+string(os.PathListSeparator)+os.Getenv("PATH"),
+		)
+	}
+	return env
+}
+
+// DryRunInstallDependencies resolves dependencies to install with
+// "pip install --dry-run --report", which requires pip 22.2 or later.
+func (svc *PythonService) DryRunInstallDependencies(params entity.InstallParams) (deps []models.Dependency, err error) {
+	// report file
+	f, err := ioutil.TempFile("", "pip-report-*.json")
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	reportPath := f.Name()
+	_ = f.Close()
+	defer os.Remove(reportPath)
+
+	// arguments
+	args := []string{"install", "--dry-run", "--report", reportPath}
+
+	// pip command
+	pipCmd := params.Cmd
+	if params.Isolated {
+		envPath, err := svc._getEnvPath(params.SpiderId)
+		if err != nil {
+			return nil, err
+		}
+		envPipCmd := getPythonEnvBinPath(envPath, "pip")
+		if utils.Exists(envPipCmd) {
+			pipCmd = envPipCmd
+		} else {
+			// resolve as if nothing is installed if environment is not
+			// created yet
+			args = append(args, "--ignore-installed")
+		}
+	}
+
+	// proxy
+	if params.Proxy != "" {
+		args = append(args, "-i", params.Proxy)
+	}
+
+	// dependencies
+	var workspacePath string
+	if params.UseConfig {
+		workspacePath, err = svc._getInstallWorkspacePath(params)
+		if err != nil {
+			return nil, err
+		}
+		switch params.Config {
+		case constants.DependencyConfigPyprojectToml:
+			reqs, isPoetry, err := parsePyprojectToml(path.Join(workspacePath, constants.DependencyConfigPyprojectToml))
+			if err != nil {
+				return nil, err
+			}
+			if isPoetry {
+				return nil, errors.New("dry run is not supported for poetry projects")
+			}
+			for _, r := range reqs {
+				args = append(args, r.Line)
+			}
+		case constants.DependencyConfigPipfile:
+			return nil, errors.New("dry run is not supported for pipfile")
+		default:
+			args = append(args, "-r", path.Join(workspacePath, constants.DependencyConfigRequirementsTxt))
+		}
+	} else {
+		if params.Upgrade {
+			args = append(args, "-U")
+		}
+		for _, depName := range params.Names {
+			if v := params.Versions[depName]; v != "" {
+				depName = depName + "==" + v
+			} else if s := params.Specifiers[depName]; s != "" {
+				depName = depName + s
+			}
+			args = append(args, depName)
+		}
+	}
+
+	// command
+	cmd := exec.Command(pipCmd, args...)
+	if workspacePath != "" {
+		cmd.Dir = workspacePath
+	}
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return nil, err
+	}
+
+	// report
+	data, err := ioutil.ReadFile(reportPath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	var report entity.PipInstallReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	for _, item := range report.Install {
+		deps = append(deps, models.Dependency{
+			Type:    constants.DependencyTypePython,
+			Name:    item.Metadata.Name,
+			Version: item.Metadata.Version,
+		})
+	}
+
+	return deps, nil
+}
+
 func (svc *PythonService) UninstallDependencies(params entity.UninstallParams) (err error) {
+	// pip command
+	pipCmd := params.Cmd
+	if params.Isolated {
+		envPath, err := svc._getEnvPath(params.SpiderId)
+		if err != nil {
+			return err
+		}
+		pipCmd = getPythonEnvBinPath(envPath, "pip")
+	}
+
 	// arguments
 	var args []string
 
@@ -253,61 +377,261 @@ func (svc *PythonService) UninstallDependencies(params entity.UninstallParams) (
 	}
 
 	// command
-	cmd := exec.Command(params.Cmd, args...)
+	cmd := exec.Command(pipCmd, args...)
 
 	// logging
 	svc.parent._configureLogging(params.TaskId, cmd)
 
-	// start
-	if err := cmd.Start(); err != nil {
-		return trace.TraceError(err)
-	}
-
-	// wait
-	if err := cmd.Wait(); err != nil {
-		return trace.TraceError(err)
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
 	}
 
 	return nil
 }
 
 func (svc *PythonService) GetLatestVersion(dep models.Dependency) (v string, err error) {
-	// not exists in cache, request from pypi
-	reqSession := req.New()
+	// registry
+	reg, err := svc._getRegistry()
+	if err != nil {
+		return "", err
+	}
 
-	// set timeout
-	reqSession.SetTimeout(60 * time.Second)
+	return reg.GetLatestVersion(dep.Name)
+}
 
-	// user agent
-	ua := req.Header{"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.61 Safari/537.36"}
+// GetEnvInfo returns the python environment used by tasks of the spider.
+func (svc *PythonService) GetEnvInfo(spiderId primitive.ObjectID) (info entity.EnvInfo, err error) {
+	// setting
+	if err := svc._getSetting(); err != nil {
+		return info, err
+	}
 
-	// request url
-	requestUrl := fmt.Sprintf("https://pypi.org/project/%s/", dep.Name)
+	// global environment
+	if !svc._isIsolated(spiderId) {
+		return info, nil
+	}
 
-	// perform request
-	res, err := reqSession.Get(requestUrl, ua)
+	// isolated environment
+	envPath, err := svc._getEnvPath(spiderId)
 	if err != nil {
-		return "", trace.TraceError(err)
+		return info, err
 	}
+	info.Isolated = true
+	info.Path = envPath
+	info.Interpreter = getPythonEnvBinPath(envPath, "python")
+	info.BinPath = path.Dir(info.Interpreter)
 
-	// response bytes
-	data, err := res.ToBytes()
+	return info, nil
+}
+
+// _ensureEnv creates the virtual environment of the spider with the python
+// interpreter of the configured pip command if it does not exist, and
+// returns the pip command of the environment.
+func (svc *PythonService) _ensureEnv(taskId, spiderId primitive.ObjectID, configuredPipCmd string) (pipCmd string, err error) {
+	// environment path
+	envPath, err := svc._getEnvPath(spiderId)
 	if err != nil {
-		return "", trace.TraceError(err)
+		return "", err
+	}
+
+	// pip command
+	pipCmd = getPythonEnvBinPath(envPath, "pip")
+
+	// reuse existing environment
+	if utils.Exists(pipCmd) {
+		return pipCmd, nil
+	}
+
+	// create environment
+	cmd := exec.Command(getPythonCmd(configuredPipCmd), "-m", "venv", envPath)
+
+	// logging
+	svc.parent._configureLogging(taskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(taskId, cmd); err != nil {
+		return "", err
 	}
-	buf := bytes.NewBuffer(data)
 
-	// parse html
-	doc, err := goquery.NewDocumentFromReader(buf)
+	return pipCmd, nil
+}
+
+var pipCmdRegex = regexp.MustCompile(`^pip(\d+(?:\.\d+)?)?(\.exe)?$`)
+
+// getPythonCmd returns the python interpreter of the pip command, e.g.
+// python3.9 for pip3.9 or /opt/py/bin/python3 for /opt/py/bin/pip. The
+// default python command is returned if it cannot be derived.
+func getPythonCmd(pipCmd string) (pythonCmd string) {
+	dir, base := filepath.Split(pipCmd)
+	matches := pipCmdRegex.FindStringSubmatch(base)
+	if matches == nil {
+		return constants.DefaultPythonCmd
+	}
+
+	// python of pip without version may be python 2 or missing
+	names := []string{"python" + matches[1] + matches[2]}
+	if matches[1] == "" {
+		names = []string{"python3" + matches[2], "python" + matches[2]}
+	}
+
+	for _, name := range names {
+		if p, err := exec.LookPath(dir + name); err == nil {
+			return p
+		}
+	}
+	return constants.DefaultPythonCmd
+}
+
+// getPythonEnvBinPath returns the path of an executable in a virtual
+// environment.
+func getPythonEnvBinPath(envPath, name string) string {
+	if runtime.GOOS == "windows" {
+		return path.Join(envPath, "Scripts", name+".exe")
+	}
+	return path.Join(envPath, "bin", name)
+}
+
+// GetManifests returns python dependency manifests in the order of
+// precedence.
+func (svc *PythonService) GetManifests() (manifests []string) {
+	return []string{
+		constants.DependencyConfigRequirementsTxt,
+		constants.DependencyConfigPyprojectToml,
+		constants.DependencyConfigPipfile,
+	}
+}
+
+// GetManifestDependencies returns python dependencies of the manifest with
+// installed versions compared to the version specifiers, or to the locked
+// versions if any.
+func (svc *PythonService) GetManifestDependencies(spiderId primitive.ObjectID, workspacePath, manifest string) (deps []models.Dependency, err error) {
+	// manifest
+	m, err := readPythonManifest(workspacePath, manifest, svc._getMarkerEnv())
 	if err != nil {
-		return "", trace.TraceError(err)
+		return nil, err
+	}
+
+	// requirements merged by normalized name
+	keys, specsMap := m.getSpecifiers()
+	depsMap := map[string]bool{}
+	for _, r := range m.Requirements {
+		key := normalizePythonName(r.Name)
+		if depsMap[key] {
+			continue
+		}
+		depsMap[key] = true
+		d := models.Dependency{
+			Name:    r.Name,
+			Version: r.Specifier.String(),
+		}
+
+		// show exact version without operator
+		if r.RawSpecifier != "" {
+			d.Version = r.RawSpecifier
+		} else if len(r.Specifier) == 1 && r.Specifier[0].op == "==" && !r.Specifier[0].wildcard {
+			d.Version = r.Specifier[0].version
+		}
+
+		// direct reference
+		if r.Url != "" && d.Version == "" {
+			d.Version = r.Url
+		}
+
+		deps = append(deps, d)
 	}
 
-	// latest version
-	v = doc.Find(".release-timeline .release--current .release__version").Text()
-	v = strings.TrimSpace(v)
+	// dependencies in db, which are matched by normalized names as pip may
+	// report names in different case or with different separators
+	depsResultsMap, err := svc._getDependencyResultsMap(spiderId, nil)
+	if err != nil {
+		return nil, err
+	}
+	normalizedDepsResultsMap := map[string]entity.DependencyResult{}
+	for name, dr := range depsResultsMap {
+		normalizedDepsResultsMap[normalizePythonName(name)] = dr
+	}
 
-	return v, nil
+	// iterate dependencies
+	for i, key := range keys {
+		// dependency result
+		dr, ok := normalizedDepsResultsMap[key]
+		if !ok {
+			continue
+		}
+		deps[i].Result = dr
+
+		// iterate installed versions
+		for _, v := range dr.Versions {
+			// installed version
+			iv, err := parsePythonVersion(v)
+			if err != nil {
+				continue
+			}
+
+			// compare with the required version
+			res := specsMap[key].check(iv)
+			if res < 0 {
+				deps[i].Result.Upgradable = true
+			} else if res > 0 {
+				deps[i].Result.Downgradable = true
+			}
+		}
+	}
+
+	return deps, nil
+}
+
+// GetManifestVersions returns versions pinned in the manifest or locked in
+// its lock file, while dependencies with version ranges only are resolved by
+// pip.
+func (svc *PythonService) GetManifestVersions(workspacePath, manifest string, deps []models.Dependency) (versions map[string]string, err error) {
+	m, err := readPythonManifest(workspacePath, manifest, svc._getMarkerEnv())
+	if err != nil {
+		return nil, err
+	}
+	versions = map[string]string{}
+	pinnedVersions := m.getPinnedVersions()
+	for _, d := range deps {
+		if v, ok := pinnedVersions[normalizePythonName(d.Name)]; ok {
+			versions[d.Name] = v
+		}
+	}
+	return versions, nil
+}
+
+// GetManifestNotes notes that environment markers of requirements in the
+// manifest are evaluated on the master node, as the python of other nodes
+// may differ, e.g. in python_version or sys_platform.
+func (svc *PythonService) GetManifestNotes(workspacePath, manifest string) (notes []string, err error) {
+	m, err := readPythonManifest(workspacePath, manifest, svc._getMarkerEnv())
+	if err != nil {
+		return nil, err
+	}
+	if m.MarkersEvaluated {
+		notes = append(notes, constants.ManifestNoteMarkersEvaluatedOnMaster)
+	}
+	return notes, nil
+}
+
+// _getMarkerEnv returns environment markers of the python interpreter
+// of the configured pip command, or nil if python is not available, in which
+// case markers of requirements are not evaluated.
+func (svc *PythonService) _getMarkerEnv() (env map[string]string) {
+	pythonCmd := constants.DefaultPythonCmd
+	if err := svc._getSetting(); err == nil {
+		pythonCmd = getPythonCmd(svc._getCmd())
+	}
+	if res, ok := svc.markerEnv.Load(pythonCmd); ok {
+		return res.(map[string]string)
+	}
+	env, err := getPythonMarkerEnv(pythonCmd)
+	if err != nil {
+		trace.PrintError(err)
+		return nil
+	}
+	svc.markerEnv.Store(pythonCmd, env)
+	return env
 }
 
 func NewPythonService(parent *Service) (svc *PythonService) {
@@ -323,6 +647,7 @@ func NewPythonService(parent *Service) (svc *PythonService) {
 			Uninstall: constants.MessageCodePythonUninstall,
 		},
 	)
+	baseSvc.defaultRegistryType = constants.RegistryTypePypi
 	svc.baseService = baseSvc
 	return svc
 }
@@ -0,0 +1,436 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/utils"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/pelletier/go-toml"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// parsePyprojectToml parses dependencies declared in pyproject.toml, either
+// in the [tool.poetry] table or in the [project] table as per PEP 621.
+// isPoetry is true if the project is managed by Poetry.
+func parsePyprojectToml(filePath string) (reqs []*pythonRequirement, isPoetry bool, err error) {
+	// file content
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, false, trace.TraceError(err)
+	}
+
+	// pyproject.toml
+	var p entity.PyprojectToml
+	if err := toml.Unmarshal(data, &p); err != nil {
+		return nil, false, trace.TraceError(errors.New(fmt.Sprintf("invalid %s: %v", filepath.Base(filePath), err)))
+	}
+
+	// poetry
+	if p.Tool.Poetry != nil {
+		// main and dev dependencies
+		tables := []map[string]interface{}{
+			p.Tool.Poetry.Dependencies,
+			p.Tool.Poetry.DevDependencies,
+		}
+
+		// dependency groups
+		var groupNames []string
+		for name := range p.Tool.Poetry.Group {
+			groupNames = append(groupNames, name)
+		}
+		sort.Strings(groupNames)
+		for _, name := range groupNames {
+			tables = append(tables, p.Tool.Poetry.Group[name].Dependencies)
+		}
+
+		for _, table := range tables {
+			for _, name := range getSortedKeys(table) {
+				// python version is not a dependency
+				if strings.EqualFold(name, "python") {
+					continue
+				}
+				r, err := parsePoetryDependency(name, table[name])
+				if err != nil {
+					return nil, false, trace.TraceError(errors.New(fmt.Sprintf("invalid constraint of %s in %s: %v", name, filepath.Base(filePath), err)))
+				}
+				reqs = append(reqs, r)
+			}
+		}
+		return reqs, true, nil
+	}
+
+	// pep 621
+	specs := p.Project.Dependencies
+	var extraNames []string
+	for name := range p.Project.OptionalDependencies {
+		extraNames = append(extraNames, name)
+	}
+	sort.Strings(extraNames)
+	for _, name := range extraNames {
+		specs = append(specs, p.Project.OptionalDependencies[name]...)
+	}
+	for _, s := range specs {
+		r, err := parsePythonRequirement(s)
+		if err != nil {
+			return nil, false, trace.TraceError(errors.New(fmt.Sprintf("invalid requirement in %s: %s", filepath.Base(filePath), s)))
+		}
+		reqs = append(reqs, r)
+	}
+	return reqs, false, nil
+}
+
+// parsePoetryDependency parses a dependency in [tool.poetry.dependencies],
+// which is either a version constraint or a table with version, git, path
+// or url keys. An error is returned if the constraint cannot be converted to
+// version specifiers, e.g. alternative constraints.
+func parsePoetryDependency(name string, value interface{}) (r *pythonRequirement, err error) {
+	r = &pythonRequirement{Name: name}
+
+	var constraint string
+	switch v := value.(type) {
+	case string:
+		constraint = v
+	case map[string]interface{}:
+		constraint, _ = v["version"].(string)
+		for _, key := range []string{"git", "path", "url"} {
+			if u, ok := v[key].(string); ok {
+				r.Url = u
+			}
+		}
+		r.Markers, _ = v["markers"].(string)
+		if extras, ok := v["extras"].([]interface{}); ok {
+			for _, e := range extras {
+				if s, ok := e.(string); ok {
+					r.Extras = append(r.Extras, s)
+				}
+			}
+		}
+	}
+
+	r.RawSpecifier = constraint
+	r.Specifier, err = convertPoetryConstraint(constraint)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// poetryOperatorSpaceRegex matches spaces between operators and versions of
+// constraints, e.g. ">= 1.2".
+var poetryOperatorSpaceRegex = regexp.MustCompile(`(\^|~=|~|===|==|!=|<=|>=|<|>|=)\s+`)
+
+// convertPoetryConstraint converts a Poetry version constraint such as
+// "^1.2" or "~1.2.3" to version specifiers as per PEP 440.
+func convertPoetryConstraint(constraint string) (ss pythonSpecifierSet, err error) {
+	constraint = strings.TrimSpace(constraint)
+	if constraint == "" || constraint == "*" {
+		return nil, nil
+	}
+	if strings.Contains(constraint, "||") {
+		// alternative constraints are not expressible as version specifiers
+		return nil, errors.New(fmt.Sprintf("unsupported constraint: %s", constraint))
+	}
+
+	// clauses are separated by commas or spaces, e.g. ">=1.2, <2.0" or
+	// ">= 1.2 < 2.0"
+	constraint = poetryOperatorSpaceRegex.ReplaceAllString(constraint, "$1")
+	clauses := strings.FieldsFunc(constraint, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	var parts []string
+	for _, clause := range clauses {
+		switch {
+		case strings.HasPrefix(clause, "^"):
+			// caret requirement allows updates that do not modify the
+			// left-most non-zero segment
+			v, err := parsePythonVersion(clause[1:])
+			if err != nil {
+				return nil, err
+			}
+			idx := len(v.release) - 1
+			for i, n := range v.release {
+				if n != 0 {
+					idx = i
+					break
+				}
+			}
+			parts = append(parts, ">="+clause[1:], "<"+getPythonUpperBound(v.release, idx))
+		case strings.HasPrefix(clause, "~") && !strings.HasPrefix(clause, "~="):
+			// tilde requirement allows patch updates, or minor updates if
+			// only a major version is given
+			v, err := parsePythonVersion(clause[1:])
+			if err != nil {
+				return nil, err
+			}
+			idx := 0
+			if len(v.release) > 1 {
+				idx = 1
+			}
+			parts = append(parts, ">="+clause[1:], "<"+getPythonUpperBound(v.release, idx))
+		case strings.HasPrefix(clause, "=") && !strings.HasPrefix(clause, "=="):
+			parts = append(parts, "="+clause)
+		case len(clause) > 0 && clause[0] >= '0' && clause[0] <= '9':
+			// exact version or wildcard
+			parts = append(parts, "=="+clause)
+		default:
+			parts = append(parts, clause)
+		}
+	}
+
+	return parsePythonSpecifierSet(strings.Join(parts, ","))
+}
+
+// getPythonUpperBound returns the release segments up to idx with the last
+// one incremented, e.g. 1.3 for 1.2.3 at index 1.
+func getPythonUpperBound(release []int, idx int) string {
+	var parts []string
+	for i := 0; i <= idx; i++ {
+		n := release[i]
+		if i == idx {
+			n++
+		}
+		parts = append(parts, strconv.Itoa(n))
+	}
+	return strings.Join(parts, ".")
+}
+
+// parsePipfile parses dependencies declared in [packages] and
+// [dev-packages] of Pipfile.
+func parsePipfile(filePath string) (reqs []*pythonRequirement, err error) {
+	// file content
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// Pipfile
+	var p entity.Pipfile
+	if err := toml.Unmarshal(data, &p); err != nil {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid %s: %v", filepath.Base(filePath), err)))
+	}
+
+	for _, table := range []map[string]interface{}{p.Packages, p.DevPackages} {
+		for _, name := range getSortedKeys(table) {
+			r := &pythonRequirement{Name: name}
+
+			var spec string
+			switch v := table[name].(type) {
+			case string:
+				spec = v
+			case map[string]interface{}:
+				spec, _ = v["version"].(string)
+				for _, key := range []string{"git", "path", "file"} {
+					if u, ok := v[key].(string); ok {
+						r.Url = u
+					}
+				}
+				r.Markers, _ = v["markers"].(string)
+			}
+
+			// version specifiers as per PEP 440
+			if spec != "*" {
+				r.Specifier, err = parsePythonSpecifierSet(spec)
+				if err != nil {
+					return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid requirement in %s: %s = %s", filepath.Base(filePath), name, spec)))
+				}
+			}
+
+			reqs = append(reqs, r)
+		}
+	}
+
+	return reqs, nil
+}
+
+// parsePoetryLock returns versions locked in poetry.lock keyed by
+// normalized name.
+func parsePoetryLock(filePath string) (versions map[string]string, err error) {
+	// file content
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// poetry.lock
+	var lock entity.PoetryLock
+	if err := toml.Unmarshal(data, &lock); err != nil {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid %s: %v", filepath.Base(filePath), err)))
+	}
+
+	versions = map[string]string{}
+	for _, p := range lock.Package {
+		versions[normalizePythonName(p.Name)] = p.Version
+	}
+	return versions, nil
+}
+
+// parsePipfileLock returns versions locked in Pipfile.lock keyed by
+// normalized name.
+func parsePipfileLock(filePath string) (versions map[string]string, err error) {
+	// file content
+	data, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// Pipfile.lock
+	var lock entity.PipfileLock
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid %s: %v", filepath.Base(filePath), err)))
+	}
+
+	versions = map[string]string{}
+	for _, m := range []map[string]entity.PipfileLockPackage{lock.Develop, lock.Default} {
+		for name, p := range m {
+			if p.Version == "" {
+				continue
+			}
+			versions[normalizePythonName(name)] = strings.TrimPrefix(p.Version, "==")
+		}
+	}
+	return versions, nil
+}
+
+// pythonManifest is a manifest of python dependencies with its lock file.
+type pythonManifest struct {
+	Requirements []*pythonRequirement
+
+	// version specifiers of constraints files keyed by normalized name
+	Constraints map[string]pythonSpecifierSet
+
+	// versions locked in the lock file keyed by normalized name
+	LockedVersions map[string]string
+
+	// whether requirements are skipped or kept by evaluating their markers
+	MarkersEvaluated bool
+}
+
+// readPythonManifest reads the python dependency manifest of the workspace,
+// i.e. requirements.txt, pyproject.toml or Pipfile, and its lock file if any.
+// Requirements with markers not satisfied by the environment markers are
+// skipped, unless env is nil.
+func readPythonManifest(workspacePath, config string, env map[string]string) (m *pythonManifest, err error) {
+	m = &pythonManifest{}
+	switch config {
+	case constants.DependencyConfigRequirementsTxt:
+		f, err := parsePythonRequirementsFile(workspacePath, path.Join(workspacePath, config))
+		if err != nil {
+			return nil, err
+		}
+		m.Requirements = f.Requirements
+		m.Constraints = f.Constraints
+	case constants.DependencyConfigPyprojectToml:
+		reqs, isPoetry, err := parsePyprojectToml(path.Join(workspacePath, config))
+		if err != nil {
+			return nil, err
+		}
+		m.Requirements = reqs
+		lockPath := path.Join(workspacePath, constants.DependencyConfigPoetryLock)
+		if isPoetry && utils.Exists(lockPath) {
+			m.LockedVersions, err = parsePoetryLock(lockPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	case constants.DependencyConfigPipfile:
+		reqs, err := parsePipfile(path.Join(workspacePath, config))
+		if err != nil {
+			return nil, err
+		}
+		m.Requirements = reqs
+		lockPath := path.Join(workspacePath, constants.DependencyConfigPipfileLock)
+		if utils.Exists(lockPath) {
+			m.LockedVersions, err = parsePipfileLock(lockPath)
+			if err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid python dependency manifest: %s", config)))
+	}
+
+	// requirements of other environments
+	if env != nil {
+		var reqs []*pythonRequirement
+		for _, r := range m.Requirements {
+			if r.Markers != "" {
+				m.MarkersEvaluated = true
+			}
+			ok, err := evaluatePythonMarkers(r.Markers, env)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				reqs = append(reqs, r)
+			}
+		}
+		m.Requirements = reqs
+	}
+
+	return m, nil
+}
+
+// getSpecifiers returns version specifiers of requirements merged with the
+// constraints, keyed by normalized names in order of the requirements.
+// Locked versions take precedence over version specifiers.
+func (m *pythonManifest) getSpecifiers() (keys []string, specsMap map[string]pythonSpecifierSet) {
+	specsMap = map[string]pythonSpecifierSet{}
+	for _, r := range m.Requirements {
+		key := normalizePythonName(r.Name)
+		if _, ok := specsMap[key]; !ok {
+			keys = append(keys, key)
+		}
+		specsMap[key] = append(specsMap[key], r.Specifier...)
+	}
+
+	// constraints
+	for key, specs := range m.Constraints {
+		if _, ok := specsMap[key]; ok {
+			specsMap[key] = append(specsMap[key], specs...)
+		}
+	}
+
+	// locked versions
+	for key, v := range m.LockedVersions {
+		if _, ok := specsMap[key]; ok {
+			specsMap[key] = pythonSpecifierSet{{op: "==", version: v}}
+		}
+	}
+
+	return keys, specsMap
+}
+
+// getPinnedVersions returns versions of requirements that are locked or
+// pinned by exact version specifiers, keyed by normalized name.
+func (m *pythonManifest) getPinnedVersions() (versions map[string]string) {
+	versions = map[string]string{}
+	_, specsMap := m.getSpecifiers()
+	for key, ss := range specsMap {
+		for _, s := range ss {
+			if (s.op == "==" || s.op == "===") && !s.wildcard {
+				versions[key] = s.version
+				break
+			}
+		}
+	}
+	return versions
+}
+
+func getSortedKeys(m map[string]interface{}) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestConvertPoetryConstraint(t *testing.T) {
+	cases := []struct {
+		constraint string
+		expected   string
+		valid      bool
+	}{
+		{"", "", true},
+		{"*", "", true},
+		{"^1.2.3", ">=1.2.3,<2", true},
+		{"^0.2.3", ">=0.2.3,<0.3", true},
+		{"^0.0.3", ">=0.0.3,<0.0.4", true},
+		{"~1.2.3", ">=1.2.3,<1.3", true},
+		{"~1", ">=1,<2", true},
+		{"1.2.*", "==1.2.*", true},
+		{"1.2.3", "==1.2.3", true},
+		{"=1.2.3", "==1.2.3", true},
+		{">=1.2,<2.0", ">=1.2,<2.0", true},
+		{">=1.2 <2.0", ">=1.2,<2.0", true},
+		{">= 1.2, < 2.0", ">=1.2,<2.0", true},
+		{"^1.2  !=1.4.0", ">=1.2,<2,!=1.4.0", true},
+		{"^1.2 || ^2.0", "", false},
+		{"^latest", "", false},
+	}
+	for _, c := range cases {
+		ss, err := convertPoetryConstraint(c.constraint)
+		if !c.valid {
+			if err == nil {
+				t.Errorf("%s: expected error", c.constraint)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.constraint, err)
+			continue
+		}
+		if ss.String() != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.constraint, c.expected, ss.String())
+		}
+	}
+}
+
+func writePythonManifestFiles(t *testing.T, files map[string]string) (dirPath string) {
+	dirPath = t.TempDir()
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dirPath, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dirPath
+}
+
+func getPythonRequirementSpecs(reqs []*pythonRequirement) (specs []string) {
+	for _, r := range reqs {
+		specs = append(specs, r.Name+r.Specifier.String())
+	}
+	return specs
+}
+
+func TestParsePyprojectToml(t *testing.T) {
+	// poetry
+	dirPath := writePythonManifestFiles(t, map[string]string{
+		constants.DependencyConfigPyprojectToml: `
+[tool.poetry.dependencies]
+python = "^3.8"
+requests = "^2.31"
+pywin32 = { version = "306", markers = "sys_platform == 'win32'" }
+mylib = { git = "https://github.com/org/mylib.git" }
+
+[tool.poetry.group.test.dependencies]
+pytest = "~7.4"
+`,
+	})
+	reqs, isPoetry, err := parsePyprojectToml(filepath.Join(dirPath, constants.DependencyConfigPyprojectToml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isPoetry {
+		t.Error("expected poetry project")
+	}
+	expected := []string{"mylib", "pywin32==306", "requests>=2.31,<3", "pytest>=7.4,<7.5"}
+	if specs := getPythonRequirementSpecs(reqs); !reflect.DeepEqual(specs, expected) {
+		t.Errorf("expected %v, got %v", expected, specs)
+	}
+	if reqs[0].Url != "https://github.com/org/mylib.git" || reqs[1].Markers != "sys_platform == 'win32'" {
+		t.Errorf("unexpected url or markers: %+v, %+v", reqs[0], reqs[1])
+	}
+
+	// unconvertible constraint
+	dirPath = writePythonManifestFiles(t, map[string]string{
+		constants.DependencyConfigPyprojectToml: `
+[tool.poetry.dependencies]
+requests = "^1.2 || ^2.0"
+`,
+	})
+	if _, _, err := parsePyprojectToml(filepath.Join(dirPath, constants.DependencyConfigPyprojectToml)); err == nil {
+		t.Error("expected error of unconvertible constraint")
+	}
+
+	// pep 621
+	dirPath = writePythonManifestFiles(t, map[string]string{
+		constants.DependencyConfigPyprojectToml: `
+[project]
+dependencies = ["requests>=2.0", "numpy==1.26.0"]
+
+[project.optional-dependencies]
+test = ["pytest"]
+`,
+	})
+	reqs, isPoetry, err = parsePyprojectToml(filepath.Join(dirPath, constants.DependencyConfigPyprojectToml))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if isPoetry {
+		t.Error("expected pep 621 project")
+	}
+	expected = []string{"requests>=2.0", "numpy==1.26.0", "pytest"}
+	if specs := getPythonRequirementSpecs(reqs); !reflect.DeepEqual(specs, expected) {
+		t.Errorf("expected %v, got %v", expected, specs)
+	}
+}
+
+func TestParsePipfile(t *testing.T) {
+	dirPath := writePythonManifestFiles(t, map[string]string{
+		constants.DependencyConfigPipfile: `
+[packages]
+requests = "*"
+flask = ">=2.0,<3"
+pywin32 = { version = "==306", markers = "sys_platform == 'win32'" }
+
+[dev-packages]
+pytest = "==7.4.0"
+`,
+	})
+	reqs, err := parsePipfile(filepath.Join(dirPath, constants.DependencyConfigPipfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"flask>=2.0,<3", "pywin32==306", "requests", "pytest==7.4.0"}
+	if specs := getPythonRequirementSpecs(reqs); !reflect.DeepEqual(specs, expected) {
+		t.Errorf("expected %v, got %v", expected, specs)
+	}
+}
+
+func TestReadPythonManifest(t *testing.T) {
+	dirPath := writePythonManifestFiles(t, map[string]string{
+		constants.DependencyConfigPipfile: `
+[packages]
+Flask = ">=2.0"
+requests = "==2.31.0"
+pywin32 = { version = "==306", markers = "sys_platform == 'win32'" }
+`,
+		constants.DependencyConfigPipfileLock: `{
+  "default": {
+    "flask": {"version": "==3.0.0"},
+    "pywin32": {"version": "==306"}
+  },
+  "develop": {}
+}`,
+	})
+
+	// markers are not evaluated without environment
+	m, err := readPythonManifest(dirPath, constants.DependencyConfigPipfile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Requirements) != 3 || m.MarkersEvaluated {
+		t.Errorf("expected 3 requirements without evaluated markers, got %d", len(m.Requirements))
+	}
+
+	// requirements of other platforms are skipped
+	m, err = readPythonManifest(dirPath, constants.DependencyConfigPipfile, map[string]string{"sys_platform": "linux"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"flask":    "3.0.0",
+		"requests": "2.31.0",
+	}
+	if versions := m.getPinnedVersions(); !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected pinned versions %v, got %v", expected, versions)
+	}
+	if !m.MarkersEvaluated {
+		t.Error("expected markers to be evaluated")
+	}
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// pythonMarkerEnvScript prints environment markers of the python interpreter
+// as per PEP 508.
+const pythonMarkerEnvScript = `import json, os, platform, sys
+print(json.dumps({
+    "implementation_name": sys.implementation.name,
+    "implementation_version": ".".join(str(n) for n in sys.implementation.version[:3]),
+    "os_name": os.name,
+    "platform_machine": platform.machine(),
+    "platform_python_implementation": platform.python_implementation(),
+    "platform_release": platform.release(),
+    "platform_system": platform.system(),
+    "platform_version": platform.version(),
+    "python_full_version": platform.python_version(),
+    "python_version": ".".join(platform.python_version_tuple()[:2]),
+    "sys_platform": sys.platform,
+}))`
+
+// getPythonMarkerEnv returns environment markers of the python interpreter,
+// against which markers of requirements are evaluated.
+func getPythonMarkerEnv(pythonCmd string) (env map[string]string, err error) {
+	output, err := exec.Command(pythonCmd, "-c", pythonMarkerEnvScript).Output()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := json.Unmarshal(output, &env); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return env, nil
+}
+
+var pythonMarkerTokenRegex = regexp.MustCompile(`^\s*("[^"]*"|'[^']*'|===|==|!=|<=|>=|~=|<|>|\(|\)|[A-Za-z_][A-Za-z0-9_.]*)`)
+
+// pythonMarkerParser evaluates environment markers of a requirement as per
+// PEP 508, e.g. `python_version < "3.8" and sys_platform == "linux"`.
+type pythonMarkerParser struct {
+	markers string
+	tokens  []string
+	pos     int
+	env     map[string]string
+}
+
+// evaluatePythonMarkers returns whether the markers are satisfied by the
+// environment. Empty markers are always satisfied, while markers of extras
+// are only satisfied by the "extra" variable of the environment.
+func evaluatePythonMarkers(markers string, env map[string]string) (ok bool, err error) {
+	if strings.TrimSpace(markers) == "" {
+		return true, nil
+	}
+	p := &pythonMarkerParser{markers: markers, env: env}
+
+	// tokens
+	rest := markers
+	for strings.TrimSpace(rest) != "" {
+		m := pythonMarkerTokenRegex.FindStringSubmatch(rest)
+		if m == nil {
+			return false, p.error()
+		}
+		p.tokens = append(p.tokens, m[1])
+		rest = rest[len(m[0]):]
+	}
+
+	ok, err = p.parseOr()
+	if err != nil {
+		return false, err
+	}
+	if p.pos < len(p.tokens) {
+		return false, p.error()
+	}
+	return ok, nil
+}
+
+func (p *pythonMarkerParser) error() error {
+	return trace.TraceError(errors.New(fmt.Sprintf("invalid markers: %s", p.markers)))
+}
+
+func (p *pythonMarkerParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *pythonMarkerParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+// parseOr parses marker_or := marker_and ("or" marker_and)*
+func (p *pythonMarkerParser) parseOr() (ok bool, err error) {
+	ok, err = p.parseAnd()
+	if err != nil {
+		return false, err
+	}
+	for p.peek() == "or" {
+		p.next()
+		res, err := p.parseAnd()
+		if err != nil {
+			return false, err
+		}
+		ok = ok || res
+	}
+	return ok, nil
+}
+
+// parseAnd parses marker_and := marker_expr ("and" marker_expr)*
+func (p *pythonMarkerParser) parseAnd() (ok bool, err error) {
+	ok, err = p.parseExpr()
+	if err != nil {
+		return false, err
+	}
+	for p.peek() == "and" {
+		p.next()
+		res, err := p.parseExpr()
+		if err != nil {
+			return false, err
+		}
+		ok = ok && res
+	}
+	return ok, nil
+}
+
+// parseExpr parses marker_expr := "(" marker_or ")" | marker_var marker_op marker_var
+func (p *pythonMarkerParser) parseExpr() (ok bool, err error) {
+	if p.peek() == "(" {
+		p.next()
+		ok, err = p.parseOr()
+		if err != nil {
+			return false, err
+		}
+		if p.next() != ")" {
+			return false, p.error()
+		}
+		return ok, nil
+	}
+
+	// left value
+	lhs, lhsVar, err := p.parseValue()
+	if err != nil {
+		return false, err
+	}
+
+	// operator
+	op := p.next()
+	if op == "not" {
+		if p.next() != "in" {
+			return false, p.error()
+		}
+		op = "not in"
+	}
+
+	// right value
+	rhs, rhsVar, err := p.parseValue()
+	if err != nil {
+		return false, err
+	}
+
+	// extras are compared by normalized names
+	if lhsVar == "extra" || rhsVar == "extra" {
+		lhs = normalizePythonName(lhs)
+		rhs = normalizePythonName(rhs)
+	}
+
+	return p.compare(lhs, op, rhs)
+}
+
+// parseValue parses marker_var, which is either an environment variable or
+// a quoted string. name is the name of the environment variable if any.
+func (p *pythonMarkerParser) parseValue() (value string, name string, err error) {
+	t := p.next()
+	switch {
+	case t == "":
+		return "", "", p.error()
+	case strings.HasPrefix(t, `"`) || strings.HasPrefix(t, `'`):
+		return t[1 : len(t)-1], "", nil
+	case pythonMarkerVariables[t] != "":
+		name = pythonMarkerVariables[t]
+		return p.env[name], name, nil
+	default:
+		return "", "", p.error()
+	}
+}
+
+// compare compares the values as versions if both are valid versions for
+// version comparison operators, or otherwise as strings.
+func (p *pythonMarkerParser) compare(lhs, op, rhs string) (ok bool, err error) {
+	switch op {
+	case "in":
+		return strings.Contains(rhs, lhs), nil
+	case "not in":
+		return !strings.Contains(rhs, lhs), nil
+	case "===":
+		return lhs == rhs, nil
+	case "==", "!=", "<", "<=", ">", ">=", "~=":
+	default:
+		return false, p.error()
+	}
+
+	// versions
+	if v, err := parsePythonVersion(lhs); err == nil {
+		if ss, err := parsePythonSpecifierSet(op + rhs); err == nil {
+			return ss.check(v) == 0, nil
+		}
+	}
+
+	// strings
+	switch op {
+	case "==":
+		return lhs == rhs, nil
+	case "!=":
+		return lhs != rhs, nil
+	case "<":
+		return lhs < rhs, nil
+	case "<=":
+		return lhs <= rhs, nil
+	case ">":
+		return lhs > rhs, nil
+	case ">=":
+		return lhs >= rhs, nil
+	default:
+		return false, p.error()
+	}
+}
+
+// pythonMarkerVariables maps names of marker variables to the ones of the
+// environment, including legacy dotted names.
+var pythonMarkerVariables = map[string]string{
+	"implementation_name":            "implementation_name",
+	"implementation_version":         "implementation_version",
+	"os_name":                        "os_name",
+	"os.name":                        "os_name",
+	"platform_machine":               "platform_machine",
+	"platform.machine":               "platform_machine",
+	"platform_python_implementation": "platform_python_implementation",
+	"platform.python_implementation": "platform_python_implementation",
+	"python_implementation":          "platform_python_implementation",
+	"platform_release":               "platform_release",
+	"platform_system":                "platform_system",
+	"platform_version":               "platform_version",
+	"platform.version":               "platform_version",
+	"python_full_version":            "python_full_version",
+	"python_version":                 "python_version",
+	"sys_platform":                   "sys_platform",
+	"sys.platform":                   "sys_platform",
+	"extra":                          "extra",
+}
@@ -0,0 +1,62 @@
+package services
+
+import "testing"
+
+func TestEvaluatePythonMarkers(t *testing.T) {
+	env := map[string]string{
+		"os_name":                        "posix",
+		"platform_machine":               "x86_64",
+		"platform_python_implementation": "CPython",
+		"platform_system":                "Linux",
+		"python_full_version":            "3.10.12",
+		"python_version":                 "3.10",
+		"sys_platform":                   "linux",
+	}
+
+	cases := []struct {
+		markers  string
+		expected bool
+		valid    bool
+	}{
+		{"", true, true},
+		{`python_version >= "3.8"`, true, true},
+		{`python_version < "3.8"`, false, true},
+		{`python_version > "3.9"`, true, true},
+		{`python_full_version == "3.10.*"`, true, true},
+		{`"3.9" < python_version`, true, true},
+		{`sys_platform == "win32"`, false, true},
+		{`sys_platform == 'linux' and platform_machine == 'x86_64'`, true, true},
+		{`sys_platform == "win32" or os_name == "posix"`, true, true},
+		{`(sys_platform == "win32" or sys_platform == "darwin") and python_version >= "3"`, false, true},
+		{`platform_system in "Linux Darwin"`, true, true},
+		{`platform_system not in "Windows"`, true, true},
+		{`platform.python_implementation == "CPython"`, true, true},
+		{`extra == "test"`, false, true},
+		{`python_version >= "3.8" and`, false, false},
+		{`python_version ~ "3.8"`, false, false},
+		{`unknown_var == "1"`, false, false},
+		{`(python_version >= "3.8"`, false, false},
+	}
+	for _, c := range cases {
+		ok, err := evaluatePythonMarkers(c.markers, env)
+		if !c.valid {
+			if err == nil {
+				t.Errorf("%s: expected error", c.markers)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.markers, err)
+			continue
+		}
+		if ok != c.expected {
+			t.Errorf("%s: expected %v, got %v", c.markers, c.expected, ok)
+		}
+	}
+
+	// extras
+	ok, err := evaluatePythonMarkers(`extra == "Test_Utils"`, map[string]string{"extra": "test-utils"})
+	if err != nil || !ok {
+		t.Errorf("expected extra to match by normalized name, got %v: %v", ok, err)
+	}
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pythonRequirement is a dependency specification as per PEP 508, such as
+// `requests[socks]>=2.8.1,==2.8.*; python_version < "2.7"`.
+type pythonRequirement struct {
+	Name      string
+	Extras    []string
+	Specifier pythonSpecifierSet
+	Url       string
+	Markers   string
+
+	// specifier as declared in the manifest, if it is not in PEP 440 format
+	RawSpecifier string
+
+	// original dependency specification as per PEP 508
+	Line string
+}
+
+var pythonRequirementNameRegex = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*[A-Za-z0-9]|[A-Za-z0-9])`)
+
+// parsePythonRequirement parses a dependency specification as per PEP 508.
+func parsePythonRequirement(s string) (r *pythonRequirement, err error) {
+	s = strings.TrimSpace(s)
+
+	// name
+	name := pythonRequirementNameRegex.FindString(s)
+	if name == "" {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid requirement: %s", s)))
+	}
+	r = &pythonRequirement{Name: name, Line: s}
+	rest := strings.TrimSpace(s[len(name):])
+
+	// extras
+	if strings.HasPrefix(rest, "[") {
+		idx := strings.Index(rest, "]")
+		if idx < 0 {
+			return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid requirement: %s", s)))
+		}
+		for _, extra := range strings.Split(rest[1:idx], ",") {
+			extra = strings.TrimSpace(extra)
+			if extra == "" {
+				continue
+			}
+			r.Extras = append(r.Extras, extra)
+		}
+		rest = strings.TrimSpace(rest[idx+1:])
+	}
+
+	// direct reference
+	if strings.HasPrefix(rest, "@") {
+		rest = strings.TrimSpace(rest[1:])
+
+		// markers must be separated from url by whitespace
+		if idx := strings.IndexAny(rest, " \t"); idx >= 0 {
+			markers := strings.TrimSpace(rest[idx:])
+			if !strings.HasPrefix(markers, ";") {
+				return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid requirement: %s", s)))
+			}
+			r.Markers = strings.TrimSpace(markers[1:])
+			rest = rest[:idx]
+		}
+		if _, err := url.Parse(rest); err != nil || rest == "" {
+			return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid requirement: %s", s)))
+		}
+		r.Url = rest
+		return r, nil
+	}
+
+	// markers
+	if idx := strings.Index(rest, ";"); idx >= 0 {
+		r.Markers = strings.TrimSpace(rest[idx+1:])
+		rest = strings.TrimSpace(rest[:idx])
+	}
+
+	// version specifier, which may be enclosed in parentheses
+	if strings.HasPrefix(rest, "(") && strings.HasSuffix(rest, ")") {
+		rest = strings.TrimSpace(rest[1 : len(rest)-1])
+	}
+	r.Specifier, err = parsePythonSpecifierSet(rest)
+	if err != nil {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid requirement: %s", s)))
+	}
+
+	return r, nil
+}
+
+// pythonRequirementsFile is the result of parsing a pip requirements file,
+// including files referenced by -r and -c options.
+type pythonRequirementsFile struct {
+	Requirements []*pythonRequirement
+
+	// version specifiers of constraints files keyed by normalized name
+	Constraints map[string]pythonSpecifierSet
+}
+
+var (
+	pythonRequirementsCommentRegex = regexp.MustCompile(`(^|\s+)#.*$`)
+	pythonRequirementsOptionRegex  = regexp.MustCompile(`\s+--?[A-Za-z]`)
+	pythonRequirementsEggRegex     = regexp.MustCompile(`[#&]egg=([^&]+)`)
+)
+
+// parsePythonRequirementsFile parses a pip requirements file. Files included
+// by -r or -c options are resolved relative to the including file and must
+// be located within rootPath.
+func parsePythonRequirementsFile(rootPath, filePath string) (f *pythonRequirementsFile, err error) {
+	f = &pythonRequirementsFile{
+		Constraints: map[string]pythonSpecifierSet{},
+	}
+	if err := f._parse(rootPath, filePath, false, map[string]bool{}); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *pythonRequirementsFile) _parse(rootPath, filePath string, isConstraint bool, visited map[string]bool) (err error) {
+	// skip files that have been parsed
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	if visited[absPath] {
+		return nil
+	}
+	visited[absPath] = true
+
+	// file content
+	data, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// iterate logical lines
+	for i, line := range joinPythonRequirementsLines(string(data)) {
+		// remove comments
+		line = strings.TrimSpace(pythonRequirementsCommentRegex.ReplaceAllString(line, ""))
+		if line == "" {
+			continue
+		}
+
+		// options
+		if strings.HasPrefix(line, "-") {
+			name, value := splitPythonRequirementsOption(line)
+			switch name {
+			case "-r", "--requirement", "-c", "--constraint":
+				if err := f._include(rootPath, absPath, value, isConstraint || name == "-c" || name == "--constraint", visited); err != nil {
+					return err
+				}
+			case "-e", "--editable":
+				// editable requirements are only supported with egg names
+				r := parsePythonRequirementUrl(value)
+				if r != nil && !isConstraint {
+					f.Requirements = append(f.Requirements, r)
+				}
+			}
+
+			// other options such as --index-url do not declare requirements
+			continue
+		}
+
+		// remove per-requirement options such as --hash
+		if loc := pythonRequirementsOptionRegex.FindStringIndex(line); loc != nil {
+			line = strings.TrimSpace(line[:loc[0]])
+		}
+
+		// requirement
+		var r *pythonRequirement
+		if isPythonRequirementUrl(line) {
+			// url or path without name
+			r = parsePythonRequirementUrl(line)
+			if r == nil {
+				continue
+			}
+		} else {
+			r, err = parsePythonRequirement(line)
+			if err != nil {
+				return trace.TraceError(errors.New(fmt.Sprintf("invalid requirement in %s at line %d: %s", filepath.Base(absPath), i+1, line)))
+			}
+		}
+
+		// constraint
+		if isConstraint {
+			key := normalizePythonName(r.Name)
+			f.Constraints[key] = append(f.Constraints[key], r.Specifier...)
+			continue
+		}
+
+		f.Requirements = append(f.Requirements, r)
+	}
+
+	return nil
+}
+
+func (f *pythonRequirementsFile) _include(rootPath, parentPath, value string, isConstraint bool, visited map[string]bool) (err error) {
+	// remote files are not supported
+	if strings.Contains(value, "://") {
+		return nil
+	}
+
+	// resolve path relative to the including file
+	includePath := value
+	if !filepath.IsAbs(includePath) {
+		includePath = filepath.Join(filepath.Dir(parentPath), includePath)
+	}
+
+	// restrict to root path
+	absRootPath, err := filepath.Abs(rootPath)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	relPath, err := filepath.Rel(absRootPath, includePath)
+	if err != nil || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return trace.TraceError(errors.New(fmt.Sprintf("requirements file outside of workspace: %s", value)))
+	}
+
+	return f._parse(rootPath, includePath, isConstraint, visited)
+}
+
+// joinPythonRequirementsLines splits content into logical lines, joining
+// lines that end with a backslash.
+func joinPythonRequirementsLines(content string) (lines []string) {
+	var buf strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		if strings.HasSuffix(line, "\\") {
+			buf.WriteString(strings.TrimSuffix(line, "\\"))
+			buf.WriteString(" ")
+			continue
+		}
+		buf.WriteString(line)
+		lines = append(lines, buf.String())
+		buf.Reset()
+	}
+	if buf.Len() > 0 {
+		lines = append(lines, buf.String())
+	}
+	return lines
+}
+
+// splitPythonRequirementsOption splits an option line such as "-r base.txt"
+// or "--requirement=base.txt" into option name and value.
+func splitPythonRequirementsOption(line string) (name, value string) {
+	idx := strings.IndexAny(line, " \t=")
+	if idx < 0 {
+		return line, ""
+	}
+	return line[:idx], strings.TrimSpace(line[idx+1:])
+}
+
+// isPythonRequirementUrl returns whether a requirement is given as url or
+// local path rather than as a name.
+func isPythonRequirementUrl(s string) bool {
+	return strings.Contains(strings.SplitN(s, " ", 2)[0], "://") ||
+		strings.HasPrefix(s, ".") ||
+		strings.HasPrefix(s, "/")
+}
+
+// parsePythonRequirementUrl parses a requirement given as url, such as
+// "git+https://github.com/org/repo.git#egg=name". It returns nil if the
+// project name cannot be determined.
+func parsePythonRequirementUrl(s string) (r *pythonRequirement) {
+	s = strings.TrimSpace(s)
+	matches := pythonRequirementsEggRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return nil
+	}
+
+	// egg name may contain extras, e.g. #egg=name[extra]
+	egg, err := parsePythonRequirement(matches[1])
+	if err != nil {
+		return nil
+	}
+	egg.Url = s
+	return egg
+}
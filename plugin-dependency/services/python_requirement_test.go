@@ -0,0 +1,96 @@
+package services
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePythonRequirement(t *testing.T) {
+	cases := []struct {
+		s         string
+		name      string
+		extras    []string
+		specifier string
+		url       string
+		markers   string
+		valid     bool
+	}{
+		{"requests", "requests", nil, "", "", "", true},
+		{"requests==2.31.0", "requests", nil, "==2.31.0", "", "", true},
+		{"requests [security, socks] >= 2.8.1, == 2.8.*", "requests", []string{"security", "socks"}, ">=2.8.1,==2.8.*", "", "", true},
+		{"requests (>=2.0)", "requests", nil, ">=2.0", "", "", true},
+		{`pywin32>=1.0; sys_platform == "win32"`, "pywin32", nil, ">=1.0", "", `sys_platform == "win32"`, true},
+		{"pip @ https://github.com/pypa/pip/archive/1.3.1.zip", "pip", nil, "", "https://github.com/pypa/pip/archive/1.3.1.zip", "", true},
+		{`pip @ https://example.com/pip.zip ; python_version < "3.8"`, "pip", nil, "", "https://example.com/pip.zip", `python_version < "3.8"`, true},
+		{"requests 2.0", "", nil, "", "", "", false},
+		{"requests[security", "", nil, "", "", "", false},
+		{"-r base.txt", "", nil, "", "", "", false},
+	}
+	for _, c := range cases {
+		r, err := parsePythonRequirement(c.s)
+		if !c.valid {
+			if err == nil {
+				t.Errorf("%s: expected error", c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.s, err)
+			continue
+		}
+		if r.Name != c.name || !reflect.DeepEqual(r.Extras, c.extras) || r.Specifier.String() != c.specifier || r.Url != c.url || r.Markers != c.markers {
+			t.Errorf("%s: unexpected requirement %+v", c.s, r)
+		}
+	}
+}
+
+func TestParsePythonRequirementsFile(t *testing.T) {
+	dirPath := t.TempDir()
+	files := map[string]string{
+		"requirements.txt": strings.Join([]string{
+			"# comment",
+			"-r base.txt",
+			"-c constraints.txt",
+			"--index-url https://pypi.org/simple",
+			"requests>=2.0 \\",
+			"    --hash=sha256:abc",
+			"-e git+https://github.com/org/repo.git#egg=repo[extra]",
+			"./local/path",
+			"flask  # web framework",
+		}, "\n"),
+		"base.txt":        "numpy==1.26.0\n-r requirements.txt\n",
+		"constraints.txt": "requests<3\nflask==3.0.0\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dirPath, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := parsePythonRequirementsFile(dirPath, filepath.Join(dirPath, "requirements.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reqs []string
+	for _, r := range f.Requirements {
+		reqs = append(reqs, r.Name+r.Specifier.String())
+	}
+	expected := []string{"numpy==1.26.0", "requests>=2.0", "repo", "flask"}
+	if !reflect.DeepEqual(reqs, expected) {
+		t.Errorf("expected requirements %v, got %v", expected, reqs)
+	}
+	if f.Constraints["requests"].String() != "<3" || f.Constraints["flask"].String() != "==3.0.0" {
+		t.Errorf("unexpected constraints %v", f.Constraints)
+	}
+
+	// files outside of the workspace
+	if err := ioutil.WriteFile(filepath.Join(dirPath, "outside.txt"), []byte("-r ../requirements.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parsePythonRequirementsFile(dirPath, filepath.Join(dirPath, "outside.txt")); err == nil {
+		t.Error("expected error for requirements file outside of workspace")
+	}
+}
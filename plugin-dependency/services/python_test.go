@@ -0,0 +1,33 @@
+package services
+
+import (
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestGetPythonCmd(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"python3", "python3.9"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		pipCmd   string
+		expected string
+	}{
+		{filepath.Join(dir, "pip"), filepath.Join(dir, "python3")},
+		{filepath.Join(dir, "pip3"), filepath.Join(dir, "python3")},
+		{filepath.Join(dir, "pip3.9"), filepath.Join(dir, "python3.9")},
+		{filepath.Join(dir, "pip3.8"), constants.DefaultPythonCmd},
+		{filepath.Join(dir, "pipenv"), constants.DefaultPythonCmd},
+	}
+	for _, c := range cases {
+		if res := getPythonCmd(c.pipCmd); res != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.pipCmd, c.expected, res)
+		}
+	}
+}
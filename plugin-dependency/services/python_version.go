@@ -0,0 +1,431 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// pythonVersionRegex matches versions as per PEP 440, including the
+// alternative spellings that are normalized by pip.
+var pythonVersionRegex = regexp.MustCompile(`(?i)^v?` +
+	`(?:(?P<epoch>[0-9]+)!)?` +
+	`(?P<release>[0-9]+(?:\.[0-9]+)*)` +
+	`(?P<pre>[-_.]?(?P<pre_l>alpha|a|beta|b|preview|pre|c|rc)[-_.]?(?P<pre_n>[0-9]+)?)?` +
+	`(?P<post>(?:-(?P<post_n1>[0-9]+))|(?:[-_.]?(?P<post_l>post|rev|r)[-_.]?(?P<post_n2>[0-9]+)?))?` +
+	`(?P<dev>[-_.]?(?P<dev_l>dev)[-_.]?(?P<dev_n>[0-9]+)?)?` +
+	`(?:\+(?P<local>[a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// pre-release phases, in which the phases without pre-release segment are
+// placed before or after the actual pre-releases for comparison
+const (
+	pythonPrePhaseDevOnly = -1
+	pythonPrePhaseAlpha   = 0
+	pythonPrePhaseBeta    = 1
+	pythonPrePhaseRc      = 2
+	pythonPrePhaseNone    = 3
+)
+
+// pythonVersion is a version parsed as per PEP 440.
+type pythonVersion struct {
+	raw      string
+	epoch    int
+	release  []int
+	prePhase int
+	preNum   int
+	post     int // -1 if not a post-release
+	dev      int // -1 if not a development release
+	local    []string
+}
+
+// isPrerelease returns whether the version is a pre-release or a
+// development release.
+func (v *pythonVersion) isPrerelease() bool {
+	return v.prePhase != pythonPrePhaseNone || v.dev >= 0
+}
+
+// isPostrelease returns whether the version is a post-release.
+func (v *pythonVersion) isPostrelease() bool {
+	return v.post >= 0
+}
+
+// public returns the version without local version label.
+func (v *pythonVersion) public() *pythonVersion {
+	pv := *v
+	pv.local = nil
+	return &pv
+}
+
+// compare returns -1, 0 or 1 if the version is lower than, equal to or
+// higher than the other version.
+func (v *pythonVersion) compare(o *pythonVersion) int {
+	if res := compareInt(v.epoch, o.epoch); res != 0 {
+		return res
+	}
+	if res := comparePythonRelease(v.release, o.release); res != 0 {
+		return res
+	}
+	if res := compareInt(v.prePhase, o.prePhase); res != 0 {
+		return res
+	}
+	if res := compareInt(v.preNum, o.preNum); res != 0 {
+		return res
+	}
+	if res := compareInt(v.post, o.post); res != 0 {
+		return res
+	}
+	if res := compareInt(pythonDevKey(v.dev), pythonDevKey(o.dev)); res != 0 {
+		return res
+	}
+	return comparePythonLocal(v.local, o.local)
+}
+
+// parsePythonVersion parses a version string as per PEP 440.
+func parsePythonVersion(s string) (v *pythonVersion, err error) {
+	s = strings.TrimSpace(s)
+	matches := pythonVersionRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid python version: %s", s)))
+	}
+	group := func(name string) string {
+		return matches[pythonVersionRegex.SubexpIndex(name)]
+	}
+
+	v = &pythonVersion{
+		raw:      s,
+		prePhase: pythonPrePhaseNone,
+		post:     -1,
+		dev:      -1,
+	}
+
+	// epoch
+	if e := group("epoch"); e != "" {
+		v.epoch, _ = strconv.Atoi(e)
+	}
+
+	// release
+	for _, part := range strings.Split(group("release"), ".") {
+		n, _ := strconv.Atoi(part)
+		v.release = append(v.release, n)
+	}
+
+	// pre-release
+	if group("pre") != "" {
+		switch strings.ToLower(group("pre_l")) {
+		case "a", "alpha":
+			v.prePhase = pythonPrePhaseAlpha
+		case "b", "beta":
+			v.prePhase = pythonPrePhaseBeta
+		default:
+			v.prePhase = pythonPrePhaseRc
+		}
+		v.preNum, _ = strconv.Atoi(group("pre_n"))
+	}
+
+	// post-release
+	if group("post") != "" {
+		n := group("post_n1")
+		if n == "" {
+			n = group("post_n2")
+		}
+		v.post, _ = strconv.Atoi(n)
+	}
+
+	// development release
+	if group("dev") != "" {
+		v.dev, _ = strconv.Atoi(group("dev_n"))
+	}
+
+	// a development release without pre-release and post-release segments
+	// sorts before all pre-releases of the same release
+	if v.dev >= 0 && v.prePhase == pythonPrePhaseNone && v.post < 0 {
+		v.prePhase = pythonPrePhaseDevOnly
+	}
+
+	// local version label
+	if l := group("local"); l != "" {
+		v.local = strings.FieldsFunc(strings.ToLower(l), func(r rune) bool {
+			return r == '.' || r == '-' || r == '_'
+		})
+	}
+
+	return v, nil
+}
+
+// comparePythonVersions compares two version strings as per PEP 440. ok is
+// false if any of the versions is invalid.
+func comparePythonVersions(a, b string) (res int, ok bool) {
+	va, err := parsePythonVersion(a)
+	if err != nil {
+		return 0, false
+	}
+	vb, err := parsePythonVersion(b)
+	if err != nil {
+		return 0, false
+	}
+	return va.compare(vb), true
+}
+
+func comparePythonRelease(a, b []int) int {
+	n := len(a)
+	if len(b) > n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if res := compareInt(x, y); res != 0 {
+			return res
+		}
+	}
+	return 0
+}
+
+func comparePythonLocal(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		na, errA := strconv.Atoi(a[i])
+		nb, errB := strconv.Atoi(b[i])
+		switch {
+		case errA == nil && errB == nil:
+			if res := compareInt(na, nb); res != 0 {
+				return res
+			}
+		case errA == nil:
+			// numeric segments sort after alphanumeric ones
+			return 1
+		case errB == nil:
+			return -1
+		default:
+			if res := strings.Compare(a[i], b[i]); res != 0 {
+				return res
+			}
+		}
+	}
+	return compareInt(len(a), len(b))
+}
+
+func pythonDevKey(dev int) int {
+	if dev < 0 {
+		return math.MaxInt32
+	}
+	return dev
+}
+
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// pythonSpecifier is a version specifier clause as per PEP 440, such as
+// ">=1.0" or "~=2.2".
+type pythonSpecifier struct {
+	op       string
+	version  string
+	wildcard bool
+}
+
+func (s pythonSpecifier) String() string {
+	if s.wildcard {
+		return s.op + s.version + ".*"
+	}
+	return s.op + s.version
+}
+
+var pythonSpecifierRegex = regexp.MustCompile(`^(===|~=|==|!=|<=|>=|<|>)\s*(\S+)$`)
+
+// pythonSpecifierSet is a comma-separated list of version specifiers, all
+// of which must be satisfied.
+type pythonSpecifierSet []pythonSpecifier
+
+func (ss pythonSpecifierSet) String() string {
+	var parts []string
+	for _, s := range ss {
+		parts = append(parts, s.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// parsePythonSpecifierSet parses a specifier set such as ">=1.0,!=1.3.*".
+func parsePythonSpecifierSet(s string) (ss pythonSpecifierSet, err error) {
+	for _, clause := range strings.Split(s, ",") {
+		clause = strings.TrimSpace(clause)
+		if clause == "" {
+			continue
+		}
+		matches := pythonSpecifierRegex.FindStringSubmatch(clause)
+		if matches == nil {
+			return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid version specifier: %s", clause)))
+		}
+		spec := pythonSpecifier{
+			op:      matches[1],
+			version: matches[2],
+		}
+
+		// arbitrary equality compares strings only
+		if spec.op == "===" {
+			ss = append(ss, spec)
+			continue
+		}
+
+		// prefix matching
+		if strings.HasSuffix(spec.version, ".*") {
+			if spec.op != "==" && spec.op != "!=" {
+				return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid version specifier: %s", clause)))
+			}
+			spec.wildcard = true
+			spec.version = strings.TrimSuffix(spec.version, ".*")
+		}
+
+		// validate version
+		v, err := parsePythonVersion(spec.version)
+		if err != nil {
+			return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid version specifier: %s", clause)))
+		}
+		if spec.op == "~=" && len(v.release) < 2 {
+			return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid version specifier: %s", clause)))
+		}
+
+		ss = append(ss, spec)
+	}
+	return ss, nil
+}
+
+// check compares a version with the specifier set. It returns 0 if the
+// version satisfies all specifiers, -1 if the version is too low for some
+// specifier (i.e. should be upgraded), or 1 if it is too high (i.e. should
+// be downgraded).
+func (ss pythonSpecifierSet) check(v *pythonVersion) (res int) {
+	for _, s := range ss {
+		if res := s.check(v); res != 0 {
+			return res
+		}
+	}
+	return 0
+}
+
+// check compares a version with the specifier. See pythonSpecifierSet.check.
+func (s pythonSpecifier) check(v *pythonVersion) (res int) {
+	// arbitrary equality
+	if s.op == "===" {
+		if strings.EqualFold(v.raw, s.version) {
+			return 0
+		}
+		if sv := mustParsePythonVersion(s.version); sv != nil && v.compare(sv) < 0 {
+			return -1
+		}
+		return 1
+	}
+
+	sv := mustParsePythonVersion(s.version)
+	if sv == nil {
+		return 0
+	}
+
+	// local version labels are ignored unless the specifier has one
+	if len(sv.local) == 0 {
+		v = v.public()
+	}
+
+	switch s.op {
+	case "==":
+		if s.wildcard {
+			return comparePythonPrefix(v, sv)
+		}
+		return v.compare(sv)
+	case "!=":
+		var cmp int
+		if s.wildcard {
+			cmp = comparePythonPrefix(v, sv)
+		} else {
+			cmp = v.compare(sv)
+		}
+		if cmp != 0 {
+			return 0
+		}
+		// the excluded version is installed, for which an upgrade is
+		// considered to be the fix
+		return -1
+	case "~=":
+		// ~=V.N is equivalent to >=V.N, ==V.*
+		if v.compare(sv) < 0 {
+			return -1
+		}
+		prefix := &pythonVersion{
+			epoch:   sv.epoch,
+			release: sv.release[:len(sv.release)-1],
+		}
+		return comparePythonPrefix(v, prefix)
+	case ">=":
+		if v.compare(sv) < 0 {
+			return -1
+		}
+	case "<=":
+		if v.compare(sv) > 0 {
+			return 1
+		}
+	case ">":
+		if v.compare(sv) <= 0 {
+			return -1
+		}
+		// post-releases of the given version are excluded unless the
+		// given version is a post-release itself
+		if !sv.isPostrelease() && v.isPostrelease() && comparePythonBase(v, sv) == 0 {
+			return -1
+		}
+	case "<":
+		if v.compare(sv) >= 0 {
+			return 1
+		}
+		// pre-releases of the given version are excluded unless the given
+		// version is a pre-release itself
+		if !sv.isPrerelease() && v.isPrerelease() && comparePythonBase(v, sv) == 0 {
+			return 1
+		}
+	}
+	return 0
+}
+
+// comparePythonPrefix compares the epoch and the release segments of a
+// version with those of the prefix, padding the version with zeros.
+func comparePythonPrefix(v, prefix *pythonVersion) int {
+	if res := compareInt(v.epoch, prefix.epoch); res != 0 {
+		return res
+	}
+	for i, n := range prefix.release {
+		var x int
+		if i < len(v.release) {
+			x = v.release[i]
+		}
+		if res := compareInt(x, n); res != 0 {
+			return res
+		}
+	}
+	return 0
+}
+
+// comparePythonBase compares the epoch and the release segments of two
+// versions.
+func comparePythonBase(a, b *pythonVersion) int {
+	if res := compareInt(a.epoch, b.epoch); res != 0 {
+		return res
+	}
+	return comparePythonRelease(a.release, b.release)
+}
+
+func mustParsePythonVersion(s string) (v *pythonVersion) {
+	v, _ = parsePythonVersion(s)
+	return v
+}
@@ -0,0 +1,129 @@
+package services
+
+import "testing"
+
+func TestParsePythonVersion(t *testing.T) {
+	cases := []struct {
+		s     string
+		valid bool
+	}{
+		{"1.0", true},
+		{"v1.0", true},
+		{"1!2.0.post1", true},
+		{"1.0a1", true},
+		{"1.0-rc.2", true},
+		{"1.0.dev3", true},
+		{"1.0+ubuntu.1", true},
+		{"1.0.*", false},
+		{"latest", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		_, err := parsePythonVersion(c.s)
+		if c.valid && err != nil {
+			t.Errorf("%s: unexpected error: %v", c.s, err)
+		}
+		if !c.valid && err == nil {
+			t.Errorf("%s: expected error", c.s)
+		}
+	}
+}
+
+func TestComparePythonVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.0.dev1", "1.0a1", -1},
+		{"1.0a1", "1.0b1", -1},
+		{"1.0rc1", "1.0", -1},
+		{"1.0", "1.0.post1", -1},
+		{"1.0.post1.dev1", "1.0.post1", -1},
+		{"1.0", "1.0+local", -1},
+		{"1.0+abc", "1.0+1", -1},
+		{"1!1.0", "2.0", 1},
+		{"1.0-RC1", "1.0rc1", 0},
+	}
+	for _, c := range cases {
+		res, ok := comparePythonVersions(c.a, c.b)
+		if !ok {
+			t.Errorf("%s vs %s: invalid versions", c.a, c.b)
+			continue
+		}
+		if res != c.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", c.a, c.b, c.expected, res)
+		}
+	}
+
+	if _, ok := comparePythonVersions("1.0", "latest"); ok {
+		t.Error("expected invalid version")
+	}
+}
+
+func TestParsePythonSpecifierSet(t *testing.T) {
+	cases := []struct {
+		s        string
+		expected string
+		valid    bool
+	}{
+		{"", "", true},
+		{">=1.0, <2.0", ">=1.0,<2.0", true},
+		{"==1.2.*", "==1.2.*", true},
+		{"~=1.4.5", "~=1.4.5", true},
+		{"===foobar", "===foobar", true},
+		{">=1.*", "", false},
+		{"~=1", "", false},
+		{"1.0", "", false},
+		{">=1.0 <2.0", "", false},
+	}
+	for _, c := range cases {
+		ss, err := parsePythonSpecifierSet(c.s)
+		if !c.valid {
+			if err == nil {
+				t.Errorf("%s: expected error", c.s)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.s, err)
+			continue
+		}
+		if ss.String() != c.expected {
+			t.Errorf("%s: expected %s, got %s", c.s, c.expected, ss.String())
+		}
+	}
+}
+
+func TestPythonSpecifierSet_Check(t *testing.T) {
+	cases := []struct {
+		specifier string
+		version   string
+		expected  int
+	}{
+		{">=1.0,<2.0", "1.5", 0},
+		{">=1.0,<2.0", "0.9", -1},
+		{">=1.0,<2.0", "2.0", 1},
+		{"==1.2.*", "1.2.9", 0},
+		{"==1.2.*", "1.3", 1},
+		{"!=1.2.*", "1.2.1", -1},
+		{"~=1.4.5", "1.4.9", 0},
+		{"~=1.4.5", "1.5.0", 1},
+		{"~=1.4.5", "1.4.4", -1},
+		{"==1.0", "1.0+local", 0},
+		{"<2.0", "2.0a1", 1},
+		{">1.0", "1.0.post1", -1},
+		{"<=1.0", "1.0", 0},
+	}
+	for _, c := range cases {
+		ss, err := parsePythonSpecifierSet(c.specifier)
+		if err != nil {
+			t.Fatalf("%s: %v", c.specifier, err)
+		}
+		if res := ss.check(mustParsePythonVersion(c.version)); res != c.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", c.version, c.specifier, c.expected, res)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/imroc/req"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+type baseRegistry struct {
+	url      string
+	username string
+	password string
+	timeout  time.Duration
+}
+
+func (r *baseRegistry) _get(requestUrl string, header req.Header) (res *req.Resp, err error) {
+	return r._request(http.MethodGet, requestUrl, header, nil, r.timeout)
+}
+
+func (r *baseRegistry) _post(requestUrl string, header req.Header, body interface{}) (res *req.Resp, err error) {
+	return r._request(http.MethodPost, requestUrl, header, body, r.timeout)
+}
+
+func (r *baseRegistry) _request(method string, requestUrl string, header req.Header, body interface{}, timeout time.Duration) (res *req.Resp, err error) {
+	// perform request
+	res, err = r._do(method, requestUrl, header, body, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// validate status code
+	if res.Response().StatusCode != http.StatusOK {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("request %s failed: %s", requestUrl, res.Response().Status)))
+	}
+
+	return res, nil
+}
+
+// _do performs the request without validating the status code, e.g. for
+// lookups where not found is an expected response.
+func (r *baseRegistry) _do(method string, requestUrl string, header req.Header, body interface{}, timeout time.Duration) (res *req.Resp, err error) {
+	// request session
+	reqSession := req.New()
+
+	// set timeout
+	reqSession.SetTimeout(timeout)
+
+	// request header
+	h := req.Header{"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/94.0.4606.61 Safari/537.36"}
+	for k, v := range header {
+		h[k] = v
+	}
+
+	// basic auth for private registries
+	if r.username != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(r.username + ":" + r.password))
+		h["Authorization"] = "Basic " + auth
+	}
+
+	// perform request
+	args := []interface{}{h}
+	if body != nil {
+		args = append(args, body)
+	}
+	res, err = reqSession.Do(method, requestUrl, args...)
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	return res, nil
+}
+
+func newBaseRegistry(url, username, password string) (r *baseRegistry) {
+	return &baseRegistry{
+		url:      strings.TrimSuffix(url, "/"),
+		username: username,
+		password: password,
+		timeout:  15 * time.Second,
+	}
+}
+
+// sortVersionsDesc sorts versions from the latest, falling back to string
+// comparison for versions that cannot be compared.
+func sortVersionsDesc(versions []string, compare func(a, b string) (res int, ok bool)) {
+	sort.Slice(versions, func(i, j int) bool {
+		res, ok := compare(versions[i], versions[j])
+		if !ok {
+			return versions[i] > versions[j]
+		}
+		return res > 0
+	})
+}
+
+// compareSemverVersions compares semantic versions, which may be prefixed
+// with "v" as in Go module versions.
+func compareSemverVersions(a, b string) (res int, ok bool) {
+	va, err := semver.NewVersion(a)
+	if err != nil {
+		return 0, false
+	}
+	vb, err := semver.NewVersion(b)
+	if err != nil {
+		return 0, false
+	}
+	return va.Compare(vb), true
+}
+
+// newRegistry creates a package registry client from the registry options
+// of the given setting, falling back to the default registry type.
+func newRegistry(s models.Setting, defaultType string) (reg DependencyRegistry, err error) {
+	// registry type
+	registryType := s.RegistryType
+	if registryType == "" {
+		registryType = defaultType
+	}
+
+	switch registryType {
+	case constants.RegistryTypePypi:
+		return NewPypiRegistry(s.RegistryUrl, s.RegistryUsername, s.RegistryPassword), nil
+	case constants.RegistryTypePypiSimple:
+		return NewPypiSimpleRegistry(s.RegistryUrl, s.RegistryUsername, s.RegistryPassword), nil
+	case constants.RegistryTypeDevpi:
+		return NewDevpiRegistry(s.RegistryUrl, s.RegistryUsername, s.RegistryPassword), nil
+	case constants.RegistryTypeNexusPypi:
+		return NewNexusPypiRegistry(s.RegistryUrl, s.RegistryUsername, s.RegistryPassword), nil
+	case constants.RegistryTypeNpm:
+		return NewNpmRegistry(s.RegistryUrl, s.RegistryUsername, s.RegistryPassword), nil
+	case constants.RegistryTypeGoproxy:
+		return NewGoproxyRegistry(s.RegistryUrl, s.RegistryUsername, s.RegistryPassword), nil
+	case constants.RegistryTypeMaven:
+		return NewMavenRegistry(s.RegistryUrl, s.RegistryUsername, s.RegistryPassword), nil
+	default:
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid registry type: %s", registryType)))
+	}
+}
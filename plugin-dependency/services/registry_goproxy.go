@@ -0,0 +1,132 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"strings"
+	"unicode"
+)
+
+// GoproxyRegistry talks to a GOPROXY server (proxy.golang.org, Athens,
+// goproxy.cn, Nexus etc.) as per the module proxy protocol.
+type GoproxyRegistry struct {
+	*baseRegistry
+}
+
+// Search looks up the query as a module or package path, since the module
+// proxy protocol does not provide full-text search.
+func (r *GoproxyRegistry) Search(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	// only one result
+	if page > 1 {
+		return nil, 1, nil
+	}
+
+	// latest version
+	modPath, info, err := r._getLatestInfo(strings.TrimSpace(query))
+	if err != nil {
+		// not found
+		return nil, 0, nil
+	}
+
+	// dependency
+	deps = append(deps, models.Dependency{
+		Name:          modPath,
+		LatestVersion: info.Version,
+	})
+
+	return deps, 1, nil
+}
+
+// GetLatestVersion returns the latest version of the module that provides
+// the given package path.
+func (r *GoproxyRegistry) GetLatestVersion(name string) (v string, err error) {
+	_, info, err := r._getLatestInfo(name)
+	if err != nil {
+		return "", err
+	}
+	return info.Version, nil
+}
+
+// GetVersions returns versions of the module that provides the given
+// package path, listed by "@v/list".
+func (r *GoproxyRegistry) GetVersions(name string) (versions []string, err error) {
+	// module path
+	modPath, _, err := r._getLatestInfo(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// request url
+	requestUrl := fmt.Sprintf("%s/%s/@v/list", r.url, escapeGoModulePath(modPath))
+
+	// perform request
+	res, err := r._get(requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// response, one version per line
+	for _, line := range strings.Split(res.String(), "\n") {
+		if v := strings.TrimSpace(line); v != "" {
+			versions = append(versions, v)
+		}
+	}
+	sortVersionsDesc(versions, compareSemverVersions)
+
+	return versions, nil
+}
+
+// _getLatestInfo requests "@latest" of the given path and its parent paths
+// until a module is found.
+func (r *GoproxyRegistry) _getLatestInfo(name string) (modPath string, info entity.GoproxyInfo, err error) {
+	modPath = strings.Split(name, "@")[0]
+	for modPath != "" && modPath != "." {
+		// request url
+		requestUrl := fmt.Sprintf("%s/%s/@latest", r.url, escapeGoModulePath(modPath))
+
+		// perform request
+		res, err := r._get(requestUrl, nil)
+		if err == nil {
+			if err := res.ToJSON(&info); err != nil {
+				return "", info, trace.TraceError(err)
+			}
+			return modPath, info, nil
+		}
+
+		// parent path
+		idx := strings.LastIndex(modPath, "/")
+		if idx < 0 {
+			break
+		}
+		modPath = modPath[:idx]
+	}
+	return "", info, trace.TraceError(errors.New(fmt.Sprintf("module not found: %s", name)))
+}
+
+// escapeGoModulePath escapes upper-case letters in a module path, e.g.
+// github.com/Azure => github.com/!azure, as required by GOPROXY.
+func escapeGoModulePath(p string) string {
+	var sb strings.Builder
+	for _, c := range p {
+		if unicode.IsUpper(c) {
+			sb.WriteRune('!')
+			sb.WriteRune(unicode.ToLower(c))
+		} else {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+func NewGoproxyRegistry(url, username, password string) (r *GoproxyRegistry) {
+	if url == "" {
+		url = constants.DefaultRegistryUrlGoproxy
+	}
+	return &GoproxyRegistry{
+		baseRegistry: newBaseRegistry(url, username, password),
+	}
+}
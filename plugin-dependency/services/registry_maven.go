@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"net/url"
+	"strings"
+)
+
+// MavenRegistry resolves artifacts from a Maven repository layout, which is
+// served by Maven Central as well as Nexus and Artifactory. Full-text search
+// is only available for Maven Central.
+type MavenRegistry struct {
+	*baseRegistry
+	searchUrl string
+}
+
+func (r *MavenRegistry) Search(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	// exact artifact lookup for "groupId:artifactId" or private repositories
+	if strings.Contains(query, ":") || r.searchUrl == "" {
+		if page > 1 {
+			return nil, 1, nil
+		}
+		v, err := r.GetLatestVersion(query)
+		if err != nil {
+			// not found
+			return nil, 0, nil
+		}
+		deps = append(deps, models.Dependency{
+			Name:          query,
+			LatestVersion: v,
+		})
+		return deps, 1, nil
+	}
+
+	// request url
+	requestUrl := fmt.Sprintf("%s?q=%s&start=%d&rows=%d&wt=json", r.searchUrl, url.QueryEscape(query), (page-1)*size, size)
+
+	// perform request
+	res, err := r._get(requestUrl, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// response
+	var searchRes entity.MavenSearchResult
+	if err := res.ToJSON(&searchRes); err != nil {
+		return nil, 0, trace.TraceError(err)
+	}
+
+	// dependencies
+	for _, doc := range searchRes.Response.Docs {
+		deps = append(deps, models.Dependency{
+			Name:          doc.GroupId + ":" + doc.ArtifactId,
+			LatestVersion: doc.LatestVersion,
+		})
+	}
+
+	return deps, searchRes.Response.NumFound, nil
+}
+
+func (r *MavenRegistry) GetLatestVersion(name string) (v string, err error) {
+	// metadata
+	metadata, err := r._getMetadata(name)
+	if err != nil {
+		return "", err
+	}
+
+	// release version is preferred over snapshots
+	if metadata.Versioning.Release != "" {
+		return metadata.Versioning.Release, nil
+	}
+	return metadata.Versioning.Latest, nil
+}
+
+func (r *MavenRegistry) GetVersions(name string) (versions []string, err error) {
+	// metadata
+	metadata, err := r._getMetadata(name)
+	if err != nil {
+		return nil, err
+	}
+
+	versions = append(versions, metadata.Versioning.Versions...)
+	sortVersionsDesc(versions, func(a, b string) (int, bool) {
+		return compareMavenVersions(a, b), true
+	})
+
+	return versions, nil
+}
+
+func (r *MavenRegistry) _getMetadata(name string) (metadata entity.MavenMetadata, err error) {
+	// group id and artifact id
+	groupId, artifactId, err := parseMavenArtifactName(name)
+	if err != nil {
+		return metadata, err
+	}
+
+	// request url
+	requestUrl := fmt.Sprintf("%s/%s/%s/maven-metadata.xml", r.url, strings.ReplaceAll(groupId, ".", "/"), artifactId)
+
+	// perform request
+	res, err := r._get(requestUrl, nil)
+	if err != nil {
+		return metadata, err
+	}
+
+	// response
+	if err := res.ToXML(&metadata); err != nil {
+		return metadata, trace.TraceError(err)
+	}
+
+	return metadata, nil
+}
+
+// parseMavenArtifactName splits "groupId:artifactId[:version]".
+func parseMavenArtifactName(name string) (groupId, artifactId string, err error) {
+	parts := strings.Split(name, ":")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", trace.TraceError(errors.New(fmt.Sprintf("invalid maven artifact: %s", name)))
+	}
+	return parts[0], parts[1], nil
+}
+
+func NewMavenRegistry(url, username, password string) (r *MavenRegistry) {
+	if url == "" {
+		url = constants.DefaultRegistryUrlMaven
+	}
+	r = &MavenRegistry{
+		baseRegistry: newBaseRegistry(url, username, password),
+	}
+	if strings.TrimSuffix(url, "/") == constants.DefaultRegistryUrlMaven {
+		r.searchUrl = constants.MavenCentralSearchUrl
+	}
+	return r
+}
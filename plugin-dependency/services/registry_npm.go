@@ -0,0 +1,106 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/imroc/req"
+	"net/url"
+)
+
+// NpmRegistry talks to the npm registry API, which is also implemented by
+// private registries such as Verdaccio and Nexus.
+type NpmRegistry struct {
+	*baseRegistry
+}
+
+func (r *NpmRegistry) Search(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	// request url
+	requestUrl := fmt.Sprintf("%s/-/v1/search?text=%s&from=%d&size=%d", r.url, url.QueryEscape(query), (page-1)*size, size)
+
+	// perform request
+	res, err := r._get(requestUrl, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// response
+	var searchRes entity.NpmRegistrySearchResult
+	if err := res.ToJSON(&searchRes); err != nil {
+		return nil, 0, trace.TraceError(err)
+	}
+
+	// dependencies
+	for _, o := range searchRes.Objects {
+		deps = append(deps, models.Dependency{
+			Name:          o.Package.Name,
+			LatestVersion: o.Package.Version,
+			Description:   o.Package.Description,
+		})
+	}
+
+	return deps, searchRes.Total, nil
+}
+
+func (r *NpmRegistry) GetLatestVersion(name string) (v string, err error) {
+	// packument
+	p, err := r._getPackument(name)
+	if err != nil {
+		return "", err
+	}
+
+	// latest version
+	v, ok := p.DistTags["latest"]
+	if !ok {
+		return "", trace.TraceError(errors.New(fmt.Sprintf("no latest version found for %s", name)))
+	}
+
+	return v, nil
+}
+
+func (r *NpmRegistry) GetVersions(name string) (versions []string, err error) {
+	// packument
+	p, err := r._getPackument(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for v := range p.Versions {
+		versions = append(versions, v)
+	}
+	sortVersionsDesc(versions, compareSemverVersions)
+
+	return versions, nil
+}
+
+func (r *NpmRegistry) _getPackument(name string) (p entity.NpmRegistryPackument, err error) {
+	// request url (scoped packages are requested as @scope%2fname)
+	requestUrl := fmt.Sprintf("%s/%s", r.url, url.PathEscape(name))
+
+	// perform request with abbreviated metadata
+	res, err := r._get(requestUrl, req.Header{
+		"Accept": "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8",
+	})
+	if err != nil {
+		return p, err
+	}
+
+	// response
+	if err := res.ToJSON(&p); err != nil {
+		return p, trace.TraceError(err)
+	}
+
+	return p, nil
+}
+
+func NewNpmRegistry(url, username, password string) (r *NpmRegistry) {
+	if url == "" {
+		url = constants.DefaultRegistryUrlNpm
+	}
+	return &NpmRegistry{
+		baseRegistry: newBaseRegistry(url, username, password),
+	}
+}
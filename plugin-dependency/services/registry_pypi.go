@@ -0,0 +1,611 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/PuerkitoBio/goquery"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/imroc/req"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	pypiSimpleIndexTtl     = 1 * time.Hour
+	pypiSimpleIndexTimeout = 5 * time.Minute  // timeout of downloading the simple index
+	pypiSimpleIndexWait    = 15 * time.Second // max duration a search waits for the simple index
+	pypiMaxLookups         = 5                // max concurrent lookups of latest versions
+)
+
+// pypiNameAffixes are common prefixes and suffixes of project names, with
+// which names related to the query are looked up, e.g. python-dateutil or
+// pytest-flask.
+var pypiNameAffixes = [][2]string{
+	{"python-", ""},
+	{"py", ""},
+	{"pytest-", ""},
+	{"django-", ""},
+	{"flask-", ""},
+	{"", "-python"},
+	{"", "py"},
+}
+
+var errPypiSimpleIndexLoading = errors.New("package index is being loaded, please try again later")
+
+// PypiRegistry resolves packages and versions with the JSON API, which works
+// with pypi.org as well as compatible mirrors such as bandersnatch. As there
+// is no search API, packages are searched by looking up the query and common
+// names related to it. With fullIndex, e.g. for small private mirrors, the
+// whole Simple API (PEP 503/691) index is instead loaded in the background
+// and cached, and searched by substring.
+type PypiRegistry struct {
+	*baseRegistry
+	simplePath string
+	fullIndex  bool
+	names      []string
+	namesTs    time.Time
+	loading    chan struct{} // closed when the simple index is loaded
+	mu         sync.Mutex
+}
+
+func (r *PypiRegistry) Search(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	if r.fullIndex {
+		return r._searchIndex(query, page, size)
+	}
+	return r._searchNames(query, page, size)
+}
+
+// _searchNames looks up the query and names related to it with the JSON API.
+func (r *PypiRegistry) _searchNames(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	// candidate names
+	q := normalizePythonName(strings.TrimSpace(query))
+	if q == "" {
+		return nil, 0, nil
+	}
+	names := []string{q}
+	namesMap := map[string]bool{q: true}
+	for _, a := range pypiNameAffixes {
+		name := normalizePythonName(a[0] + q + a[1])
+		if !namesMap[name] {
+			namesMap[name] = true
+			names = append(names, name)
+		}
+	}
+
+	// lookups
+	results := make([]*models.Dependency, len(names))
+	errs := make([]error, len(names))
+	sem := make(chan struct{}, pypiMaxLookups)
+	wg := sync.WaitGroup{}
+	wg.Add(len(names))
+	for i := range names {
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i], errs[i] = r._lookup(names[i])
+		}(i)
+	}
+	wg.Wait()
+
+	// the exact name must not fail, while related names are best effort
+	if errs[0] != nil {
+		return nil, 0, errs[0]
+	}
+	for _, d := range results {
+		if d != nil {
+			deps = append(deps, *d)
+		}
+	}
+
+	// paginate
+	deps, total = paginatePythonDependencies(deps, q, page, size)
+
+	return deps, total, nil
+}
+
+// _lookup returns the project of the name with the latest version, or nil if
+// it does not exist.
+func (r *PypiRegistry) _lookup(name string) (d *models.Dependency, err error) {
+	// perform request
+	requestUrl := fmt.Sprintf("%s/pypi/%s/json", r.url, url.PathEscape(name))
+	res, err := r._do(http.MethodGet, requestUrl, nil, nil, r.timeout)
+	if err != nil {
+		return nil, err
+	}
+	switch res.Response().StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("request %s failed: %s", requestUrl, res.Response().Status)))
+	}
+
+	// response
+	var detail entity.PypiProjectDetail
+	if err := res.ToJSON(&detail); err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	return &models.Dependency{
+		Name:          detail.Info.Name,
+		LatestVersion: detail.Info.Version,
+		Description:   detail.Info.Summary,
+	}, nil
+}
+
+// _searchIndex searches names in the simple index by substring.
+func (r *PypiRegistry) _searchIndex(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	// project names
+	names, err := r._getProjectNames()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// matched names
+	q := normalizePythonName(query)
+	for _, name := range names {
+		if strings.Contains(normalizePythonName(name), q) {
+			deps = append(deps, models.Dependency{Name: name})
+		}
+	}
+
+	// paginate
+	deps, total = paginatePythonDependencies(deps, q, page, size)
+
+	// latest versions
+	sem := make(chan struct{}, pypiMaxLookups)
+	wg := sync.WaitGroup{}
+	wg.Add(len(deps))
+	for i := range deps {
+		go func(i int) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			v, err := r.GetLatestVersion(deps[i].Name)
+			if err == nil {
+				deps[i].LatestVersion = v
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	return deps, total, nil
+}
+
+func (r *PypiRegistry) GetLatestVersion(name string) (v string, err error) {
+	// request url
+	requestUrl := fmt.Sprintf("%s/pypi/%s/json", r.url, url.PathEscape(name))
+
+	// perform request
+	res, err := r._get(requestUrl, nil)
+	if err != nil {
+		return "", err
+	}
+
+	// response
+	var detail entity.PypiProjectDetail
+	if err := res.ToJSON(&detail); err != nil {
+		return "", trace.TraceError(err)
+	}
+
+	return detail.Info.Version, nil
+}
+
+func (r *PypiRegistry) GetVersions(name string) (versions []string, err error) {
+	// request url
+	requestUrl := fmt.Sprintf("%s/pypi/%s/json", r.url, url.PathEscape(name))
+
+	// perform request
+	res, err := r._get(requestUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// response
+	var detail entity.PypiProjectDetail
+	if err := res.ToJSON(&detail); err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	for v := range detail.Releases {
+		versions = append(versions, v)
+	}
+	sortVersionsDesc(versions, comparePythonVersions)
+
+	return versions, nil
+}
+
+// _getProjectNames returns project names in the cached simple index. The
+// index is loaded in the background if it is not cached or expired, and the
+// search waits for it if it is not cached yet.
+func (r *PypiRegistry) _getProjectNames() (names []string, err error) {
+	r.mu.Lock()
+
+	// cached
+	if r.names != nil && time.Since(r.namesTs) < pypiSimpleIndexTtl {
+		names = r.names
+		r.mu.Unlock()
+		return names, nil
+	}
+
+	// load in the background
+	if r.loading == nil {
+		r.loading = make(chan struct{})
+		go r._loadProjectNames(r.loading)
+	}
+	loading := r.loading
+
+	// expired index is served while loading
+	if r.names != nil {
+		names = r.names
+		r.mu.Unlock()
+		return names, nil
+	}
+	r.mu.Unlock()
+
+	// wait for the index
+	select {
+	case <-loading:
+	case <-time.After(pypiSimpleIndexWait):
+		return nil, trace.TraceError(errPypiSimpleIndexLoading)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names == nil {
+		return nil, trace.TraceError(errors.New("failed to load package index"))
+	}
+	return r.names, nil
+}
+
+func (r *PypiRegistry) _loadProjectNames(loading chan struct{}) {
+	defer close(loading)
+
+	names, err := r._fetchProjectNames()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.loading = nil
+	if err != nil {
+		trace.PrintError(err)
+		return
+	}
+	r.names = names
+	r.namesTs = time.Now()
+}
+
+// _fetchProjectNames downloads the simple index, which lists all projects.
+func (r *PypiRegistry) _fetchProjectNames() (names []string, err error) {
+	// request simple index, preferring json (PEP 691) over html
+	requestUrl := fmt.Sprintf("%s/%s/", r.url, r.simplePath)
+	res, err := r._request(http.MethodGet, requestUrl, req.Header{
+		"Accept": "application/vnd.pypi.simple.v1+json, text/html;q=0.1",
+	}, nil, pypiSimpleIndexTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.Contains(res.Response().Header.Get("Content-Type"), "json") {
+		// json
+		var index entity.PypiSimpleIndex
+		if err := res.ToJSON(&index); err != nil {
+			return nil, trace.TraceError(err)
+		}
+		for _, p := range index.Projects {
+			names = append(names, p.Name)
+		}
+	} else {
+		// html
+		data, err := res.ToBytes()
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		doc, err := goquery.NewDocumentFromReader(bytes.NewBuffer(data))
+		if err != nil {
+			return nil, trace.TraceError(err)
+		}
+		doc.Find("a").Each(func(i int, s *goquery.Selection) {
+			names = append(names, strings.TrimSpace(s.Text()))
+		})
+	}
+
+	return names, nil
+}
+
+// DevpiRegistry talks to devpi indexes, e.g. http://devpi:3141/root/pypi,
+// which expose the Simple API under "+simple" and release data as json
+// on the project url. Packages are searched with the search of devpi-web,
+// which is served by the XML-RPC "search" method on the index url.
+type DevpiRegistry struct {
+	*PypiRegistry
+}
+
+func (r *DevpiRegistry) Search(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	// request body
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(query))
+	body := fmt.Sprintf(`<?xml version="1.0"?><methodCall><methodName>search</methodName><params><param><value><struct><member><name>name</name><value><string>%s</string></value></member></struct></value></param><param><value><string>or</string></value></param></params></methodCall>`, buf.String())
+
+	// perform request
+	res, err := r._post(r.url+"/", req.Header{"Content-Type": "text/xml"}, body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// response
+	var searchRes entity.PypiXmlRpcSearchResponse
+	if err := xml.Unmarshal(res.Bytes(), &searchRes); err != nil {
+		return nil, 0, trace.TraceError(err)
+	}
+	if searchRes.Fault != nil {
+		return nil, 0, trace.TraceError(errors.New(fmt.Sprintf("search failed: %s", getPypiXmlRpcValue(*searchRes.Fault, "faultString"))))
+	}
+
+	// dependencies with the latest versions
+	q := normalizePythonName(query)
+	depsMap := map[string]int{}
+	for _, result := range searchRes.Results {
+		name := getPypiXmlRpcValue(result, "name")
+		version := getPypiXmlRpcValue(result, "version")
+		key := normalizePythonName(name)
+		if !strings.Contains(key, q) {
+			continue
+		}
+		if i, ok := depsMap[key]; ok {
+			if res, ok := comparePythonVersions(version, deps[i].LatestVersion); ok && res > 0 {
+				deps[i].LatestVersion = version
+			}
+			continue
+		}
+		depsMap[key] = len(deps)
+		deps = append(deps, models.Dependency{
+			Name:          name,
+			LatestVersion: version,
+		})
+	}
+
+	// paginate
+	deps, total = paginatePythonDependencies(deps, q, page, size)
+
+	return deps, total, nil
+}
+
+func getPypiXmlRpcValue(s entity.PypiXmlRpcStruct, name string) string {
+	for _, m := range s.Members {
+		if m.Name != name {
+			continue
+		}
+		if m.Value.String != "" {
+			return m.Value.String
+		}
+		return strings.TrimSpace(m.Value.Text)
+	}
+	return ""
+}
+
+func (r *DevpiRegistry) GetLatestVersion(name string) (v string, err error) {
+	// request url
+	requestUrl := fmt.Sprintf("%s/%s", r.url, url.PathEscape(name))
+
+	// perform request
+	res, err := r._get(requestUrl, req.Header{"Accept": "application/json"})
+	if err != nil {
+		return "", err
+	}
+
+	// response
+	var detail entity.DevpiProjectDetail
+	if err := res.ToJSON(&detail); err != nil {
+		return "", trace.TraceError(err)
+	}
+
+	// latest version
+	var versions []string
+	for version := range detail.Result {
+		versions = append(versions, version)
+	}
+	if len(versions) == 0 {
+		return "", trace.TraceError(errors.New(fmt.Sprintf("no releases found for %s", name)))
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		res, ok := comparePythonVersions(versions[i], versions[j])
+		if !ok {
+			return versions[i] < versions[j]
+		}
+		return res < 0
+	})
+
+	// prefer the latest final release, as pypi does
+	for i := len(versions) - 1; i >= 0; i-- {
+		v, err := parsePythonVersion(versions[i])
+		if err == nil && !v.isPrerelease() {
+			return versions[i], nil
+		}
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+func (r *DevpiRegistry) GetVersions(name string) (versions []string, err error) {
+	// request url
+	requestUrl := fmt.Sprintf("%s/%s", r.url, url.PathEscape(name))
+
+	// perform request
+	res, err := r._get(requestUrl, req.Header{"Accept": "application/json"})
+	if err != nil {
+		return nil, err
+	}
+
+	// response
+	var detail entity.DevpiProjectDetail
+	if err := res.ToJSON(&detail); err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	for v := range detail.Result {
+		versions = append(versions, v)
+	}
+	sortVersionsDesc(versions, comparePythonVersions)
+
+	return versions, nil
+}
+
+// NexusPypiRegistry talks to PyPI repositories of Nexus Repository Manager,
+// e.g. http://nexus:8081/repository/pypi-proxy, which expose the Simple API
+// under "simple" and the JSON API under "pypi". Packages are searched with
+// the search API of Nexus.
+type NexusPypiRegistry struct {
+	*PypiRegistry
+}
+
+// nexusMaxSearchPages is the max number of pages of components to search,
+// as the search API returns components of all versions.
+const nexusMaxSearchPages = 10
+
+func (r *NexusPypiRegistry) Search(query string, page, size int) (deps []models.Dependency, total int, err error) {
+	// nexus url and repository name
+	idx := strings.LastIndex(r.url, "/repository/")
+	if idx < 0 {
+		return nil, 0, trace.TraceError(errors.New(fmt.Sprintf("invalid nexus repository url: %s", r.url)))
+	}
+	nexusUrl := r.url[:idx]
+	repository := strings.Trim(r.url[idx+len("/repository/"):], "/")
+
+	// components of all pages
+	q := normalizePythonName(query)
+	depsMap := map[string]int{}
+	continuationToken := ""
+	for i := 0; i < nexusMaxSearchPages; i++ {
+		// request url
+		params := url.Values{}
+		params.Set("repository", repository)
+		params.Set("format", "pypi")
+		params.Set("q", query)
+		if continuationToken != "" {
+			params.Set("continuationToken", continuationToken)
+		}
+		requestUrl := fmt.Sprintf("%s/service/rest/v1/search?%s", nexusUrl, params.Encode())
+
+		// perform request
+		res, err := r._get(requestUrl, req.Header{"Accept": "application/json"})
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// response
+		var searchRes entity.NexusSearchResult
+		if err := res.ToJSON(&searchRes); err != nil {
+			return nil, 0, trace.TraceError(err)
+		}
+
+		// dependencies with the latest versions
+		for _, c := range searchRes.Items {
+			key := normalizePythonName(c.Name)
+			if !strings.Contains(key, q) {
+				continue
+			}
+			if i, ok := depsMap[key]; ok {
+				if res, ok := comparePythonVersions(c.Version, deps[i].LatestVersion); ok && res > 0 {
+					deps[i].LatestVersion = c.Version
+				}
+				continue
+			}
+			depsMap[key] = len(deps)
+			deps = append(deps, models.Dependency{
+				Name:          c.Name,
+				LatestVersion: c.Version,
+			})
+		}
+
+		// next page
+		continuationToken = searchRes.ContinuationToken
+		if continuationToken == "" {
+			break
+		}
+	}
+
+	// paginate
+	deps, total = paginatePythonDependencies(deps, q, page, size)
+
+	return deps, total, nil
+}
+
+// paginatePythonDependencies returns the page of dependencies matched by the
+// normalized query, where exact and prefix matches come first.
+func paginatePythonDependencies(deps []models.Dependency, q string, page, size int) (res []models.Dependency, total int) {
+	sort.SliceStable(deps, func(i, j int) bool {
+		return _getPythonNameRank(deps[i].Name, q) < _getPythonNameRank(deps[j].Name, q)
+	})
+
+	total = len(deps)
+	start := (page - 1) * size
+	if start >= total {
+		return nil, total
+	}
+	end := start + size
+	if end > total {
+		end = total
+	}
+	return deps[start:end], total
+}
+
+var pythonNameSeparatorRegex = regexp.MustCompile("[-_.]+")
+
+// normalizePythonName normalizes a python project name as per PEP 503.
+func normalizePythonName(name string) string {
+	return strings.ToLower(pythonNameSeparatorRegex.ReplaceAllString(name, "-"))
+}
+
+func _getPythonNameRank(name, q string) int {
+	n := normalizePythonName(name)
+	if n == q {
+		return 0
+	}
+	if strings.HasPrefix(n, q) {
+		return 1
+	}
+	return 2
+}
+
+func NewPypiRegistry(url, username, password string) (r *PypiRegistry) {
+	if url == "" {
+		url = constants.DefaultRegistryUrlPypi
+	}
+	return &PypiRegistry{
+		baseRegistry: newBaseRegistry(url, username, password),
+		simplePath:   "simple",
+	}
+}
+
+// NewPypiSimpleRegistry creates a registry which searches the whole simple
+// index by substring, which is only affordable for small private mirrors.
+func NewPypiSimpleRegistry(url, username, password string) (r *PypiRegistry) {
+	r = NewPypiRegistry(url, username, password)
+	r.fullIndex = true
+	return r
+}
+
+func NewNexusPypiRegistry(url, username, password string) (r *NexusPypiRegistry) {
+	return &NexusPypiRegistry{
+		PypiRegistry: NewPypiRegistry(url, username, password),
+	}
+}
+
+func NewDevpiRegistry(url, username, password string) (r *DevpiRegistry) {
+	r = &DevpiRegistry{
+		PypiRegistry: NewPypiRegistry(url, username, password),
+	}
+	r.simplePath = "+simple"
+	return r
+}
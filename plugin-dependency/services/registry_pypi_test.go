@@ -0,0 +1,141 @@
+package services
+
+import (
+	"fmt"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func getDependencyNamesAndVersions(deps []models.Dependency) (res []string) {
+	for _, d := range deps {
+		res = append(res, d.Name+"@"+d.LatestVersion)
+	}
+	return res
+}
+
+func TestPypiRegistry_Search(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/simple/":
+			w.Header().Set("Content-Type", "application/vnd.pypi.simple.v1+json")
+			_, _ = w.Write([]byte(`{"projects": [{"name": "flask-cors"}, {"name": "Flask"}, {"name": "requests"}, {"name": "pytest-flask"}]}`))
+		case strings.HasPrefix(r.URL.Path, "/pypi/"):
+			name := strings.Split(r.URL.Path, "/")[2]
+			_, _ = w.Write([]byte(fmt.Sprintf(`{"info": {"name": "%s", "version": "1.0"}}`, name)))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	r := NewPypiSimpleRegistry(svr.URL, "", "")
+	deps, total, err := r.Search("flask", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 3 {
+		t.Errorf("expected total 3, got %d", total)
+	}
+	expected := []string{"Flask@1.0", "flask-cors@1.0"}
+	if res := getDependencyNamesAndVersions(deps); !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v", expected, res)
+	}
+}
+
+func TestPypiRegistry_SearchNames(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/simple/":
+			t.Error("unexpected request of the simple index")
+		case "/pypi/dateutil/json":
+			w.WriteHeader(http.StatusNotFound)
+		case "/pypi/python-dateutil/json":
+			_, _ = w.Write([]byte(`{"info": {"name": "python-dateutil", "version": "2.9.0", "summary": "Extensions to datetime"}}`))
+		case "/pypi/pytest-dateutil/json":
+			_, _ = w.Write([]byte(`{"info": {"name": "pytest-dateutil", "version": "0.1"}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer svr.Close()
+
+	r := NewPypiRegistry(svr.URL, "", "")
+	deps, total, err := r.Search("dateutil", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"python-dateutil@2.9.0", "pytest-dateutil@0.1"}
+	if res := getDependencyNamesAndVersions(deps); total != 2 || !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v (total %d)", expected, res, total)
+	}
+	if deps[0].Description != "Extensions to datetime" {
+		t.Errorf("unexpected description %s", deps[0].Description)
+	}
+
+	// failed lookup of the exact name
+	r = NewPypiRegistry(svr.URL, "", "")
+	svr.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	if _, _, err := r.Search("dateutil", 1, 10); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestDevpiRegistry_Search(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.Method != http.MethodPost || r.URL.Path != "/root/pypi/" || !strings.Contains(string(body), "<string>flask</string>") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`<?xml version="1.0"?>
+<methodResponse><params><param><value><array><data>
+<value><struct><member><name>name</name><value><string>flask-cors</string></value></member><member><name>version</name><value><string>4.0.0</string></value></member></struct></value>
+<value><struct><member><name>name</name><value>Flask</value></member><member><name>version</name><value>2.3.0</value></member></struct></value>
+<value><struct><member><name>name</name><value>Flask</value></member><member><name>version</name><value>3.0.0</value></member></struct></value>
+</data></array></value></param></params></methodResponse>`))
+	}))
+	defer svr.Close()
+
+	r := NewDevpiRegistry(svr.URL+"/root/pypi", "", "")
+	deps, total, err := r.Search("flask", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Flask@3.0.0", "flask-cors@4.0.0"}
+	if res := getDependencyNamesAndVersions(deps); total != 2 || !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v (total %d)", expected, res, total)
+	}
+}
+
+func TestNexusPypiRegistry_Search(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/service/rest/v1/search" || q.Get("repository") != "pypi-proxy" || q.Get("format") != "pypi" || q.Get("q") != "flask" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if q.Get("continuationToken") == "" {
+			_, _ = w.Write([]byte(`{"items": [{"name": "Flask", "version": "2.3.0"}, {"name": "flask-cors", "version": "4.0.0"}], "continuationToken": "next"}`))
+		} else {
+			_, _ = w.Write([]byte(`{"items": [{"name": "Flask", "version": "3.0.0"}], "continuationToken": null}`))
+		}
+	}))
+	defer svr.Close()
+
+	r := NewNexusPypiRegistry(svr.URL+"/repository/pypi-proxy/", "", "")
+	deps, total, err := r.Search("flask", 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"Flask@3.0.0", "flask-cors@4.0.0"}
+	if res := getDependencyNamesAndVersions(deps); total != 2 || !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v (total %d)", expected, res, total)
+	}
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/robfig/cron/v3"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sync"
+)
+
+// ScheduleService runs jobs scheduled by cron expressions of settings,
+// i.e. periodic updates of dependency lists and drift checks, as well as
+// the reaper of stale tasks and the cleanup of tasks beyond retention.
+type ScheduleService struct {
+	parent   *Service
+	cron     *cron.Cron
+	entryIds []cron.EntryID
+	mu       sync.Mutex
+}
+
+func (svc *ScheduleService) Start() {
+	svc.cron.Start()
+	if _, err := svc.cron.AddFunc(fmt.Sprintf("@every %ds", constants.TaskReaperInterval), svc.parent.taskSvc._reap); err != nil {
+		trace.PrintError(err)
+	}
+	if _, err := svc.cron.AddFunc(fmt.Sprintf("@every %ds", constants.TaskCleanupInterval), svc.parent.taskSvc._cleanup); err != nil {
+		trace.PrintError(err)
+	}
+	if err := svc.reload(); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+func (svc *ScheduleService) Stop() {
+	svc.cron.Stop()
+}
+
+// reload schedules jobs of enabled settings, replacing the ones scheduled
+// before.
+func (svc *ScheduleService) reload() (err error) {
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+
+	// remove scheduled jobs
+	for _, id := range svc.entryIds {
+		svc.cron.Remove(id)
+	}
+	svc.entryIds = nil
+
+	// settings
+	var settings []models.Setting
+	if err := svc.parent.colS.Find(bson.M{"enabled": true}, nil).All(&settings); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			return nil
+		}
+		return trace.TraceError(err)
+	}
+
+	// schedule jobs
+	for _, s := range settings {
+		key := s.Key
+		depSvc, err := svc.parent._getDependencyService(key)
+		if err != nil {
+			continue
+		}
+
+		// update of dependency lists and latest versions
+		svc._add(key, "update", s.UpdateCron, func() {
+			if err := depSvc._update(); err != nil {
+				trace.PrintError(err)
+			}
+		})
+
+		// drift check
+		svc._add(key, "drift check", s.DriftCheckCron, func() {
+			if _, err := svc.parent.driftSvc._check(key); err != nil {
+				trace.PrintError(err)
+			}
+		})
+	}
+
+	return nil
+}
+
+func (svc *ScheduleService) _add(key, name, spec string, fn func()) {
+	if spec == "" {
+		return
+	}
+	id, err := svc.cron.AddFunc(spec, fn)
+	if err != nil {
+		trace.PrintError(errors.New(fmt.Sprintf("invalid %s cron of %s: %v", name, key, err)))
+		return
+	}
+	svc.entryIds = append(svc.entryIds, id)
+}
+
+// validateCron validates a cron expression of settings, which is empty if
+// the job is disabled.
+func validateCron(name, spec string) (err error) {
+	if spec == "" {
+		return nil
+	}
+	if _, err := cron.ParseStandard(spec); err != nil {
+		return errors.New(fmt.Sprintf("invalid %s cron: %v", name, err))
+	}
+	return nil
+}
+
+func NewScheduleService(parent *Service) (svc *ScheduleService) {
+	svc = &ScheduleService{
+		parent: parent,
+		cron:   cron.New(),
+	}
+	return svc
+}
@@ -1,11 +1,12 @@
 package services
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/cenkalti/backoff/v4"
+	constants2 "github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/interfaces"
 	models2 "github.com/crawlab-team/crawlab-core/models/models"
 	"github.com/crawlab-team/crawlab-core/node/config"
@@ -25,6 +26,7 @@ import (
 	"os/exec"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -36,26 +38,57 @@ type Service struct {
 	colD        *mongo2.Col // dependencies
 	colT        *mongo2.Col // dependency tasks
 	colL        *mongo2.Col // dependency logs
+	colSn       *mongo2.Col // dependency snapshots
 	cfgSvc      interfaces.NodeConfigService
 	currentNode interfaces.Node
 	masterNode  interfaces.Node
 	msgStream   grpc.MessageService_ConnectClient
+	msgStreamMu sync.Mutex // guards sending to and replacing msgStream
 
 	// sub services
-	settingSvc *SettingService
-	taskSvc    *TaskService
-	pythonSvc  *PythonService
-	nodeSvc    *NodeService
-	spiderSvc  *SpiderService
+	settingSvc  *SettingService
+	taskSvc     *TaskService
+	spiderSvc   *SpiderService
+	snapshotSvc *SnapshotService
+	driftSvc    *DriftService
+	policySvc   *PolicyService
+	scheduleSvc *ScheduleService
+
+	// dependency services in order of registration
+	depSvcs   []*baseService
+	depSvcMap map[string]*baseService
+
+	// stream message handlers keyed by message code
+	msgHandlers map[string]messageHandler
+
+	// contexts of running tasks on the current node keyed by task id
+	taskCtxMap sync.Map
+
+	// notifications of log streams
+	logBroker *logBroker
+}
+
+type messageHandler func(msg *grpc.StreamMessage, msgData entity.MessageData)
+
+type taskContext struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	seq    int64 // sequence number of the last log line
 }
 
 func (svc *Service) Init() (err error) {
+	// initialize dependency services
+	for _, depSvc := range svc.depSvcs {
+		depSvc.svc.Init()
+	}
+
 	// initialize sub services
 	svc.settingSvc.Init()
 	svc.taskSvc.Init()
-	svc.pythonSvc.Init()
-	svc.nodeSvc.Init()
 	svc.spiderSvc.Init()
+	svc.snapshotSvc.Init()
+	svc.driftSvc.Init()
+	svc.policySvc.Init()
 
 	return nil
 }
@@ -75,8 +108,13 @@ func (svc *Service) Start() (err error) {
 		// start api
 		go svc.StartApi()
 
-		// start python service
-		go svc.pythonSvc.Start()
+		// start dependency services
+		for _, depSvc := range svc.depSvcs {
+			go depSvc.Start()
+		}
+
+		// start scheduled jobs
+		go svc.scheduleSvc.Start()
 	}
 
 	// get current node
@@ -99,42 +137,82 @@ func (svc *Service) Start() (err error) {
 }
 
 func (svc *Service) Stop() (err error) {
+	svc.scheduleSvc.Stop()
 	svc.StopApi()
 	return nil
 }
 
 func (svc *Service) initData() (err error) {
-	total, err := svc.colS.Count(nil)
-	if err != nil {
-		return err
-	}
-	if total > 0 {
-		return nil
-	}
-
 	// data to initialize
 	settings := []models.Setting{
 		{
-			Id:          primitive.NewObjectID(),
-			Key:         constants.DependencyTypePython,
-			Name:        "Python",
-			Description: "settings.description.python",
-			Cmd:         "pip",
-			Enabled:     true,
+			Id:            primitive.NewObjectID(),
+			Key:           constants.DependencyTypePython,
+			Name:          "Python",
+			Description:   "settings.description.python",
+			Cmd:           "pip",
+			Enabled:       true,
+			IsolationMode: constants.IsolationModeGlobal,
+			RegistryType:  constants.RegistryTypePypi,
+			RegistryUrl:   constants.DefaultRegistryUrlPypi,
+		},
+		{
+			Id:            primitive.NewObjectID(),
+			Key:           constants.DependencyTypeNode,
+			Name:          "Node.js",
+			Cmd:           "npm",
+			Description:   "settings.description.node",
+			Enabled:       true,
+			IsolationMode: constants.IsolationModeGlobal,
+			RegistryType:  constants.RegistryTypeNpm,
+			RegistryUrl:   constants.DefaultRegistryUrlNpm,
+		},
+		{
+			Id:           primitive.NewObjectID(),
+			Key:          constants.DependencyTypeGo,
+			Name:         "Go",
+			Cmd:          "go",
+			Description:  "settings.description.go",
+			Enabled:      true,
+			RegistryType: constants.RegistryTypeGoproxy,
+			RegistryUrl:  constants.DefaultRegistryUrlGoproxy,
 		},
 		{
 			Id:          primitive.NewObjectID(),
-			Key:         constants.DependencyTypeNode,
-			Name:        "Node.js",
-			Cmd:         "npm",
-			Description: "settings.description.node",
+			Key:         constants.DependencyTypeSystem,
+			Name:        "System",
+			Cmd:         "apt-get",
+			Description: "settings.description.system",
 			Enabled:     true,
 		},
+		{
+			Id:           primitive.NewObjectID(),
+			Key:          constants.DependencyTypeMaven,
+			Name:         "Maven",
+			Cmd:          "mvn",
+			Description:  "settings.description.maven",
+			Enabled:      true,
+			RegistryType: constants.RegistryTypeMaven,
+			RegistryUrl:  constants.DefaultRegistryUrlMaven,
+		},
 	}
+
+	// only add settings that do not exist yet, so that dependency types
+	// added in newer versions are initialized for existing installations
 	var data []interface{}
 	for _, s := range settings {
+		total, err := svc.colS.Count(bson.M{"key": s.Key})
+		if err != nil {
+			return err
+		}
+		if total > 0 {
+			continue
+		}
 		data = append(data, s)
 	}
+	if len(data) == 0 {
+		return nil
+	}
 	_, err = svc.colS.InsertMany(data)
 	if err != nil {
 		return err
@@ -157,28 +235,50 @@ func (svc *Service) initIndexes() (err error) {
 		},
 	})
 
-	// tasks
-	optsColT := &options.IndexOptions{}
-	optsColT.SetExpireAfterSeconds(60 * 60 * 24)
+	// tasks, which were deleted by ttl indexes before retention is
+	// configurable in settings
+	_ = svc.colT.DeleteIndex("update_ts_1")
 	_ = svc.colT.CreateIndexes([]mongo.IndexModel{
-		{
-			Keys: bson.D{
-				{"update_ts", 1},
-			},
-			Options: optsColT,
-		},
+		{Keys: bson.D{{"update_ts", 1}}},
+		{Keys: bson.D{{"type", 1}, {"status", 1}}},
+		{Keys: bson.D{{"node_id", 1}}},
+		{Keys: bson.D{{"dep_names", 1}}},
+		{Keys: bson.D{{"action", 1}}},
 	})
 
 	// logs
-	optsColL := &options.IndexOptions{}
-	optsColL.SetExpireAfterSeconds(60 * 60 * 24)
+	_ = svc.colL.DeleteIndex("update_ts_1")
 	_ = svc.colL.CreateIndexes([]mongo.IndexModel{
 		{
 			Keys: bson.D{{"task_id", 1}},
 		},
 		{
-			Keys:    bson.D{{"update_ts", 1}},
-			Options: optsColL,
+			Keys: bson.D{{"task_id", 1}, {"seq", 1}},
+		},
+	})
+
+	// task archives
+	_ = svc.taskSvc.colA.CreateIndexes([]mongo.IndexModel{
+		{Keys: bson.D{{"task.type", 1}, {"task.status", 1}}},
+		{Keys: bson.D{{"task.node_id", 1}}},
+		{Keys: bson.D{{"task.dep_names", 1}}},
+		{Keys: bson.D{{"task.action", 1}}},
+	})
+
+	// policy audits
+	_ = svc.policySvc.col.CreateIndexes([]mongo.IndexModel{
+		{Keys: bson.D{{"type", 1}}},
+		{Keys: bson.D{{"create_ts", 1}}},
+	})
+
+	// snapshots
+	_ = svc.colSn.CreateIndexes([]mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{"type", 1},
+				{"node_id", 1},
+				{"version", -1},
+			},
 		},
 	})
 
@@ -211,30 +311,12 @@ func (svc *Service) handleStreamMessages() {
 			continue
 		}
 
-		switch msgData.Code {
-		case constants.MessageCodeUpdateTask:
-			go svc.updateTask(msg, msgData)
-		case constants.MessageCodeInsertLogs:
-			go svc.insertLogs(msg, msgData)
-
-		case constants.MessageCodePythonUpdate:
-			go svc.pythonSvc.updateDependencyList(msg, msgData)
-		case constants.MessageCodePythonSave:
-			go svc.pythonSvc._saveDependencyList(msg, msgData)
-		case constants.MessageCodePythonInstall:
-			go svc.pythonSvc.installDependency(msg, msgData)
-		case constants.MessageCodePythonUninstall:
-			go svc.pythonSvc.uninstallDependency(msg, msgData)
-
-		case constants.MessageCodeNodeUpdate:
-			go svc.nodeSvc.updateDependencyList(msg, msgData)
-		case constants.MessageCodeNodeSave:
-			go svc.nodeSvc._saveDependencyList(msg, msgData)
-		case constants.MessageCodeNodeInstall:
-			go svc.nodeSvc.installDependency(msg, msgData)
-		case constants.MessageCodeNodeUninstall:
-			go svc.nodeSvc.uninstallDependency(msg, msgData)
+		// handler
+		handler, ok := svc.msgHandlers[msgData.Code]
+		if !ok {
+			continue
 		}
+		go handler(msg, msgData)
 	}
 }
 
@@ -258,7 +340,9 @@ func (svc *Service) _connect() (err error) {
 	if err := stream.Send(msg); err != nil {
 		return err
 	}
+	svc.msgStreamMu.Lock()
 	svc.msgStream = stream
+	svc.msgStreamMu.Unlock()
 	return nil
 }
 
@@ -305,14 +389,28 @@ func (svc *Service) updateTask(msg *grpc.StreamMessage, msgData entity.MessageDa
 	}
 	update := bson.M{
 		"$set": bson.M{
-			"status": taskMsg.Status,
-			"error":  taskMsg.Error,
+			"status":    taskMsg.Status,
+			"error":     taskMsg.Error,
+			"update_ts": time.Now(),
 		},
 	}
-	if err := svc.colT.UpdateId(taskMsg.TaskId, update); err != nil {
+	if taskMsg.Result != nil {
+		update["$set"].(bson.M)["result"] = taskMsg.Result
+	}
+	if taskMsg.LastLogSeq > 0 {
+		update["$set"].(bson.M)["last_log_seq"] = taskMsg.LastLogSeq
+	}
+
+	// only running tasks are updated, so that a task which has finished is
+	// not overwritten by a late status, e.g. cancelled after it finished
+	if err := svc.colT.Update(bson.M{
+		"_id":    taskMsg.TaskId,
+		"status": constants2.TaskStatusRunning,
+	}, update); err != nil {
 		trace.PrintError(err)
 		return
 	}
+	svc.logBroker.notify(taskMsg.TaskId)
 }
 
 func (svc *Service) insertLogs(msg *grpc.StreamMessage, msgData entity.MessageData) {
@@ -321,62 +419,290 @@ func (svc *Service) insertLogs(msg *grpc.StreamMessage, msgData entity.MessageDa
 		trace.PrintError(err)
 		return
 	}
-	l := &models.Log{
-		Id:       primitive.NewObjectID(),
-		TaskId:   logsMsg.TaskId,
-		Content:  strings.Join(logsMsg.Lines, "\n"),
-		UpdateTs: time.Now(),
+	var docs []interface{}
+	for _, line := range logsMsg.Logs {
+		docs = append(docs, &models.Log{
+			Id:       primitive.NewObjectID(),
+			TaskId:   logsMsg.TaskId,
+			Stream:   line.Stream,
+			Seq:      line.Seq,
+			Content:  line.Content,
+			Ts:       line.Ts,
+			UpdateTs: time.Now(),
+		})
+	}
+	if len(logsMsg.Lines) > 0 {
+		docs = append(docs, &models.Log{
+			Id:       primitive.NewObjectID(),
+			TaskId:   logsMsg.TaskId,
+			Content:  strings.Join(logsMsg.Lines, "\n"),
+			Ts:       time.Now(),
+			UpdateTs: time.Now(),
+		})
+	}
+	if len(docs) == 0 {
+		return
+	}
+	if _, err := svc.colL.InsertMany(docs); err != nil {
+		trace.PrintError(err)
+		return
+	}
+	svc.logBroker.notify(logsMsg.TaskId)
+}
+
+// cancelTask cancels the running task on the current node, which kills the
+// processes of the task.
+func (svc *Service) cancelTask(msg *grpc.StreamMessage, msgData entity.MessageData) {
+	var taskMsg entity.TaskMessage
+	if err := json.Unmarshal(msgData.Data, &taskMsg); err != nil {
+		trace.PrintError(err)
+		return
+	}
+
+	// mark as cancelled if the task is not running, e.g. lost after restart
+	res, ok := svc.taskCtxMap.Load(taskMsg.TaskId)
+	if !ok {
+		svc._sendTaskStatus(taskMsg.TaskId, constants2.TaskStatusCancelled, nil)
+		return
+	}
+
+	// cancel
+	tc, _ := res.(*taskContext)
+	tc.cancel()
+}
+
+// ackTask records the acknowledgement of a task by the node running it.
+func (svc *Service) ackTask(msg *grpc.StreamMessage, msgData entity.MessageData) {
+	var taskMsg entity.TaskMessage
+	if err := json.Unmarshal(msgData.Data, &taskMsg); err != nil {
+		trace.PrintError(err)
+		return
+	}
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"ack_ts":       now,
+			"heartbeat_ts": now,
+		},
 	}
-	if _, err := svc.colL.Insert(l); err != nil {
+	if err := svc.colT.UpdateId(taskMsg.TaskId, update); err != nil {
 		trace.PrintError(err)
 		return
 	}
 }
 
+// heartbeatTask records the last heartbeat of a task from the node running
+// it.
+func (svc *Service) heartbeatTask(msg *grpc.StreamMessage, msgData entity.MessageData) {
+	var taskMsg entity.TaskMessage
+	if err := json.Unmarshal(msgData.Data, &taskMsg); err != nil {
+		trace.PrintError(err)
+		return
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"heartbeat_ts": time.Now(),
+		},
+	}
+	if err := svc.colT.UpdateId(taskMsg.TaskId, update); err != nil {
+		trace.PrintError(err)
+		return
+	}
+}
+
+// updateTaskVersions records versions of dependencies before and after the
+// task.
+func (svc *Service) updateTaskVersions(msg *grpc.StreamMessage, msgData entity.MessageData) {
+	var taskMsg entity.TaskMessage
+	if err := json.Unmarshal(msgData.Data, &taskMsg); err != nil {
+		trace.PrintError(err)
+		return
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"before_versions": taskMsg.BeforeVersions,
+			"after_versions":  taskMsg.AfterVersions,
+		},
+	}
+	if err := svc.colT.UpdateId(taskMsg.TaskId, update); err != nil {
+		trace.PrintError(err)
+		return
+	}
+}
+
+// _keepTaskAlive acknowledges the task to the master node and sends
+// heartbeats until the task context is done.
+func (svc *Service) _keepTaskAlive(ctx context.Context, taskId primitive.ObjectID) {
+	// acknowledgement
+	svc._sendTaskMessage(constants.MessageCodeAckTask, &entity.TaskMessage{TaskId: taskId})
+
+	// heartbeats
+	ticker := time.NewTicker(constants.TaskHeartbeatInterval * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			svc._sendTaskMessage(constants.MessageCodeHeartbeatTask, &entity.TaskMessage{TaskId: taskId})
+		}
+	}
+}
+
+// _newTaskContext creates the context of a task running on the current node,
+// which is done when the task is cancelled or times out.
+func (svc *Service) _newTaskContext(taskId primitive.ObjectID, timeout time.Duration) (ctx context.Context) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	svc.taskCtxMap.Store(taskId, &taskContext{ctx: ctx, cancel: cancel})
+	return ctx
+}
+
+// _deleteTaskContext releases the context of a finished task.
+func (svc *Service) _deleteTaskContext(taskId primitive.ObjectID) {
+	res, ok := svc.taskCtxMap.Load(taskId)
+	if !ok {
+		return
+	}
+	tc, _ := res.(*taskContext)
+	tc.cancel()
+	svc.taskCtxMap.Delete(taskId)
+}
+
+// _runTaskCmd runs the command of the task and waits for it to exit. The
+// command is killed along with its child processes if the task is cancelled
+// or times out.
+func (svc *Service) _runTaskCmd(taskId primitive.ObjectID, cmd *exec.Cmd) (err error) {
+	// task context
+	ctx := context.Background()
+	if res, ok := svc.taskCtxMap.Load(taskId); ok {
+		tc, _ := res.(*taskContext)
+		ctx = tc.ctx
+	}
+
+	// skip if done before start
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// start
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// wait
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return trace.TraceError(err)
+		}
+		return nil
+	case <-ctx.Done():
+		if err := killProcessGroup(cmd); err != nil {
+			trace.PrintError(err)
+		}
+		<-done
+		return ctx.Err()
+	}
+}
+
+// _sendTaskResult sends the status of the finished task to the master node,
+// which is cancelled if the task has been cancelled, or error if the task
+// has failed or timed out.
+func (svc *Service) _sendTaskResult(ctx context.Context, taskId primitive.ObjectID, err error) {
+	switch {
+	case err == nil:
+		svc._sendTaskStatus(taskId, constants2.TaskStatusFinished, nil)
+	case ctx.Err() == context.Canceled:
+		svc._sendTaskStatus(taskId, constants2.TaskStatusCancelled, nil)
+	case ctx.Err() == context.DeadlineExceeded:
+		svc._sendTaskStatus(taskId, constants2.TaskStatusError, errors.New("timeout"))
+	default:
+		svc._sendTaskStatus(taskId, constants2.TaskStatusError, err)
+	}
+}
+
+// _configureLogging sends lines written by the command to stdout and stderr
+// as logs of the task.
 func (svc *Service) _configureLogging(taskId primitive.ObjectID, cmd *exec.Cmd) {
-	var logLines []string
+	l := newTaskLogger(svc, taskId)
 	stdout, _ := cmd.StdoutPipe()
 	stderr, _ := cmd.StderrPipe()
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 	go func() {
-		scannerStdout := bufio.NewScanner(stdout)
-		for scannerStdout.Scan() {
-			line := scannerStdout.Text()
-			logLines = append(logLines, line)
-			if len(logLines)%10 == 0 && len(logLines) > 0 {
-				svc._sendLogs(taskId, logLines)
-				logLines = []string{}
-			}
-		}
+		l.scan(stdout, constants.LogStreamStdout)
 		wg.Done()
 	}()
 	go func() {
-		scannerStderr := bufio.NewScanner(stderr)
-		for scannerStderr.Scan() {
-			line := scannerStderr.Text()
-			logLines = append(logLines, line)
-			if len(logLines)%10 == 0 && len(logLines) > 0 {
-				svc._sendLogs(taskId, logLines)
-				logLines = []string{}
-			}
-		}
+		l.scan(stderr, constants.LogStreamStderr)
 		wg.Done()
 	}()
+	done := make(chan bool)
 	go func() {
 		wg.Wait()
-		if len(logLines) > 0 {
-			svc._sendLogs(taskId, logLines)
-			logLines = []string{}
+		close(done)
+	}()
+	go func() {
+		ticker := time.NewTicker(taskLogFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				l.flush()
+				return
+			case <-ticker.C:
+				l.flush()
+			}
 		}
 	}()
 }
 
+// _sendLogs sends lines as stdout logs of the task.
 func (svc *Service) _sendLogs(taskId primitive.ObjectID, lines []string) {
+	var logLines []entity.LogLine
+	for _, line := range lines {
+		logLines = append(logLines, entity.LogLine{
+			Stream:  constants.LogStreamStdout,
+			Seq:     svc._nextLogSeq(taskId),
+			Content: line,
+			Ts:      time.Now(),
+		})
+	}
+	svc._sendLogLines(taskId, logLines)
+}
+
+// _nextLogSeq returns the next sequence number of log lines of the task
+// running on the current node.
+func (svc *Service) _nextLogSeq(taskId primitive.ObjectID) (seq int64) {
+	res, ok := svc.taskCtxMap.Load(taskId)
+	if !ok {
+		return 0
+	}
+	tc, _ := res.(*taskContext)
+	return atomic.AddInt64(&tc.seq, 1)
+}
+
+// _getLogSeq returns the sequence number of the last log line of the task
+// running on the current node.
+func (svc *Service) _getLogSeq(taskId primitive.ObjectID) (seq int64) {
+	res, ok := svc.taskCtxMap.Load(taskId)
+	if !ok {
+		return 0
+	}
+	tc, _ := res.(*taskContext)
+	return atomic.LoadInt64(&tc.seq)
+}
+
+func (svc *Service) _sendLogLines(taskId primitive.ObjectID, logLines []entity.LogLine) {
 	// logs message
 	logsMsg := &entity.LogsMessage{
 		TaskId: taskId,
-		Lines:  lines,
+		Logs:   logLines,
 	}
 
 	// data
@@ -399,7 +725,7 @@ func (svc *Service) _sendLogs(taskId primitive.ObjectID, lines []string) {
 	}
 
 	// send message
-	if err := svc.msgStream.Send(msg); err != nil {
+	if err := svc._send(msg); err != nil {
 		trace.PrintError(err)
 		return
 	}
@@ -417,12 +743,31 @@ func (svc *Service) _sendTaskStatus(taskId primitive.ObjectID, status string, er
 		logsMsg.Error = err.Error()
 	}
 
+	svc._sendTaskMessage(constants.MessageCodeUpdateTask, logsMsg)
+}
+
+// _send sends the message to the stream. Messages are sent by handlers,
+// task heartbeats and log flushes concurrently, while a stream allows only
+// one sender at a time.
+func (svc *Service) _send(msg *grpc.StreamMessage) (err error) {
+	svc.msgStreamMu.Lock()
+	defer svc.msgStreamMu.Unlock()
+	return svc.msgStream.Send(msg)
+}
+
+// _sendTaskMessage sends a message of a task to the master node.
+func (svc *Service) _sendTaskMessage(code string, taskMsg *entity.TaskMessage) {
+	// last log sequence number of status updates
+	if taskMsg.Status != "" {
+		taskMsg.LastLogSeq = svc._getLogSeq(taskMsg.TaskId)
+	}
+
 	// data
-	data, _ := json.Marshal(logsMsg)
+	data, _ := json.Marshal(taskMsg)
 
 	// message data
 	msgDataObj := &entity.MessageData{
-		Code: constants.MessageCodeUpdateTask,
+		Code: code,
 		Data: data,
 	}
 	msgData, _ := json.Marshal(msgDataObj)
@@ -437,7 +782,7 @@ func (svc *Service) _sendTaskStatus(taskId primitive.ObjectID, status string, er
 	}
 
 	// send message
-	if err := svc.msgStream.Send(msg); err != nil {
+	if err := svc._send(msg); err != nil {
 		trace.PrintError(err)
 		return
 	}
@@ -514,21 +859,53 @@ func (svc *Service) _updateDependencyList(
 	}
 
 	// send message
-	if err := svc.msgStream.Send(msg); err != nil {
+	if err := svc._send(msg); err != nil {
 		trace.PrintError(err)
 		return
 	}
 }
 
+// registerDependencyService adds the dependency service to the services
+// that are started, exposed through the api and handling stream messages.
+func (svc *Service) registerDependencyService(depSvc *baseService) {
+	svc.depSvcs = append(svc.depSvcs, depSvc)
+	svc.depSvcMap[depSvc.key] = depSvc
+	svc.msgHandlers[depSvc.codes.Update] = depSvc.updateDependencyList
+	svc.msgHandlers[depSvc.codes.Save] = depSvc._saveDependencyList
+	svc.msgHandlers[depSvc.codes.Install] = depSvc.installDependency
+	svc.msgHandlers[depSvc.codes.Uninstall] = depSvc.uninstallDependency
+}
+
+// _getDependencyService returns the dependency service of the given type.
+func (svc *Service) _getDependencyService(key string) (depSvc *baseService, err error) {
+	depSvc, ok := svc.depSvcMap[key]
+	if !ok {
+		return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid dependency type: %s", key)))
+	}
+	return depSvc, nil
+}
+
 func NewService() *Service {
 	// service
 	svc := &Service{
-		Internal: plugin.NewInternal(),
-		colS:     mongo2.GetMongoCol(constants.DependencySettingsColName),
-		colD:     mongo2.GetMongoCol(constants.DependenciesColName),
-		colT:     mongo2.GetMongoCol(constants.DependencyTasksColName),
-		colL:     mongo2.GetMongoCol(constants.DependencyLogsColName),
-	}
+		Internal:    plugin.NewInternal(),
+		colS:        mongo2.GetMongoCol(constants.DependencySettingsColName),
+		colD:        mongo2.GetMongoCol(constants.DependenciesColName),
+		colT:        mongo2.GetMongoCol(constants.DependencyTasksColName),
+		colL:        mongo2.GetMongoCol(constants.DependencyLogsColName),
+		colSn:       mongo2.GetMongoCol(constants.DependencySnapshotsColName),
+		depSvcMap:   map[string]*baseService{},
+		msgHandlers: map[string]messageHandler{},
+		logBroker:   newLogBroker(),
+	}
+
+	// message handlers of tasks
+	svc.msgHandlers[constants.MessageCodeUpdateTask] = svc.updateTask
+	svc.msgHandlers[constants.MessageCodeInsertLogs] = svc.insertLogs
+	svc.msgHandlers[constants.MessageCodeCancelTask] = svc.cancelTask
+	svc.msgHandlers[constants.MessageCodeAckTask] = svc.ackTask
+	svc.msgHandlers[constants.MessageCodeHeartbeatTask] = svc.heartbeatTask
+	svc.msgHandlers[constants.MessageCodeTaskVersions] = svc.updateTaskVersions
 
 	// dependency injection
 	c := dig.New()
@@ -543,12 +920,21 @@ func NewService() *Service {
 		panic(err)
 	}
 
+	// dependency services
+	svc.registerDependencyService(NewPythonService(svc).baseService)
+	svc.registerDependencyService(NewNodeService(svc).baseService)
+	svc.registerDependencyService(NewGoService(svc).baseService)
+	svc.registerDependencyService(NewSystemService(svc).baseService)
+	svc.registerDependencyService(NewMavenService(svc).baseService)
+
 	// sub services
 	svc.settingSvc = NewSettingService(svc)
 	svc.taskSvc = NewTaskService(svc)
-	svc.pythonSvc = NewPythonService(svc)
-	svc.nodeSvc = NewNodeService(svc)
 	svc.spiderSvc = NewSpiderService(svc)
+	svc.snapshotSvc = NewSnapshotService(svc)
+	svc.driftSvc = NewDriftService(svc)
+	svc.policySvc = NewPolicyService(svc)
+	svc.scheduleSvc = NewScheduleService(svc)
 
 	// initialize
 	if err := svc.Init(); err != nil {
@@ -1,8 +1,11 @@
 package services
 
 import (
+	"errors"
+	"fmt"
 	"github.com/crawlab-team/crawlab-core/controllers"
 	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/crawlab-team/go-trace"
 	"github.com/crawlab-team/plugin-dependency/constants"
 	"github.com/crawlab-team/plugin-dependency/models"
 	"github.com/gin-gonic/gin"
@@ -10,6 +13,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// registryPasswordMask replaces registry passwords in responses, so that
+// they are never sent back to clients.
+const registryPasswordMask = "******"
+
 type SettingService struct {
 	parent *Service
 	api    *gin.Engine
@@ -54,6 +61,10 @@ func (svc *SettingService) getSettingList(c *gin.Context) {
 		return
 	}
 
+	for i := range list {
+		list[i] = maskSetting(list[i])
+	}
+
 	controllers.HandleSuccessWithListData(c, list, total)
 }
 
@@ -70,7 +81,7 @@ func (svc *SettingService) getSetting(c *gin.Context) {
 		return
 	}
 
-	controllers.HandleSuccessWithData(c, s)
+	controllers.HandleSuccessWithData(c, maskSetting(s))
 }
 
 func (svc *SettingService) putSetting(c *gin.Context) {
@@ -80,13 +91,20 @@ func (svc *SettingService) putSetting(c *gin.Context) {
 		return
 	}
 
+	if err := svc._validateSetting(s); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
 	s.Id = primitive.NewObjectID()
 	if _, err := svc.col.Insert(s); err != nil {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
 
-	controllers.HandleSuccessWithData(c, s)
+	svc._reloadSchedules()
+
+	controllers.HandleSuccessWithData(c, maskSetting(s))
 }
 
 func (svc *SettingService) postSetting(c *gin.Context) {
@@ -102,18 +120,31 @@ func (svc *SettingService) postSetting(c *gin.Context) {
 		return
 	}
 
+	password := s.RegistryPassword
 	if err := c.ShouldBindJSON(&s); err != nil {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
 	s.Id = id
 
+	// keep the stored password if it is not changed
+	if s.RegistryPassword == "" || s.RegistryPassword == registryPasswordMask {
+		s.RegistryPassword = password
+	}
+
+	if err := svc._validateSetting(s); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
 	if err := svc.col.ReplaceId(id, s); err != nil {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
 
-	controllers.HandleSuccessWithData(c, s)
+	svc._reloadSchedules()
+
+	controllers.HandleSuccessWithData(c, maskSetting(s))
 }
 
 func (svc *SettingService) deleteSetting(c *gin.Context) {
@@ -128,6 +159,8 @@ func (svc *SettingService) deleteSetting(c *gin.Context) {
 		return
 	}
 
+	svc._reloadSchedules()
+
 	controllers.HandleSuccess(c)
 }
 
@@ -156,10 +189,55 @@ func (svc *SettingService) _toggleSettingFunc(value bool) func(c *gin.Context) {
 			controllers.HandleErrorInternalServerError(c, err)
 			return
 		}
+		svc._reloadSchedules()
 		controllers.HandleSuccess(c)
 	}
 }
 
+// _validateSetting validates cron expressions of the setting.
+func (svc *SettingService) _validateSetting(s models.Setting) (err error) {
+	if err := validateCron("update", s.UpdateCron); err != nil {
+		return err
+	}
+	if err := validateCron("drift check", s.DriftCheckCron); err != nil {
+		return err
+	}
+	if s.VersionCacheTtl < 0 {
+		return errors.New("invalid version cache ttl")
+	}
+	if s.TaskRetentionDays < 0 {
+		return errors.New("invalid task retention days")
+	}
+	switch s.TaskArchiveMode {
+	case constants.TaskArchiveModeNone, constants.TaskArchiveModeCollection:
+	case constants.TaskArchiveModeFile:
+		if s.TaskArchivePath == "" {
+			return errors.New("task archive path is required")
+		}
+	default:
+		return errors.New(fmt.Sprintf("invalid task archive mode: %s", s.TaskArchiveMode))
+	}
+	if err := validatePolicy(s.Key, s.Policy); err != nil {
+		return err
+	}
+	return nil
+}
+
+// _reloadSchedules applies changes of settings to scheduled jobs.
+func (svc *SettingService) _reloadSchedules() {
+	if err := svc.parent.scheduleSvc.reload(); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+// maskSetting returns the setting with the registry password masked.
+func maskSetting(s models.Setting) models.Setting {
+	if s.RegistryPassword != "" {
+		s.RegistryPassword = registryPasswordMask
+	}
+	return s
+}
+
 func NewSettingService(parent *Service) (svc *SettingService) {
 	svc = &SettingService{
 		parent: parent,
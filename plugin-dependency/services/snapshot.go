@@ -0,0 +1,410 @@
+package services
+
+import (
+	"errors"
+	"github.com/crawlab-team/crawlab-core/controllers"
+	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"sort"
+	"time"
+)
+
+type SnapshotService struct {
+	parent *Service
+	api    *gin.Engine
+	col    *mongo2.Col // dependency snapshots
+}
+
+func (svc *SnapshotService) Init() {
+	svc.api.GET("/snapshots", svc.getList)
+	svc.api.GET("/snapshots/:id", svc.get)
+	svc.api.POST("/snapshots", svc.capture)
+	svc.api.DELETE("/snapshots/:id", svc.delete)
+	svc.api.GET("/snapshots/:id/diff", svc.diff)
+	svc.api.POST("/snapshots/:id/apply", svc.apply)
+}
+
+func (svc *SnapshotService) getList(c *gin.Context) {
+	// params
+	pagination := controllers.MustGetPagination(c)
+	query := controllers.MustGetFilterQuery(c)
+
+	// get list without dependencies
+	var list []models.Snapshot
+	if err := svc.col.Find(query, &mongo2.FindOptions{
+		Sort:  bson.D{{"_id", -1}},
+		Skip:  pagination.Size * (pagination.Page - 1),
+		Limit: pagination.Size,
+	}).All(&list); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			controllers.HandleSuccessWithListData(c, nil, 0)
+		} else {
+			controllers.HandleErrorInternalServerError(c, err)
+		}
+		return
+	}
+
+	// total count
+	total, err := svc.col.Count(query)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithListData(c, list, total)
+}
+
+func (svc *SnapshotService) get(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var s models.Snapshot
+	if err := svc.col.FindId(id).One(&s); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, s)
+}
+
+// capture records dependencies of a node as a new snapshot. Dependencies are
+// taken from the records saved by the node after each update, install and
+// uninstall, so they should be updated beforehand to capture the latest state.
+func (svc *SnapshotService) capture(c *gin.Context) {
+	// payload
+	var payload entity.SnapshotPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// validate
+	if _, err := svc.parent._getDependencyService(payload.Type); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+	if payload.NodeId.IsZero() {
+		controllers.HandleErrorBadRequest(c, errors.New("empty node id"))
+		return
+	}
+
+	// installed dependencies
+	deps, err := svc._getNodeDependencies(payload.Type, payload.NodeId)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// version
+	version, err := svc._getNextVersion(payload.Type, payload.NodeId)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// snapshot
+	s := models.Snapshot{
+		Id:           primitive.NewObjectID(),
+		Type:         payload.Type,
+		NodeId:       payload.NodeId,
+		Name:         payload.Name,
+		Description:  payload.Description,
+		Version:      version,
+		Dependencies: deps,
+		CreateTs:     time.Now(),
+	}
+	if _, err := svc.col.Insert(s); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, s)
+}
+
+func (svc *SnapshotService) delete(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	if err := svc.col.DeleteId(id); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccess(c)
+}
+
+// diff compares the snapshot with another snapshot given by target_id, or
+// with dependencies currently installed on a node given by node_id. The
+// result is the changes from the target to the snapshot, i.e. what applying
+// the snapshot to the target would do.
+func (svc *SnapshotService) diff(c *gin.Context) {
+	// snapshot
+	s, err := svc._getSnapshot(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// target dependencies
+	var targetDeps []models.SnapshotDependency
+	if targetIdHex := c.Query("target_id"); targetIdHex != "" {
+		target, err := svc._getSnapshot(targetIdHex)
+		if err != nil {
+			controllers.HandleErrorBadRequest(c, err)
+			return
+		}
+		targetDeps = target.Dependencies
+	} else if nodeIdHex := c.Query("node_id"); nodeIdHex != "" {
+		nodeId, err := primitive.ObjectIDFromHex(nodeIdHex)
+		if err != nil {
+			controllers.HandleErrorBadRequest(c, err)
+			return
+		}
+		targetDeps, err = svc._getNodeDependencies(s.Type, nodeId)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+	} else {
+		controllers.HandleErrorBadRequest(c, errors.New("target_id or node_id is required"))
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, diffSnapshotDependencies(targetDeps, s.Dependencies))
+}
+
+// apply makes dependencies on the given nodes converge to the snapshot, by
+// installing missing dependencies, installing the versions in the snapshot
+// for changed dependencies, and uninstalling dependencies that are not in the
+// snapshot if prune is enabled. Uninstall tasks on a node are started after
+// its install tasks are finished. Pruning system packages must be confirmed
+// with confirm_prune.
+func (svc *SnapshotService) apply(c *gin.Context) {
+	// snapshot
+	s, err := svc._getSnapshot(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// payload
+	var payload entity.SnapshotApplyPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// pruning system packages must be confirmed
+	if payload.Prune && s.Type == constants.DependencyTypeSystem && !payload.ConfirmPrune {
+		controllers.HandleErrorBadRequest(c, errors.New("pruning removes all system packages that are not in the snapshot, set confirm_prune to proceed"))
+		return
+	}
+
+	// dependency service
+	depSvc, err := svc.parent._getDependencyService(s.Type)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// nodes
+	query := bson.M{"active": true}
+	if payload.Mode != constants.InstallModeAll {
+		query["_id"] = bson.M{"$in": payload.NodeIds}
+	}
+	nodes, err := svc.parent._getNodes(query)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// iterate nodes
+	var results []entity.SnapshotApplyResult
+	for _, n := range nodes {
+		// installed dependencies
+		deps, err := svc._getNodeDependencies(s.Type, n.Id)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+
+		// changes to converge
+		d := diffSnapshotDependencies(deps, s.Dependencies)
+		if !payload.Prune {
+			d.Removed = nil
+		}
+		results = append(results, entity.SnapshotApplyResult{
+			NodeId: n.Id,
+			Diff:   d,
+		})
+
+		// install added and changed dependencies with pinned versions
+		installPayload := entity.InstallPayload{
+			Mode:     constants.InstallModeSelectedNodes,
+			NodeIds:  []primitive.ObjectID{n.Id},
+			Versions: map[string]string{},
+		}
+		for _, item := range append(d.Added, d.Changed...) {
+			installPayload.Names = append(installPayload.Names, item.Name)
+			installPayload.Versions[item.Name] = item.ToVersion
+		}
+		var installTaskIds []primitive.ObjectID
+		if len(installPayload.Names) > 0 {
+			installTaskIds, err = depSvc._install(installPayload)
+			if err != nil {
+				handleInstallError(c, err)
+				return
+			}
+		}
+
+		// uninstall removed dependencies after the install on the node is
+		// finished, as tasks on the same node run concurrently in the same
+		// environment
+		uninstallPayload := entity.UninstallPayload{
+			Mode:    constants.InstallModeSelectedNodes,
+			NodeIds: []primitive.ObjectID{n.Id},
+		}
+		for _, item := range d.Removed {
+			uninstallPayload.Names = append(uninstallPayload.Names, item.Name)
+		}
+		if len(uninstallPayload.Names) > 0 {
+			go func(installTaskIds []primitive.ObjectID, uninstallPayload entity.UninstallPayload) {
+				if err := svc.parent.taskSvc._runSteps(func() ([]primitive.ObjectID, error) {
+					return installTaskIds, nil
+				}, func() ([]primitive.ObjectID, error) {
+					return depSvc._uninstall(uninstallPayload)
+				}); err != nil {
+					trace.PrintError(err)
+				}
+			}(installTaskIds, uninstallPayload)
+		}
+	}
+
+	controllers.HandleSuccessWithData(c, results)
+}
+
+func (svc *SnapshotService) _getSnapshot(idHex string) (s models.Snapshot, err error) {
+	id, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return s, trace.TraceError(err)
+	}
+	if err := svc.col.FindId(id).One(&s); err != nil {
+		return s, trace.TraceError(err)
+	}
+	return s, nil
+}
+
+// _getNodeDependencies returns dependencies installed in the global
+// environment of the node, sorted by name.
+func (svc *SnapshotService) _getNodeDependencies(key string, nodeId primitive.ObjectID) (deps []models.SnapshotDependency, err error) {
+	query := bson.M{
+		"spider_id": bson.M{"$exists": false},
+		"type":      key,
+		"node_id":   nodeId,
+	}
+	var list []models.Dependency
+	if err := svc.parent.colD.Find(query, &mongo2.FindOptions{
+		Sort: bson.D{{"name", 1}},
+	}).All(&list); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			return deps, nil
+		}
+		return nil, err
+	}
+	for _, d := range list {
+		deps = append(deps, models.SnapshotDependency{
+			Name:    d.Name,
+			Version: d.Version,
+		})
+	}
+	return deps, nil
+}
+
+// _getNextVersion returns the version of a new snapshot of the node.
+func (svc *SnapshotService) _getNextVersion(key string, nodeId primitive.ObjectID) (version int, err error) {
+	var s models.Snapshot
+	if err := svc.col.Find(bson.M{
+		"type":    key,
+		"node_id": nodeId,
+	}, &mongo2.FindOptions{
+		Sort:  bson.D{{"version", -1}},
+		Limit: 1,
+	}).One(&s); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			return 1, nil
+		}
+		return 0, err
+	}
+	return s.Version + 1, nil
+}
+
+// diffSnapshotDependencies returns the changes from one list of dependencies
+// to another, sorted by name.
+func diffSnapshotDependencies(from, to []models.SnapshotDependency) (d entity.SnapshotDiff) {
+	fromMap := map[string]string{}
+	for _, dep := range from {
+		fromMap[dep.Name] = dep.Version
+	}
+	toMap := map[string]string{}
+	for _, dep := range to {
+		toMap[dep.Name] = dep.Version
+	}
+
+	// added and changed
+	for _, dep := range to {
+		v, ok := fromMap[dep.Name]
+		if !ok {
+			d.Added = append(d.Added, entity.SnapshotDiffItem{
+				Name:      dep.Name,
+				ToVersion: dep.Version,
+			})
+		} else if v != dep.Version {
+			d.Changed = append(d.Changed, entity.SnapshotDiffItem{
+				Name:        dep.Name,
+				FromVersion: v,
+				ToVersion:   dep.Version,
+			})
+		}
+	}
+
+	// removed
+	for _, dep := range from {
+		if _, ok := toMap[dep.Name]; !ok {
+			d.Removed = append(d.Removed, entity.SnapshotDiffItem{
+				Name:        dep.Name,
+				FromVersion: dep.Version,
+			})
+		}
+	}
+
+	// sort by name
+	for _, items := range [][]entity.SnapshotDiffItem{d.Added, d.Removed, d.Changed} {
+		sort.Slice(items, func(i, j int) bool {
+			return items[i].Name < items[j].Name
+		})
+	}
+
+	return d
+}
+
+func NewSnapshotService(parent *Service) (svc *SnapshotService) {
+	svc = &SnapshotService{
+		parent: parent,
+		api:    parent.GetApi(),
+		col:    parent.colSn,
+	}
+	return svc
+}
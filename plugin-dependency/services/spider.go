@@ -3,22 +3,16 @@ package services
 import (
 	"errors"
 	"fmt"
-	"github.com/blang/semver/v4"
 	"github.com/crawlab-team/crawlab-core/controllers"
 	"github.com/crawlab-team/crawlab-core/spider/fs"
 	"github.com/crawlab-team/crawlab-core/utils"
 	"github.com/crawlab-team/go-trace"
-	"github.com/crawlab-team/plugin-dependency/constants"
 	"github.com/crawlab-team/plugin-dependency/entity"
 	"github.com/crawlab-team/plugin-dependency/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	mongo2 "go.mongodb.org/mongo-driver/mongo"
-	"io/ioutil"
 	"path"
-	"regexp"
-	"strings"
 )
 
 type SpiderService struct {
@@ -30,84 +24,107 @@ func (svc *SpiderService) Init() {
 	svc.api.GET("/spiders/:id", svc.get)
 	svc.api.POST("/spiders/:id/install", svc.install)
 	svc.api.POST("/spiders/:id/uninstall", svc.uninstall)
+	svc.api.GET("/spiders/:id/envs", svc.getEnvs)
 }
 
 func (svc *SpiderService) install(c *gin.Context) {
-	// spider id
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
-	if err != nil {
+	// payload
+	var payload entity.InstallPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		controllers.HandleErrorBadRequest(c, err)
 		return
 	}
 
-	// spider fs service
-	fsSvc, err := fs.NewSpiderFsService(id)
+	// workspace path
+	workspacePath, err := svc._getWorkspacePath(c)
 	if err != nil {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
 
-	// sync to workspace
-	if err := fsSvc.GetFsService().SyncToWorkspace(); err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
+	// dependency type
+	payload.Config, err = svc._getDependencyType(workspacePath, payload.Config)
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
 		return
 	}
 
-	// workspace path
-	workspacePath := fsSvc.GetWorkspacePath()
+	// dependency service
+	depSvc, err := svc._getDependencyService(payload.Config)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
 
-	// dependency type
-	dependencyType := svc._getDependencyType(workspacePath)
+	// policy of dependencies in the manifest
+	payload.SpiderId, _ = primitive.ObjectIDFromHex(c.Param("id"))
+	if payload.UseConfig {
+		deps, err := svc._getDependencies(payload.SpiderId, workspacePath, payload.Config)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		var names []string
+		for _, d := range deps {
+			names = append(names, d.Name)
+		}
+		versions, err := svc._getManifestVersions(workspacePath, payload.Config, deps)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		if err := depSvc._checkManifestPolicy(payload, names, versions); err != nil {
+			handleInstallError(c, err)
+			return
+		}
+	}
 
 	// install
-	switch dependencyType {
-	case constants.DependencyConfigRequirementsTxt:
-		svc.parent.pythonSvc.install(c)
-	case constants.DependencyConfigPackageJson:
-		svc.parent.nodeSvc.install(c)
-	default:
-		controllers.HandleErrorInternalServerError(c, errors.New(fmt.Sprintf("invalid dependency type: %s", dependencyType)))
+	if _, err := depSvc._install(payload); err != nil {
+		handleInstallError(c, err)
 		return
 	}
+
+	controllers.HandleSuccess(c)
 }
 
 func (svc *SpiderService) uninstall(c *gin.Context) {
-	// spider id
-	id, err := primitive.ObjectIDFromHex(c.Param("id"))
-	if err != nil {
+	// payload
+	var payload entity.UninstallPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
 		controllers.HandleErrorBadRequest(c, err)
 		return
 	}
 
-	// spider fs service
-	fsSvc, err := fs.NewSpiderFsService(id)
+	// workspace path
+	workspacePath, err := svc._getWorkspacePath(c)
 	if err != nil {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
 
-	// sync to workspace
-	if err := fsSvc.GetFsService().SyncToWorkspace(); err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
+	// dependency type
+	dependencyType, err := svc._getDependencyType(workspacePath, payload.Config)
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
 		return
 	}
 
-	// workspace path
-	workspacePath := fsSvc.GetWorkspacePath()
-
-	// dependency type
-	dependencyType := svc._getDependencyType(workspacePath)
+	// dependency service
+	depSvc, err := svc._getDependencyService(dependencyType)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
 
 	// uninstall
-	switch dependencyType {
-	case constants.DependencyConfigRequirementsTxt:
-		svc.parent.pythonSvc.uninstall(c)
-	case constants.DependencyConfigPackageJson:
-		svc.parent.nodeSvc.uninstall(c)
-	default:
-		controllers.HandleErrorInternalServerError(c, errors.New(fmt.Sprintf("invalid dependency type: %s", dependencyType)))
+	payload.SpiderId, _ = primitive.ObjectIDFromHex(c.Param("id"))
+	if _, err := depSvc._uninstall(payload); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
+
+	controllers.HandleSuccess(c)
 }
 
 func (svc *SpiderService) get(c *gin.Context) {
@@ -134,193 +151,178 @@ func (svc *SpiderService) get(c *gin.Context) {
 	// workspace path
 	workspacePath := fsSvc.GetWorkspacePath()
 
-	// dependency type
-	dependencyType := svc._getDependencyType(workspacePath)
+	// dependency types
+	dependencyTypes := svc._getDependencyTypes(workspacePath)
 
-	// spider info
-	info := bson.M{}
-	info["dependency_type"] = dependencyType
-
-	// dependencies
-	var dependencies []models.Dependency
-	switch dependencyType {
-	case constants.DependencyConfigRequirementsTxt:
-		dependencies, err = svc._getDependenciesRequirementsTxt(workspacePath)
-	case constants.DependencyConfigPackageJson:
-		// TODO: implement
+	// manifests
+	var manifests []bson.M
+	for _, dependencyType := range dependencyTypes {
+		dependencies, err := svc._getDependencies(id, workspacePath, dependencyType)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		notes, err := svc._getManifestNotes(workspacePath, dependencyType)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		manifests = append(manifests, bson.M{
+			"dependency_type": dependencyType,
+			"dependencies":    dependencies,
+			"notes":           notes,
+		})
 	}
-	if err != nil {
-		controllers.HandleErrorInternalServerError(c, err)
-		return
+
+	// spider info, in which the first manifest is the default one
+	info := bson.M{}
+	info["dependency_type"] = ""
+	info["dependencies"] = []models.Dependency{}
+	info["manifests"] = manifests
+	if len(manifests) > 0 {
+		info["dependency_type"] = manifests[0]["dependency_type"]
+		info["dependencies"] = manifests[0]["dependencies"]
 	}
-	info["dependencies"] = dependencies
 
 	controllers.HandleSuccessWithData(c, info)
 }
 
-func (svc *SpiderService) _getDependencyType(workspacePath string) (t string) {
-	if utils.Exists(path.Join(workspacePath, constants.DependencyConfigRequirementsTxt)) {
-		return constants.DependencyConfigRequirementsTxt
-	} else if utils.Exists(path.Join(workspacePath, constants.DependencyConfigPackageJson)) {
-		return constants.DependencyConfigPackageJson
+// getEnvs returns the dependency environments of the spider, so that the
+// task runner is able to locate the interpreters of isolated environments.
+func (svc *SpiderService) getEnvs(c *gin.Context) {
+	// spider id
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
 	}
-	return ""
-}
 
-func (svc *SpiderService) _getDependenciesRequirementsTxt(workspacePath string) (deps []models.Dependency, err error) {
-	// file path
-	filePath := path.Join(workspacePath, constants.DependencyConfigRequirementsTxt)
+	// environments of dependency services
+	envs := map[string]entity.EnvInfo{}
+	for _, depSvc := range svc.parent.depSvcs {
+		envSvc, ok := depSvc.svc.(DependencyEnvService)
+		if !ok {
+			continue
+		}
+		info, err := envSvc.GetEnvInfo(id)
+		if err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		envs[depSvc.key] = info
+	}
 
-	// file content
-	data, err := ioutil.ReadFile(filePath)
+	controllers.HandleSuccessWithData(c, envs)
+}
+
+// _getWorkspacePath syncs files of the spider in route to its workspace and
+// returns the workspace path.
+func (svc *SpiderService) _getWorkspacePath(c *gin.Context) (workspacePath string, err error) {
+	// spider id
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
-		return nil, trace.TraceError(err)
+		return "", trace.TraceError(err)
 	}
-	content := string(data)
 
-	// regex pattern
-	pattern, err := regexp.Compile("(\\w+)([=<>]=.*)?")
+	// spider fs service
+	fsSvc, err := fs.NewSpiderFsService(id)
 	if err != nil {
-		return nil, trace.TraceError(err)
+		return "", err
 	}
 
-	// dependency names
-	var depNames []string
-
-	// iterate content lines
-	for _, line := range strings.Split(content, "\n") {
-		// trim space
-		line = strings.TrimSpace(line)
-
-		// validate regex match result
-		if !pattern.MatchString(line) {
-			return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid %s", constants.DependencyConfigRequirementsTxt)))
-		}
+	// sync to workspace
+	if err := fsSvc.GetFsService().SyncToWorkspace(); err != nil {
+		return "", err
+	}
 
-		// sub matches
-		matches := pattern.FindStringSubmatch(line)
-		if len(matches) < 2 {
-			return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid %s", constants.DependencyConfigRequirementsTxt)))
-		}
+	return fsSvc.GetWorkspacePath(), nil
+}
 
-		// dependency result
-		d := models.Dependency{
-			Name: matches[1],
+// _getDependencyTypes returns all dependency manifests in the workspace in
+// the order of precedence, which follows the order of registered dependency
+// services.
+func (svc *SpiderService) _getDependencyTypes(workspacePath string) (types []string) {
+	for _, depSvc := range svc.parent.depSvcs {
+		manifestSvc, ok := depSvc.svc.(DependencyManifestService)
+		if !ok {
+			continue
 		}
-
-		// required version
-		if len(matches) > 2 {
-			d.Version = matches[2]
+		for _, t := range manifestSvc.GetManifests() {
+			if utils.Exists(path.Join(workspacePath, t)) {
+				types = append(types, t)
+			}
 		}
-
-		// add to dependency names
-		depNames = append(depNames, d.Name)
-
-		// add to dependencies
-		deps = append(deps, d)
 	}
+	return types
+}
 
-	// dependencies in db
-	var depsResults []entity.DependencyResult
-	pipelines := mongo2.Pipeline{
-		{{
-			"$match",
-			bson.M{
-				"type": constants.DependencyTypePython,
-				"name": bson.M{
-					"$in": depNames,
-				},
-			},
-		}},
-		{{
-			"$group",
-			bson.M{
-				"_id": "$name",
-				"node_ids": bson.M{
-					"$push": "$node_id",
-				},
-				"versions": bson.M{
-					"$addToSet": "$version",
-				},
-			},
-		}},
-		{{
-			"$project",
-			bson.M{
-				"name":     "$_id",
-				"node_ids": "$node_ids",
-				"versions": "$versions",
-			},
-		}},
-	}
-	if err := svc.parent.colD.Aggregate(pipelines, nil).All(&depsResults); err != nil {
-		return nil, err
+// _getDependencyType returns the given dependency manifest if it exists in
+// the workspace, or the first one if not given.
+func (svc *SpiderService) _getDependencyType(workspacePath string, config string) (t string, err error) {
+	types := svc._getDependencyTypes(workspacePath)
+	if len(types) == 0 {
+		return "", trace.TraceError(errors.New("no dependency manifest found"))
 	}
-
-	// dependencies map
-	depsResultsMap := map[string]entity.DependencyResult{}
-	for _, dr := range depsResults {
-		depsResultsMap[dr.Name] = dr
+	if config == "" {
+		return types[0], nil
 	}
-
-	// iterate dependencies
-	for i, d := range deps {
-		// operator
-		var op string
-		if strings.HasPrefix(d.Version, "==") {
-			op = "=="
-			deps[i].Version = strings.Replace(d.Version, "==", "", 1)
-		} else if strings.HasPrefix(d.Version, ">=") {
-			op = ">="
-		} else if strings.HasPrefix(d.Version, "<=") {
-			op = "<="
+	for _, t := range types {
+		if t == config {
+			return t, nil
 		}
+	}
+	return "", trace.TraceError(errors.New(fmt.Sprintf("invalid dependency type: %s", config)))
+}
 
-		// dependency result
-		dr, ok := depsResultsMap[d.Name]
+// _getDependencyService returns the service that installs dependencies of
+// the given dependency manifest.
+func (svc *SpiderService) _getDependencyService(dependencyType string) (depSvc *baseService, err error) {
+	for _, ds := range svc.parent.depSvcs {
+		manifestSvc, ok := ds.svc.(DependencyManifestService)
 		if !ok {
 			continue
 		}
-		deps[i].Result = dr
-
-		// normalized version
-		nv := strings.Replace(d.Version, op, "", 1)
-
-		// required version
-		rv, err := semver.Make(nv)
-		if err != nil {
-			continue
+		for _, t := range manifestSvc.GetManifests() {
+			if t == dependencyType {
+				return ds, nil
+			}
 		}
+	}
+	return nil, trace.TraceError(errors.New(fmt.Sprintf("invalid dependency type: %s", dependencyType)))
+}
 
-		// iterate installed versions
-		for _, v := range dr.Versions {
-			// installed version
-			iv, err := semver.Make(v)
-			if err != nil {
-				continue
-			}
+// _getDependencies returns dependencies declared in the given dependency
+// manifest of the workspace.
+func (svc *SpiderService) _getDependencies(id primitive.ObjectID, workspacePath string, dependencyType string) (deps []models.Dependency, err error) {
+	depSvc, err := svc._getDependencyService(dependencyType)
+	if err != nil {
+		return nil, err
+	}
+	return depSvc.svc.(DependencyManifestService).GetManifestDependencies(id, workspacePath, dependencyType)
+}
 
-			// compare with the required version
-			switch op {
-			case "==":
-				if rv.Compare(iv) > 0 {
-					deps[i].Result.Upgradable = true
-				} else if rv.Compare(iv) < 0 {
-					deps[i].Result.Downgradable = true
-				}
-			case ">=":
-				if rv.Compare(iv) > 0 {
-					deps[i].Result.Upgradable = true
-				}
-			case "<=":
-				if rv.Compare(iv) < 0 {
-					deps[i].Result.Downgradable = true
-				}
-			}
-		}
+// _getManifestVersions returns versions of the dependencies to be installed
+// by the given dependency manifest, keyed by name.
+func (svc *SpiderService) _getManifestVersions(workspacePath string, dependencyType string, deps []models.Dependency) (versions map[string]string, err error) {
+	depSvc, err := svc._getDependencyService(dependencyType)
+	if err != nil {
+		return nil, err
 	}
+	return depSvc.svc.(DependencyManifestService).GetManifestVersions(workspacePath, dependencyType, deps)
+}
 
-	return deps, nil
+// _getManifestNotes returns codes of notes about how dependencies of the
+// given dependency manifest are resolved.
+func (svc *SpiderService) _getManifestNotes(workspacePath string, dependencyType string) (notes []string, err error) {
+	depSvc, err := svc._getDependencyService(dependencyType)
+	if err != nil {
+		return nil, err
+	}
+	noteSvc, ok := depSvc.svc.(DependencyManifestNoteService)
+	if !ok {
+		return nil, nil
+	}
+	return noteSvc.GetManifestNotes(workspacePath, dependencyType)
 }
 
 func NewSpiderService(parent *Service) (svc *SpiderService) {
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"github.com/crawlab-team/crawlab-core/controllers"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-gonic/gin"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// SystemService manages OS packages with apt/dpkg (Debian, Ubuntu) or apk
+// (Alpine), depending on the configured command.
+type SystemService struct {
+	*baseService
+}
+
+// GetRepoList searches the package index of the master node, as there is no
+// remote registry API for OS packages.
+func (svc *SystemService) GetRepoList(c *gin.Context) {
+	// query
+	query := c.Query("query")
+	pagination := controllers.MustGetPagination(c)
+
+	// validate
+	if query == "" {
+		controllers.HandleErrorBadRequest(c, errors.New("empty query"))
+		return
+	}
+
+	// setting
+	if err := svc._getSetting(); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// search command
+	var cmd *exec.Cmd
+	if isApk(svc._getCmd()) {
+		cmd = exec.Command(svc._getCmd(), "search", "-v", query)
+	} else {
+		cmd = exec.Command("apt-cache", "search", "--names-only", query)
+	}
+	data, err := cmd.Output()
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, trace.TraceError(err))
+		return
+	}
+
+	// dependencies
+	var deps []models.Dependency
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var d models.Dependency
+		if isApk(svc._getCmd()) {
+			// e.g. "curl-8.5.0-r0 - URL retrieval utility and library"
+			parts := strings.SplitN(line, " - ", 2)
+			d.Name, d.LatestVersion = parseApkPackage(parts[0])
+			if len(parts) > 1 {
+				d.Description = parts[1]
+			}
+		} else {
+			// e.g. "curl - command line tool for transferring data with URL syntax"
+			parts := strings.SplitN(line, " - ", 2)
+			d.Name = parts[0]
+			if len(parts) > 1 {
+				d.Description = parts[1]
+			}
+		}
+		deps = append(deps, d)
+	}
+
+	// paginate
+	total := len(deps)
+	start := (pagination.Page - 1) * pagination.Size
+	end := start + pagination.Size
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	}
+
+	svc._handleRepoListResults(c, deps[start:end], total)
+}
+
+func (svc *SystemService) GetDependencies(params entity.UpdateParams) (deps []models.Dependency, err error) {
+	// command
+	var cmd *exec.Cmd
+	if isApk(params.Cmd) {
+		cmd = exec.Command(params.Cmd, "info", "-v")
+	} else {
+		cmd = exec.Command("dpkg-query", "-W", "-f=${db:Status-Abbrev}\t${Package}\t${Version}\n")
+	}
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, trace.TraceError(err)
+	}
+
+	// parse output
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		d := models.Dependency{Type: constants.DependencyTypeSystem}
+		if isApk(params.Cmd) {
+			d.Name, d.Version = parseApkPackage(line)
+		} else {
+			var ok bool
+			d.Name, d.Version, ok = parseDpkgPackage(line)
+			if !ok {
+				continue
+			}
+		}
+		deps = append(deps, d)
+	}
+
+	return deps, nil
+}
+
+func (svc *SystemService) InstallDependencies(params entity.InstallParams) (err error) {
+	// install from config is not supported for os packages
+	if params.UseConfig {
+		return trace.TraceError(errors.New("installing system packages from config is not supported"))
+	}
+
+	// package index of apt, which is usually empty in container images and
+	// is fetched by apk with --no-cache on every install
+	if !isApk(params.Cmd) {
+		if err := svc._updatePackageIndex(params); err != nil {
+			return err
+		}
+	}
+
+	// arguments
+	var args []string
+	if isApk(params.Cmd) {
+		// install
+		args = append(args, "add", "--no-cache")
+
+		// upgrade
+		if params.Upgrade {
+			args = append(args, "--upgrade")
+		}
+
+		// proxy (repository mirror)
+		if params.Proxy != "" {
+			args = append(args, "--repository", params.Proxy)
+		}
+	} else {
+		// install
+		args = append(args, "install", "-y")
+
+		// upgrade
+		if params.Upgrade {
+			args = append(args, "--only-upgrade")
+		}
+
+		// proxy
+		if params.Proxy != "" {
+			args = append(args, "-o", "Acquire::http::Proxy="+params.Proxy)
+		}
+	}
+
+	// dependency names
+	for _, depName := range params.Names {
+		// pinned version, in the same format for apt and apk
+		if v := params.Versions[depName]; v != "" {
+			depName = depName + "=" + v
+		}
+
+		args = append(args, depName)
+	}
+
+	// command
+	cmd := exec.Command(params.Cmd, args...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// _updatePackageIndex runs "apt-get update" before installing packages, so
+// that packages and versions missing from a stale index can be installed.
+func (svc *SystemService) _updatePackageIndex(params entity.InstallParams) (err error) {
+	// arguments
+	args := []string{"update"}
+
+	// proxy
+	if params.Proxy != "" {
+		args = append(args, "-o", "Acquire::http::Proxy="+params.Proxy)
+	}
+
+	// command
+	cmd := exec.Command(params.Cmd, args...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (svc *SystemService) UninstallDependencies(params entity.UninstallParams) (err error) {
+	// arguments
+	var args []string
+
+	// uninstall
+	if isApk(params.Cmd) {
+		args = append(args, "del")
+	} else {
+		args = append(args, "remove", "-y")
+	}
+
+	// dependency names
+	for _, depName := range params.Names {
+		args = append(args, depName)
+	}
+
+	// command
+	cmd := exec.Command(params.Cmd, args...)
+	cmd.Env = append(os.Environ(), "DEBIAN_FRONTEND=noninteractive")
+
+	// logging
+	svc.parent._configureLogging(params.TaskId, cmd)
+
+	// run
+	if err := svc.parent._runTaskCmd(params.TaskId, cmd); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetLatestVersion returns the candidate version in the package index of the
+// master node.
+func (svc *SystemService) GetLatestVersion(dep models.Dependency) (v string, err error) {
+	if isApk(svc._getCmd()) {
+		// e.g. "curl-8.5.0-r0 description:"
+		data, err := exec.Command(svc._getCmd(), "info", dep.Name).Output()
+		if err != nil {
+			return "", trace.TraceError(err)
+		}
+		fields := strings.Fields(string(data))
+		if len(fields) == 0 {
+			return "", nil
+		}
+		_, v = parseApkPackage(fields[0])
+		return v, nil
+	}
+
+	// e.g. "  Candidate: 7.88.1-10+deb12u5"
+	data, err := exec.Command("apt-cache", "policy", dep.Name).Output()
+	if err != nil {
+		return "", trace.TraceError(err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "Candidate:") {
+			v = strings.TrimSpace(strings.TrimPrefix(line, "Candidate:"))
+			if v == "(none)" {
+				v = ""
+			}
+			return v, nil
+		}
+	}
+	return "", nil
+}
+
+func isApk(cmd string) bool {
+	return filepath.Base(cmd) == "apk"
+}
+
+// parseApkPackage splits an apk package string such as "musl-1.2.3-r4" into
+// name "musl" and version "1.2.3-r4".
+func parseApkPackage(s string) (name, version string) {
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 {
+		return s, ""
+	}
+	return strings.Join(parts[:len(parts)-2], "-"), strings.Join(parts[len(parts)-2:], "-")
+}
+
+// parseDpkgPackage splits a line of dpkg-query output such as
+// "ii \tcurl\t7.88.1-10" into name and version. ok is false if the package
+// is not installed, e.g. removed with its config files left in "rc" state.
+func parseDpkgPackage(line string) (name, version string, ok bool) {
+	parts := strings.SplitN(line, "\t", 3)
+	if len(parts) < 3 || strings.TrimSpace(parts[0]) != "ii" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+func NewSystemService(parent *Service) (svc *SystemService) {
+	svc = &SystemService{}
+	baseSvc := newBaseService(
+		svc,
+		parent,
+		constants.DependencyTypeSystem,
+		entity.MessageCodes{
+			Update:    constants.MessageCodeSystemUpdate,
+			Save:      constants.MessageCodeSystemSave,
+			Install:   constants.MessageCodeSystemInstall,
+			Uninstall: constants.MessageCodeSystemUninstall,
+		},
+	)
+	svc.baseService = baseSvc
+	return svc
+}
@@ -0,0 +1,23 @@
+package services
+
+import "testing"
+
+func TestParseDpkgPackage(t *testing.T) {
+	cases := []struct {
+		line    string
+		name    string
+		version string
+		ok      bool
+	}{
+		{"ii \tcurl\t7.88.1-10", "curl", "7.88.1-10", true},
+		{"rc \tvim\t2:9.0.1378-2", "", "", false},
+		{"un \tfoo\t", "", "", false},
+		{"curl\t7.88.1-10", "", "", false},
+	}
+	for _, c := range cases {
+		name, version, ok := parseDpkgPackage(c.line)
+		if name != c.name || version != c.version || ok != c.ok {
+			t.Errorf("%q: expected %s %s %v, got %s %s %v", c.line, c.name, c.version, c.ok, name, version, ok)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// compareDebianVersions compares two versions of Debian packages in the way
+// of dpkg, e.g. "1:1.0~rc1-1" < "1:1.0-1" < "1:1.0-1ubuntu1".
+func compareDebianVersions(a, b string) int {
+	ea, ua, ra := splitDebianVersion(a)
+	eb, ub, rb := splitDebianVersion(b)
+	if res := compareInt(ea, eb); res != 0 {
+		return res
+	}
+	if res := compareDebianVersionParts(ua, ub); res != 0 {
+		return res
+	}
+	return compareDebianVersionParts(ra, rb)
+}
+
+// splitDebianVersion splits a version into epoch, upstream version and
+// debian revision.
+func splitDebianVersion(v string) (epoch int, upstream, revision string) {
+	v = strings.TrimSpace(v)
+	if i := strings.Index(v, ":"); i >= 0 {
+		epoch, _ = strconv.Atoi(v[:i])
+		v = v[i+1:]
+	}
+	if i := strings.LastIndex(v, "-"); i >= 0 {
+		return epoch, v[:i], v[i+1:]
+	}
+	return epoch, v, ""
+}
+
+// compareDebianVersionParts compares upstream versions or revisions, which
+// alternate non-digit and digit parts. Letters sort before other characters
+// and "~" sorts before anything, even the end of the part.
+func compareDebianVersionParts(a, b string) int {
+	order := func(s string, i int) int {
+		if i >= len(s) {
+			return 0
+		}
+		c := s[i]
+		switch {
+		case isDigit(c):
+			return 0
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			return int(c)
+		case c == '~':
+			return -1
+		default:
+			return int(c) + 256
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		// non-digit parts
+		for (i < len(a) && !isDigit(a[i])) || (j < len(b) && !isDigit(b[j])) {
+			oa, ob := order(a, i), order(b, j)
+			if oa != ob {
+				return compareInt(oa, ob)
+			}
+			i++
+			j++
+		}
+
+		// digit parts
+		for i < len(a) && a[i] == '0' {
+			i++
+		}
+		for j < len(b) && b[j] == '0' {
+			j++
+		}
+		firstDiff := 0
+		for i < len(a) && isDigit(a[i]) && j < len(b) && isDigit(b[j]) {
+			if firstDiff == 0 {
+				firstDiff = compareInt(int(a[i]), int(b[j]))
+			}
+			i++
+			j++
+		}
+		if i < len(a) && isDigit(a[i]) {
+			return 1
+		}
+		if j < len(b) && isDigit(b[j]) {
+			return -1
+		}
+		if firstDiff != 0 {
+			return firstDiff
+		}
+	}
+	return 0
+}
+
+var apkVersionPattern = regexp.MustCompile(`^([0-9]+(?:\.[0-9]+)*)([a-z]?)((?:_[a-z]+[0-9]*)*)(?:-r([0-9]+))?$`)
+
+// apkSuffixes are version suffixes of apk in ascending order, where an empty
+// suffix is a release.
+var apkSuffixes = []string{"alpha", "beta", "pre", "rc", "", "cvs", "svn", "git", "hg", "p"}
+
+// compareApkVersions compares two versions of Alpine packages in the way of
+// apk, e.g. "1.2.3_rc1-r0" < "1.2.3-r0" < "1.2.3-r1" < "1.2.3a-r0". ok is
+// false if any of the versions is invalid.
+func compareApkVersions(a, b string) (res int, ok bool) {
+	ma := apkVersionPattern.FindStringSubmatch(strings.TrimSpace(a))
+	mb := apkVersionPattern.FindStringSubmatch(strings.TrimSpace(b))
+	if ma == nil || mb == nil {
+		return 0, false
+	}
+
+	// numbers
+	na := strings.Split(ma[1], ".")
+	nb := strings.Split(mb[1], ".")
+	for i := 0; i < len(na) || i < len(nb); i++ {
+		var x, y int
+		if i < len(na) {
+			x, _ = strconv.Atoi(na[i])
+		}
+		if i < len(nb) {
+			y, _ = strconv.Atoi(nb[i])
+		}
+		if res := compareInt(x, y); res != 0 {
+			return res, true
+		}
+	}
+
+	// letter
+	if res := strings.Compare(ma[2], mb[2]); res != 0 {
+		return res, true
+	}
+
+	// suffixes
+	sa := strings.Split(strings.TrimPrefix(ma[3], "_"), "_")
+	sb := strings.Split(strings.TrimPrefix(mb[3], "_"), "_")
+	for i := 0; i < len(sa) || i < len(sb); i++ {
+		var x, y string
+		if i < len(sa) {
+			x = sa[i]
+		}
+		if i < len(sb) {
+			y = sb[i]
+		}
+		if res := compareApkSuffixes(x, y); res != 0 {
+			return res, true
+		}
+	}
+
+	// revision
+	ra, _ := strconv.Atoi(ma[4])
+	rb, _ := strconv.Atoi(mb[4])
+	return compareInt(ra, rb), true
+}
+
+var apkSuffixPattern = regexp.MustCompile(`^([a-z]*)([0-9]*)$`)
+
+func compareApkSuffixes(a, b string) int {
+	ma := apkSuffixPattern.FindStringSubmatch(a)
+	mb := apkSuffixPattern.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return strings.Compare(a, b)
+	}
+	if res := compareInt(getApkSuffixRank(ma[1]), getApkSuffixRank(mb[1])); res != 0 {
+		return res
+	}
+	na, _ := strconv.Atoi(ma[2])
+	nb, _ := strconv.Atoi(mb[2])
+	return compareInt(na, nb)
+}
+
+func getApkSuffixRank(s string) int {
+	for i, v := range apkSuffixes {
+		if v == s {
+			return i
+		}
+	}
+	return len(apkSuffixes)
+}
@@ -0,0 +1,74 @@
+package services
+
+import "testing"
+
+func TestCompareDebianVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0-1", "1.0-2", -1},
+		{"1.10", "1.9", 1},
+		{"1.0~rc1-1", "1.0-1", -1},
+		{"1.0-1", "1.0-1ubuntu1", -1},
+		{"1:1.0-1", "2.0-1", 1},
+		{"7.81.0-1ubuntu1.15", "7.81.0-1ubuntu1.4", 1},
+		{"2.36-9+deb12u4", "2.36-9+deb12u10", -1},
+		{"1.0a", "1.0+", -1},
+		{"1.0", "1.00", 0},
+	}
+	for _, c := range cases {
+		if res := compareDebianVersions(c.a, c.b); res != c.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", c.a, c.b, c.expected, res)
+		}
+	}
+}
+
+func TestCompareApkVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"1.2.3-r0", "1.2.3-r0", 0},
+		{"1.2.3-r0", "1.2.3-r1", -1},
+		{"1.2.3_rc1-r0", "1.2.3-r0", -1},
+		{"1.2.3_alpha2-r0", "1.2.3_beta1-r0", -1},
+		{"1.2.3-r9", "1.2.10-r0", -1},
+		{"1.2.3a-r0", "1.2.3-r5", 1},
+		{"1.2.3_p1-r0", "1.2.3-r0", 1},
+	}
+	for _, c := range cases {
+		res, ok := compareApkVersions(c.a, c.b)
+		if !ok || res != c.expected {
+			t.Errorf("%s vs %s: expected %d, got %d (ok: %v)", c.a, c.b, c.expected, res, ok)
+		}
+	}
+
+	if _, ok := compareApkVersions("latest", "1.0-r0"); ok {
+		t.Errorf("expected invalid version")
+	}
+}
+
+func TestCompareMavenVersions(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"3.9", "3.9.0", 0},
+		{"3.9", "3.10", -1},
+		{"1.0-alpha1", "1.0-beta1", -1},
+		{"1.0-rc1", "1.0", -1},
+		{"1.0-SNAPSHOT", "1.0", -1},
+		{"1.0-rc1", "1.0-SNAPSHOT", -1},
+		{"1.0", "1.0-sp1", -1},
+		{"1.0-sp1", "1.0.1", -1},
+		{"1.0.Final", "1.0", 0},
+		{"2.12.7.1", "2.12.7", 1},
+	}
+	for _, c := range cases {
+		if res := compareMavenVersions(c.a, c.b); res != c.expected {
+			t.Errorf("%s vs %s: expected %d, got %d", c.a, c.b, c.expected, res)
+		}
+	}
+}
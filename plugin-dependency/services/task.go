@@ -1,28 +1,55 @@
 package services
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	constants2 "github.com/crawlab-team/crawlab-core/constants"
 	"github.com/crawlab-team/crawlab-core/controllers"
 	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	grpc "github.com/crawlab-team/crawlab-grpc"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
 	"github.com/crawlab-team/plugin-dependency/models"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// taskWaitInterval is the interval at which status of tasks is checked when
+// waiting for them to finish.
+const taskWaitInterval = 2 * time.Second
+
 type TaskService struct {
 	parent *Service
 	api    *gin.Engine
+	colA   *mongo2.Col // dependency task archives
 }
 
 func (svc *TaskService) Init() {
 	svc.api.GET("/tasks", svc.getList)
 	svc.api.GET("/tasks/:id/logs", svc.getLogs)
+	svc.api.GET("/tasks/:id/logs/stream", svc.streamLogs)
+	svc.api.POST("/tasks/:id/cancel", svc.cancel)
+	svc.api.POST("/tasks/:id/rollback", svc.rollback)
+	svc.api.GET("/tasks/archives", svc.getArchiveList)
+	svc.api.GET("/tasks/archives/:id/logs", svc.getArchiveLogs)
 }
 
 func (svc *TaskService) getList(c *gin.Context) {
 	// filter
-	query, _ := controllers.GetFilterQuery(c)
+	query, err := svc._getTaskQuery(c, "")
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
 
 	// all
 	all, _ := strconv.ParseBool(c.Query("all"))
@@ -56,6 +83,9 @@ func (svc *TaskService) getList(c *gin.Context) {
 	controllers.HandleSuccessWithListData(c, tasks, total)
 }
 
+// getLogs returns log lines of the task in order of sequence numbers, which
+// can be filtered by stream, i.e. stdout or stderr. Lines are exported as
+// raw text if format is "text".
 func (svc *TaskService) getLogs(c *gin.Context) {
 	id, err := primitive.ObjectIDFromHex(c.Param("id"))
 	if err != nil {
@@ -63,19 +93,458 @@ func (svc *TaskService) getLogs(c *gin.Context) {
 		return
 	}
 
+	// query
+	query := bson.M{"task_id": id}
+	if stream := c.Query("stream"); stream != "" {
+		if stream != constants.LogStreamStdout && stream != constants.LogStreamStderr {
+			controllers.HandleErrorBadRequest(c, errors.New(fmt.Sprintf("invalid stream: %s", stream)))
+			return
+		}
+		query["stream"] = stream
+	}
+
+	// format
+	format := c.Query("format")
+
+	// all
+	all, _ := strconv.ParseBool(c.Query("all"))
+
+	// pagination
+	pagination := controllers.MustGetPagination(c)
+
+	// options
+	opts := &mongo2.FindOptions{
+		Sort: bson.D{{"seq", 1}, {"_id", 1}},
+	}
+	if !all && format != "text" {
+		opts.Skip = (pagination.Page - 1) * pagination.Size
+		opts.Limit = pagination.Size
+	}
+
+	// logs
 	var logList []models.Log
-	if err := svc.parent.colL.Find(bson.M{"task_id": id}, nil).All(&logList); err != nil {
+	if err := svc.parent.colL.Find(query, opts).All(&logList); err != nil && err.Error() != mongo.ErrNoDocuments.Error() {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// export raw text
+	if format == "text" {
+		var lines []string
+		for _, l := range logList {
+			lines = append(lines, l.Content)
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=task-%s.log", id.Hex()))
+		c.String(http.StatusOK, strings.Join(lines, "\n"))
+		return
+	}
+
+	// total
+	total, err := svc.parent.colL.Count(query)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithListData(c, logList, total)
+}
+
+// cancel sends a cancel message to the node running the task, which kills
+// the processes of the task and marks it as cancelled.
+func (svc *TaskService) cancel(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// task
+	var t models.Task
+	if err := svc.parent.colT.FindId(id).One(&t); err != nil {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
+	if t.Status != constants2.TaskStatusRunning {
+		controllers.HandleErrorBadRequest(c, errors.New(fmt.Sprintf("task is not running: %s", t.Status)))
+		return
+	}
+
+	// node
+	nodes, err := svc.parent._getNodes(bson.M{"_id": t.NodeId})
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// mark as cancelled if the node is not available
+	if len(nodes) == 0 || !nodes[0].Active {
+		if err := svc.parent.colT.Update(bson.M{
+			"_id":    t.Id,
+			"status": constants2.TaskStatusRunning,
+		}, bson.M{
+			"$set": bson.M{
+				"status":    constants2.TaskStatusCancelled,
+				"error":     "node is not active",
+				"update_ts": time.Now(),
+			},
+		}); err != nil {
+			controllers.HandleErrorInternalServerError(c, err)
+			return
+		}
+		controllers.HandleSuccess(c)
+		return
+	}
+
+	// message data
+	data, _ := json.Marshal(&entity.TaskMessage{TaskId: t.Id})
+	msgData, _ := json.Marshal(&entity.MessageData{
+		Code: constants.MessageCodeCancelTask,
+		Data: data,
+	})
+
+	// stream message
+	msg := &grpc.StreamMessage{
+		Code:    grpc.StreamMessageCode_SEND,
+		NodeKey: svc.parent.currentNode.GetKey(),
+		From:    "plugin:" + svc.parent.currentNode.GetKey(),
+		To:      "plugin:" + nodes[0].GetKey(),
+		Data:    msgData,
+	}
+
+	// send message
+	if err := svc.parent._send(msg); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccess(c)
+}
+
+// rollback restores versions of dependencies on the node of the task to the
+// ones before the task, i.e. reinstalls changed or removed dependencies with
+// previous versions and uninstalls newly installed ones. A task can be rolled
+// back only once, and not if other tasks ran on the node at the same time.
+func (svc *TaskService) rollback(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// task
+	var t models.Task
+	if err := svc.parent.colT.FindId(id).One(&t); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+	if t.DryRun {
+		controllers.HandleErrorBadRequest(c, errors.New("dry-run task cannot be rolled back"))
+		return
+	}
+	if !isTaskFinished(t.Status) {
+		controllers.HandleErrorBadRequest(c, errors.New(fmt.Sprintf("task is not finished: %s", t.Status)))
+		return
+	}
+	if t.BeforeVersions == nil || t.AfterVersions == nil {
+		controllers.HandleErrorBadRequest(c, errors.New("versions of dependencies are not recorded in task"))
+		return
+	}
+
+	// dependency service
+	depSvc, err := svc.parent._getDependencyService(t.Type)
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// node
+	nodes, err := svc.parent._getNodes(bson.M{"_id": t.NodeId})
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+	if len(nodes) == 0 || !nodes[0].Active {
+		controllers.HandleErrorBadRequest(c, errors.New("node is not active"))
+		return
+	}
+
+	// dependencies changed by other tasks at the same time cannot be told
+	// apart from those changed by the task
+	concurrent, err := svc._hasConcurrentTasks(t)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+	if concurrent {
+		controllers.HandleErrorBadRequest(c, errors.New("task cannot be rolled back as other tasks changed dependencies on the node at the same time"))
+		return
+	}
+
+	// claim the rollback, so that the task is rolled back only once
+	res, err := mongo2.GetMongoDb("").Collection(svc.parent.colT.GetName()).UpdateOne(svc.parent.colT.GetContext(), bson.M{
+		"_id":         t.Id,
+		"rollback_ts": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{
+			"rollback_ts": time.Now(),
+		},
+	})
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, trace.TraceError(err))
+		return
+	}
+	if res.MatchedCount == 0 {
+		controllers.HandleErrorBadRequest(c, errors.New("task has already been rolled back"))
+		return
+	}
+
+	// changes
+	versions, uninstallNames := getRollbackChanges(t.BeforeVersions, t.AfterVersions)
+	var installNames []string
+	for name := range versions {
+		installNames = append(installNames, name)
+	}
+	sort.Strings(installNames)
+
+	// install previous versions
+	var installTaskIds []primitive.ObjectID
+	if len(installNames) > 0 {
+		installTaskIds, err = depSvc._install(entity.InstallPayload{
+			Names:    installNames,
+			Mode:     constants.InstallModeSelectedNodes,
+			NodeIds:  []primitive.ObjectID{t.NodeId},
+			SpiderId: t.SpiderId,
+			Versions: versions,
+		})
+		if err != nil {
+			// release the rollback
+			_ = svc.parent.colT.UpdateId(t.Id, bson.M{"$unset": bson.M{"rollback_ts": ""}})
+			handleInstallError(c, err)
+			return
+		}
+	}
+
+	// uninstall new dependencies after the install is finished, as tasks on
+	// the same node run concurrently in the same environment
+	if len(uninstallNames) > 0 {
+		go func() {
+			if err := svc._runSteps(func() ([]primitive.ObjectID, error) {
+				return installTaskIds, nil
+			}, func() ([]primitive.ObjectID, error) {
+				return depSvc._uninstall(entity.UninstallPayload{
+					Names:    uninstallNames,
+					Mode:     constants.InstallModeSelectedNodes,
+					NodeIds:  []primitive.ObjectID{t.NodeId},
+					SpiderId: t.SpiderId,
+				})
+			}); err != nil {
+				trace.PrintError(err)
+			}
+		}()
+	}
+
+	controllers.HandleSuccessWithData(c, gin.H{
+		"install":   installNames,
+		"uninstall": uninstallNames,
+	})
+}
+
+// _hasConcurrentTasks returns whether other tasks changing dependencies of
+// the same type on the node of the task ran at the same time as it.
+func (svc *TaskService) _hasConcurrentTasks(t models.Task) (res bool, err error) {
+	total, err := svc.parent.colT.Count(bson.M{
+		"_id": bson.M{
+			"$ne": t.Id,
+			"$lt": primitive.NewObjectIDFromTimestamp(t.UpdateTs),
+		},
+		"type":    t.Type,
+		"node_id": t.NodeId,
+		"dry_run": false,
+		"$or": bson.A{
+			bson.M{"status": constants2.TaskStatusRunning},
+			bson.M{"update_ts": bson.M{"$gt": t.Id.Timestamp()}},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return total > 0, nil
+}
+
+// taskStep starts tasks and returns their ids.
+type taskStep func() (taskIds []primitive.ObjectID, err error)
+
+// _runSteps runs steps one after another, starting tasks of a step only
+// after tasks of the previous step are finished. Steps after a failed task
+// are skipped.
+func (svc *TaskService) _runSteps(steps ...taskStep) (err error) {
+	for _, step := range steps {
+		taskIds, err := step()
+		if err != nil {
+			return err
+		}
+		if err := svc._waitTasks(taskIds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// _waitTasks waits for the tasks to finish, which are eventually finished
+// by nodes or by the reaper. An error is returned if any task is not
+// finished successfully.
+func (svc *TaskService) _waitTasks(taskIds []primitive.ObjectID) (err error) {
+	if len(taskIds) == 0 {
+		return nil
+	}
+	for {
+		var tasks []models.Task
+		if err := svc.parent.colT.Find(bson.M{"_id": bson.M{"$in": taskIds}}, nil).All(&tasks); err != nil {
+			return err
+		}
+		finished := true
+		for _, t := range tasks {
+			if !isTaskFinished(t.Status) {
+				finished = false
+				break
+			}
+		}
+		if finished {
+			for _, t := range tasks {
+				if t.Status != constants2.TaskStatusFinished {
+					return errors.New(fmt.Sprintf("task %s is %s: %s", t.Id.Hex(), t.Status, t.Error))
+				}
+			}
+			return nil
+		}
+		time.Sleep(taskWaitInterval)
+	}
+}
+
+// getRollbackChanges returns previous versions of dependencies changed or
+// removed by a task, and names of dependencies newly installed by it.
+func getRollbackChanges(beforeVersions, afterVersions []entity.DependencyVersion) (versions map[string]string, uninstallNames []string) {
+	before := map[string]string{}
+	for _, v := range beforeVersions {
+		before[v.Name] = v.Version
+	}
+	after := map[string]string{}
+	for _, v := range afterVersions {
+		after[v.Name] = v.Version
+	}
+
+	versions = map[string]string{}
+	for name, v := range before {
+		if after[name] != v {
+			versions[name] = v
+		}
+	}
+	for name := range after {
+		if _, ok := before[name]; !ok {
+			uninstallNames = append(uninstallNames, name)
+		}
+	}
+	sort.Strings(uninstallNames)
+
+	return versions, uninstallNames
+}
+
+// _setTaskError marks the task as error with the reason.
+func (svc *TaskService) _setTaskError(id primitive.ObjectID, reason string) {
+	if err := svc.parent.colT.UpdateId(id, bson.M{
+		"$set": bson.M{
+			"status":    constants2.TaskStatusError,
+			"error":     reason,
+			"update_ts": time.Now(),
+		},
+	}); err != nil {
+		trace.PrintError(err)
+	}
+}
+
+// _reap marks running tasks as error if they are not acknowledged by the
+// node in time, e.g. the message is lost, or if the node stops sending
+// heartbeats, e.g. the node is down.
+func (svc *TaskService) _reap() {
+	now := time.Now()
+
+	// unacknowledged tasks
+	if err := svc.parent.colT.Update(bson.M{
+		"status":    constants2.TaskStatusRunning,
+		"ack_ts":    bson.M{"$exists": false},
+		"update_ts": bson.M{"$lt": now.Add(-constants.TaskAckTimeout * time.Second)},
+	}, bson.M{
+		"$set": bson.M{
+			"status":    constants2.TaskStatusError,
+			"error":     fmt.Sprintf("not acknowledged by node within %ds", constants.TaskAckTimeout),
+			"update_ts": now,
+		},
+	}); err != nil && err.Error() != mongo.ErrNoDocuments.Error() {
+		trace.PrintError(err)
+	}
+
+	// silent tasks
+	if err := svc.parent.colT.Update(bson.M{
+		"status":       constants2.TaskStatusRunning,
+		"ack_ts":       bson.M{"$exists": true},
+		"heartbeat_ts": bson.M{"$lt": now.Add(-constants.TaskHeartbeatTimeout * time.Second)},
+	}, bson.M{
+		"$set": bson.M{
+			"status":    constants2.TaskStatusError,
+			"error":     fmt.Sprintf("no heartbeat from node for %ds", constants.TaskHeartbeatTimeout),
+			"update_ts": now,
+		},
+	}); err != nil && err.Error() != mongo.ErrNoDocuments.Error() {
+		trace.PrintError(err)
+	}
+}
+
+// _getTaskQuery returns the query of tasks by filter conditions, as well as
+// by node_id, name (dependency name), action, status and type in query
+// string. Fields are prefixed for querying archived tasks.
+func (svc *TaskService) _getTaskQuery(c *gin.Context, prefix string) (query bson.M, err error) {
+	// filter
+	query, _ = controllers.GetFilterQuery(c)
+	if query == nil {
+		query = bson.M{}
+	}
+	if prefix != "" {
+		prefixedQuery := bson.M{}
+		for k, v := range query {
+			prefixedQuery[prefix+k] = v
+		}
+		query = prefixedQuery
+	}
+
+	// node
+	if nodeIdStr := c.Query("node_id"); nodeIdStr != "" {
+		nodeId, err := primitive.ObjectIDFromHex(nodeIdStr)
+		if err != nil {
+			return nil, err
+		}
+		query[prefix+"node_id"] = nodeId
+	}
+
+	// other fields
+	for param, field := range map[string]string{
+		"name":   "dep_names",
+		"action": "action",
+		"status": "status",
+		"type":   "type",
+	} {
+		if v := c.Query(param); v != "" {
+			query[prefix+field] = v
+		}
+	}
 
-	controllers.HandleSuccessWithData(c, logList)
+	return query, nil
 }
 
 func NewTaskService(parent *Service) (svc *TaskService) {
 	svc = &TaskService{
 		parent: parent,
 		api:    parent.GetApi(),
+		colA:   mongo2.GetMongoCol(constants.DependencyTaskArchivesColName),
 	}
 
 	return svc
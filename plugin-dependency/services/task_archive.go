@@ -0,0 +1,240 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	constants2 "github.com/crawlab-team/crawlab-core/constants"
+	"github.com/crawlab-team/crawlab-core/controllers"
+	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/crawlab-team/go-trace"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// taskCleanupBatchSize is the number of tasks archived or deleted at a time.
+const taskCleanupBatchSize = 100
+
+func (svc *TaskService) getArchiveList(c *gin.Context) {
+	// filter
+	query, err := svc._getTaskQuery(c, "task.")
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// pagination
+	pagination := controllers.MustGetPagination(c)
+
+	// options
+	opts := &mongo2.FindOptions{
+		Sort:  bson.D{{"_id", -1}},
+		Skip:  (pagination.Page - 1) * pagination.Size,
+		Limit: pagination.Size,
+	}
+
+	// archived tasks
+	var archives []models.TaskArchive
+	if err := svc.colA.Find(query, opts).All(&archives); err != nil && err.Error() != mongo.ErrNoDocuments.Error() {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+	var tasks []models.Task
+	for _, a := range archives {
+		tasks = append(tasks, a.Task)
+	}
+
+	// total
+	total, err := svc.colA.Count(query)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithListData(c, tasks, total)
+}
+
+func (svc *TaskService) getArchiveLogs(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	// archived task
+	var a models.TaskArchive
+	if err := svc.colA.FindId(id).One(&a); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// logs
+	var logList []models.Log
+	if err := decompressJson(a.Logs, &logList); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, logList)
+}
+
+// _cleanup archives or deletes tasks beyond retention of all settings,
+// along with their logs.
+func (svc *TaskService) _cleanup() {
+	var settings []models.Setting
+	if err := svc.parent.colS.Find(bson.M{}, nil).All(&settings); err != nil {
+		if err.Error() != mongo.ErrNoDocuments.Error() {
+			trace.PrintError(err)
+		}
+		return
+	}
+	for _, s := range settings {
+		if err := svc._cleanupTasks(s); err != nil {
+			trace.PrintError(err)
+		}
+	}
+}
+
+// _cleanupTasks archives tasks of the setting beyond retention as per its
+// archive mode, and then deletes them with their logs. Running tasks are
+// left to the reaper.
+func (svc *TaskService) _cleanupTasks(s models.Setting) (err error) {
+	// retention
+	retentionDays := s.TaskRetentionDays
+	if retentionDays <= 0 {
+		retentionDays = constants.DefaultTaskRetentionDays
+	}
+	query := bson.M{
+		"type":      s.Key,
+		"status":    bson.M{"$ne": constants2.TaskStatusRunning},
+		"update_ts": bson.M{"$lt": time.Now().AddDate(0, 0, -retentionDays)},
+	}
+
+	for {
+		// tasks
+		var tasks []models.Task
+		if err := svc.parent.colT.Find(query, &mongo2.FindOptions{
+			Sort:  bson.D{{"_id", 1}},
+			Limit: taskCleanupBatchSize,
+		}).All(&tasks); err != nil {
+			if err.Error() == mongo.ErrNoDocuments.Error() {
+				return nil
+			}
+			return trace.TraceError(err)
+		}
+		if len(tasks) == 0 {
+			return nil
+		}
+
+		// archive
+		var taskIds []primitive.ObjectID
+		for _, t := range tasks {
+			if err := svc._archiveTask(s, t); err != nil {
+				return err
+			}
+			taskIds = append(taskIds, t.Id)
+		}
+
+		// delete
+		if err := svc.parent.colL.Delete(bson.M{"task_id": bson.M{"$in": taskIds}}); err != nil {
+			return trace.TraceError(err)
+		}
+		if err := svc.parent.colT.Delete(bson.M{"_id": bson.M{"$in": taskIds}}); err != nil {
+			return trace.TraceError(err)
+		}
+
+		if len(tasks) < taskCleanupBatchSize {
+			return nil
+		}
+	}
+}
+
+// _archiveTask archives the task with its logs to the archive collection or
+// to a gzip-compressed json file at <archive path>/<type>/<task id>.json.gz.
+func (svc *TaskService) _archiveTask(s models.Setting, t models.Task) (err error) {
+	// skip if not archived
+	if s.TaskArchiveMode == constants.TaskArchiveModeNone {
+		return nil
+	}
+
+	// logs in the order of lines
+	var logList []models.Log
+	if err := svc.parent.colL.Find(bson.M{"task_id": t.Id}, &mongo2.FindOptions{
+		Sort: bson.D{{"seq", 1}, {"_id", 1}},
+	}).All(&logList); err != nil && err.Error() != mongo.ErrNoDocuments.Error() {
+		return trace.TraceError(err)
+	}
+
+	switch s.TaskArchiveMode {
+	case constants.TaskArchiveModeCollection:
+		data, err := compressJson(logList)
+		if err != nil {
+			return err
+		}
+		a := models.TaskArchive{
+			Id:        t.Id,
+			Task:      t,
+			Logs:      data,
+			ArchiveTs: time.Now(),
+		}
+		if err := svc.colA.ReplaceWithOptions(bson.M{"_id": t.Id}, a, (&options.ReplaceOptions{}).SetUpsert(true)); err != nil {
+			return err
+		}
+	case constants.TaskArchiveModeFile:
+		data, err := compressJson(taskArchiveFile{Task: t, Logs: logList})
+		if err != nil {
+			return err
+		}
+		dirPath := filepath.Join(s.TaskArchivePath, t.Type)
+		if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+			return trace.TraceError(err)
+		}
+		filePath := filepath.Join(dirPath, t.Id.Hex()+".json.gz")
+		if err := ioutil.WriteFile(filePath, data, os.FileMode(0644)); err != nil {
+			return trace.TraceError(err)
+		}
+	}
+
+	return nil
+}
+
+// taskArchiveFile is the content of a task archive file.
+type taskArchiveFile struct {
+	Task models.Task  `json:"task"`
+	Logs []models.Log `json:"logs"`
+}
+
+// compressJson marshals the value into gzip-compressed json.
+func compressJson(v interface{}) (data []byte, err error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, trace.TraceError(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// decompressJson unmarshals gzip-compressed json into the value.
+func decompressJson(data []byte, v interface{}) (err error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return trace.TraceError(err)
+	}
+	return nil
+}
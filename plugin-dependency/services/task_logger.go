@@ -0,0 +1,73 @@
+package services
+
+import (
+	"bufio"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io"
+	"sync"
+	"time"
+)
+
+// taskLogBatchSize is the number of log lines sent to the master node at a
+// time.
+const taskLogBatchSize = 10
+
+// taskLogFlushInterval is the interval at which pending log lines are sent
+// even if the batch is not full, so that logs can be followed live.
+const taskLogFlushInterval = time.Second
+
+// taskLogger collects output lines of commands of a task from multiple
+// streams and sends them to the master node in batches.
+type taskLogger struct {
+	parent *Service
+	taskId primitive.ObjectID
+	mu     sync.Mutex
+	lines  []entity.LogLine
+}
+
+// scan reads lines from the stream until it is closed.
+func (l *taskLogger) scan(r io.Reader, stream string) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		l.add(stream, scanner.Text())
+	}
+}
+
+// add appends a line with the next sequence number of the task, and sends
+// lines if the batch is full.
+func (l *taskLogger) add(stream, content string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lines = append(l.lines, entity.LogLine{
+		Stream:  stream,
+		Seq:     l.parent._nextLogSeq(l.taskId),
+		Content: content,
+		Ts:      time.Now(),
+	})
+	if len(l.lines) >= taskLogBatchSize {
+		l._flush()
+	}
+}
+
+// flush sends pending lines.
+func (l *taskLogger) flush() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l._flush()
+}
+
+func (l *taskLogger) _flush() {
+	if len(l.lines) == 0 {
+		return
+	}
+	l.parent._sendLogLines(l.taskId, l.lines)
+	l.lines = nil
+}
+
+func newTaskLogger(parent *Service, taskId primitive.ObjectID) (l *taskLogger) {
+	return &taskLogger{
+		parent: parent,
+		taskId: taskId,
+	}
+}
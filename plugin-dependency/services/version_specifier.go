@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Masterminds/semver/v3"
+	"github.com/crawlab-team/plugin-dependency/constants"
+	"github.com/crawlab-team/plugin-dependency/entity"
+	"strings"
+)
+
+// _mergePackages merges packages of the payload into its names and exact
+// versions, and returns version specifiers by name.
+func (svc *baseService) _mergePackages(payload *entity.InstallPayload) (specifiers map[string]string, err error) {
+	if len(payload.Packages) == 0 {
+		return nil, nil
+	}
+	if payload.Versions == nil {
+		payload.Versions = map[string]string{}
+	}
+	specifiers = map[string]string{}
+	names := map[string]bool{}
+	for _, name := range payload.Names {
+		names[name] = true
+	}
+	for _, p := range payload.Packages {
+		name := strings.TrimSpace(p.Name)
+		if name == "" {
+			return nil, errors.New("package name is required")
+		}
+		if p.Version != "" && p.Specifier != "" {
+			return nil, errors.New(fmt.Sprintf("either version or specifier should be given for %s", name))
+		}
+		if p.Specifier != "" {
+			if err := svc._validateSpecifier(p.Specifier); err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid version specifier of %s: %v", name, err))
+			}
+			specifiers[name] = strings.TrimSpace(p.Specifier)
+		} else if p.Version != "" {
+			payload.Versions[name] = strings.TrimSpace(p.Version)
+		}
+		if !names[name] {
+			payload.Names = append(payload.Names, name)
+			names[name] = true
+		}
+	}
+	return specifiers, nil
+}
+
+// _validateSpecifier validates a version specifier in the versioning scheme
+// of the dependency type.
+func (svc *baseService) _validateSpecifier(specifier string) (err error) {
+	switch svc.key {
+	case constants.DependencyTypePython:
+		ss, err := parsePythonSpecifierSet(specifier)
+		if err != nil {
+			return err
+		}
+		if len(ss) == 0 {
+			return errors.New("empty version specifier")
+		}
+		return nil
+	case constants.DependencyTypeNode:
+		if _, err := semver.NewConstraint(specifier); err != nil {
+			return err
+		}
+		return nil
+	default:
+		return errors.New(fmt.Sprintf("version specifiers are not supported for %s", svc.key))
+	}
+}
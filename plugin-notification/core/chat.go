@@ -0,0 +1,50 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/imroc/req"
+	"strings"
+)
+
+// postChatMessage posts the message to the webhook of a chat platform, which
+// responds with a 2xx status code on success.
+func postChatMessage(webhook string, data *req.Param) error {
+	// request header
+	header := req.Header{
+		"Content-Type": "application/json; charset=utf-8",
+	}
+
+	// perform request
+	res, err := req.Post(webhook, header, req.BodyJSON(data))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// validate status code
+	if code := res.Response().StatusCode; code < 200 || code >= 300 {
+		return errors.New(fmt.Sprintf("unexpected status code %d: %s", code, res.String()))
+	}
+
+	return nil
+}
+
+// splitText splits the text by lines into chunks of the max length.
+func splitText(text string, max int) (chunks []string) {
+	var sb strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		if sb.Len() > 0 && sb.Len()+len(line)+1 > max {
+			chunks = append(chunks, sb.String())
+			sb.Reset()
+		}
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		sb.WriteString(truncate(line, max))
+	}
+	if strings.TrimSpace(sb.String()) != "" {
+		chunks = append(chunks, sb.String())
+	}
+	return chunks
+}
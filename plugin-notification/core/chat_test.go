@@ -0,0 +1,131 @@
+package core
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+const testChatContent = `# Task
+
+- **Status**: error
+
+|Key|Value|
+|:-:|:--|
+|Node|n1 <master>|`
+
+// decodeChatTestBody decodes the json body received by the test server.
+func decodeChatTestBody(t *testing.T, data string) (body map[string]interface{}) {
+	if err := json.Unmarshal([]byte(data), &body); err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func TestSendSlackNotification(t *testing.T) {
+	svr, _, bodies := newWebhookTestServer(t, http.StatusOK, "ok")
+
+	if err := SendSlackNotification(svr.URL, "Task Update", testChatContent); err != nil {
+		t.Fatal(err)
+	}
+
+	body := decodeChatTestBody(t, <-bodies)
+	blocks := body["blocks"].([]interface{})
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d", len(blocks))
+	}
+	if blocks[0].(map[string]interface{})["type"] != "header" {
+		t.Errorf("expected header block, got %v", blocks[0])
+	}
+	text := blocks[1].(map[string]interface{})["text"].(map[string]interface{})["text"].(string)
+	expected := "*Task*\n\n• *Status*: error\n\nKey | Value\nNode | n1 &lt;master&gt;"
+	if text != expected {
+		t.Errorf("expected %q, got %q", expected, text)
+	}
+}
+
+func TestSendTeamsNotification(t *testing.T) {
+	svr, _, bodies := newWebhookTestServer(t, http.StatusAccepted, "")
+
+	if err := SendTeamsNotification(svr.URL, "Task Update", testChatContent); err != nil {
+		t.Fatal(err)
+	}
+
+	body := decodeChatTestBody(t, <-bodies)
+	attachment := body["attachments"].([]interface{})[0].(map[string]interface{})
+	if attachment["contentType"] != "application/vnd.microsoft.card.adaptive" {
+		t.Errorf("unexpected content type %v", attachment["contentType"])
+	}
+	var texts []string
+	for _, b := range attachment["content"].(map[string]interface{})["body"].([]interface{}) {
+		texts = append(texts, b.(map[string]interface{})["text"].(string))
+	}
+	expected := []string{"Task Update", "**Task**", "- **Status**: error", "Key | Value", "Node | n1 <master>"}
+	if strings.Join(texts, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected %v, got %v", expected, texts)
+	}
+}
+
+func TestSendDiscordNotification(t *testing.T) {
+	svr, _, bodies := newWebhookTestServer(t, http.StatusNoContent, "")
+
+	if err := SendDiscordNotification(svr.URL, "Task Update", testChatContent); err != nil {
+		t.Fatal(err)
+	}
+
+	body := decodeChatTestBody(t, <-bodies)
+	embed := body["embeds"].([]interface{})[0].(map[string]interface{})
+	if embed["title"] != "Task Update" {
+		t.Errorf("unexpected title %v", embed["title"])
+	}
+	if strings.Contains(embed["description"].(string), ":--") {
+		t.Errorf("expected tables to be flattened, got %v", embed["description"])
+	}
+}
+
+func TestSendDiscordNotification_Error(t *testing.T) {
+	svr, _, _ := newWebhookTestServer(t, http.StatusBadRequest, `{"message": "invalid"}`)
+
+	if err := SendDiscordNotification(svr.URL, "Task Update", testChatContent); err == nil {
+		t.Fatal("expected error for status code 400")
+	}
+}
+
+func TestSendTelegramNotification(t *testing.T) {
+	svr, reqs, bodies := newWebhookTestServer(t, http.StatusOK, `{"ok": true}`)
+
+	tg := &NotificationSettingTelegram{
+		BotToken: "token",
+		ChatId:   "123",
+		ApiUrl:   svr.URL,
+	}
+	if err := SendTelegramNotification(tg, "Task <Update>", testChatContent); err != nil {
+		t.Fatal(err)
+	}
+
+	if r := <-reqs; r.URL.Path != "/bottoken/sendMessage" {
+		t.Errorf("unexpected path %s", r.URL.Path)
+	}
+	body := decodeChatTestBody(t, <-bodies)
+	if body["chat_id"] != "123" || body["parse_mode"] != "HTML" {
+		t.Errorf("unexpected body %v", body)
+	}
+	expected := "<b>Task &lt;Update&gt;</b>\n\n<b>Task</b>\n\n• <b>Status</b>: error\n\nKey | Value\nNode | n1 &lt;master&gt;"
+	if body["text"] != expected {
+		t.Errorf("expected %q, got %q", expected, body["text"])
+	}
+}
+
+func TestSendTelegramNotification_Error(t *testing.T) {
+	svr, _, _ := newWebhookTestServer(t, http.StatusBadRequest, `{"ok": false, "description": "Bad Request: chat not found"}`)
+
+	tg := &NotificationSettingTelegram{
+		BotToken: "token",
+		ChatId:   "123",
+		ApiUrl:   svr.URL,
+	}
+	if err := SendTelegramNotification(tg, "Task Update", testChatContent); err == nil || err.Error() != "Bad Request: chat not found" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,546 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	parser "github.com/crawlab-team/template-parser"
+	"go.mongodb.org/mongo-driver/bson"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Condition is a parsed condition expression of notification settings, which
+// is evaluated against event documents. Expressions consist of
+//   - paths of values as in templates, e.g. status or :task_stat.result_count
+//   - literals, i.e. strings, numbers, true, false, null and lists like [1, 2]
+//   - comparisons by ==, !=, <, <=, >, >=, in and not in
+//   - logical operators &&, ||, ! (or and, or, not) and parentheses
+//
+// For example: status in ["error", "abnormal"] && :task_stat.result_count == 0
+type Condition struct {
+	root conditionNode
+}
+
+// Match returns whether the document matches the condition. Values of paths
+// are resolved by resolve.
+func (c *Condition) Match(resolve func(path string) interface{}) (ok bool, err error) {
+	value, err := c.root.eval(resolve)
+	if err != nil {
+		return false, err
+	}
+	return isTruthy(value), nil
+}
+
+// ParseCondition parses a condition expression.
+func ParseCondition(expr string) (c *Condition, err error) {
+	tokens, err := tokenizeCondition(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != conditionTokenEOF {
+		return nil, errors.New(fmt.Sprintf("unexpected %s at position %d", t.text, t.pos))
+	}
+	return &Condition{root: root}, nil
+}
+
+// _matchCondition returns whether the event document matches the condition
+// of the setting. Documents match if the condition is empty, and do not
+// match if the condition is invalid.
+func (svc *Service) _matchCondition(s *NotificationSetting, doc bson.M) bool {
+	if strings.TrimSpace(s.Condition) == "" {
+		return true
+	}
+	c, err := ParseCondition(s.Condition)
+	if err != nil {
+		log.Warnf("parsing condition of %s error: %v", s.Name, err)
+		return false
+	}
+	ok, err := c.Match(func(path string) interface{} {
+		return getDocumentValue(doc, path)
+	})
+	if err != nil {
+		log.Warnf("evaluating condition of %s error: %v", s.Name, err)
+		return false
+	}
+	return ok
+}
+
+// getDocumentValue returns the value of the path in the document in the same
+// way as placeholders of templates, e.g. :task_stat.result_count.
+func getDocumentValue(doc bson.M, path string) (value interface{}) {
+	if !strings.HasPrefix(path, "$") {
+		path = "$." + path
+	}
+	v, err := parser.NewVariable(doc, path)
+	if err != nil {
+		return nil
+	}
+	value, err = v.GetValue()
+	if err != nil {
+		return nil
+	}
+	return value
+}
+
+// validateCondition validates the condition expression of settings, which
+// may be empty.
+func validateCondition(expr string) (err error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil
+	}
+	if _, err := ParseCondition(expr); err != nil {
+		return errors.New(fmt.Sprintf("invalid condition: %v", err))
+	}
+	return nil
+}
+
+type conditionTokenKind int
+
+const (
+	conditionTokenEOF conditionTokenKind = iota
+	conditionTokenPath
+	conditionTokenString
+	conditionTokenNumber
+	conditionTokenOperator
+	conditionTokenPunct
+)
+
+type conditionToken struct {
+	kind  conditionTokenKind
+	text  string
+	value interface{}
+	pos   int
+}
+
+var conditionKeywordOperators = map[string]string{
+	"and": "&&",
+	"or":  "||",
+	"not": "!",
+	"in":  "in",
+}
+
+func tokenizeCondition(expr string) (tokens []conditionToken, err error) {
+	runes := []rune(expr)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		// strings
+		case r == '"' || r == '\'':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != r; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j >= len(runes) {
+				return nil, errors.New(fmt.Sprintf("unterminated string at position %d", i))
+			}
+			tokens = append(tokens, conditionToken{kind: conditionTokenString, text: string(runes[i : j+1]), value: sb.String(), pos: i})
+			i = j + 1
+
+		// numbers
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			j := i + 1
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			text := string(runes[i:j])
+			value, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("invalid number %s at position %d", text, i))
+			}
+			tokens = append(tokens, conditionToken{kind: conditionTokenNumber, text: text, value: value, pos: i})
+			i = j
+
+		// paths and keywords
+		case unicode.IsLetter(r) || r == '_' || r == '$' || r == ':':
+			j := i + 1
+			for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j]) || strings.ContainsRune("_$:.[]", runes[j])) {
+				// brackets are part of paths only as in user[create]
+				if runes[j] == '[' && !strings.HasSuffix(string(runes[i:j]), "user") {
+					break
+				}
+				if runes[j] == ']' && !strings.Contains(string(runes[i:j]), "[") {
+					break
+				}
+				j++
+			}
+			text := string(runes[i:j])
+			if op, ok := conditionKeywordOperators[strings.ToLower(text)]; ok {
+				tokens = append(tokens, conditionToken{kind: conditionTokenOperator, text: op, pos: i})
+			} else {
+				tokens = append(tokens, conditionToken{kind: conditionTokenPath, text: text, pos: i})
+			}
+			i = j
+
+		// operators
+		case strings.ContainsRune("=!<>&|", r):
+			text := string(r)
+			if i+1 < len(runes) {
+				two := string(runes[i : i+2])
+				switch two {
+				case "==", "!=", "<=", ">=", "&&", "||":
+					text = two
+				}
+			}
+			switch text {
+			case "=", "&", "|":
+				return nil, errors.New(fmt.Sprintf("invalid operator %s at position %d", text, i))
+			}
+			tokens = append(tokens, conditionToken{kind: conditionTokenOperator, text: text, pos: i})
+			i += len([]rune(text))
+
+		// punctuation
+		case strings.ContainsRune("()[],", r):
+			tokens = append(tokens, conditionToken{kind: conditionTokenPunct, text: string(r), pos: i})
+			i++
+
+		default:
+			return nil, errors.New(fmt.Sprintf("unexpected character %c at position %d", r, i))
+		}
+	}
+	tokens = append(tokens, conditionToken{kind: conditionTokenEOF, text: "end of expression", pos: len(runes)})
+	return tokens, nil
+}
+
+type conditionParser struct {
+	tokens []conditionToken
+	pos    int
+}
+
+func (p *conditionParser) peek() conditionToken {
+	return p.tokens[p.pos]
+}
+
+func (p *conditionParser) next() conditionToken {
+	t := p.tokens[p.pos]
+	if t.kind != conditionTokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *conditionParser) isOperator(text string) bool {
+	t := p.peek()
+	return t.kind == conditionTokenOperator && t.text == text
+}
+
+func (p *conditionParser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == conditionTokenPunct && t.text == text
+}
+
+func (p *conditionParser) expectPunct(text string) (err error) {
+	if !p.isPunct(text) {
+		t := p.peek()
+		return errors.New(fmt.Sprintf("expected %s but got %s at position %d", text, t.text, t.pos))
+	}
+	p.next()
+	return nil
+}
+
+func (p *conditionParser) parseOr() (node conditionNode, err error) {
+	node, err = p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		node = &conditionLogicalNode{op: "||", left: node, right: right}
+	}
+	return node, nil
+}
+
+func (p *conditionParser) parseAnd() (node conditionNode, err error) {
+	node, err = p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		node = &conditionLogicalNode{op: "&&", left: node, right: right}
+	}
+	return node, nil
+}
+
+func (p *conditionParser) parseNot() (node conditionNode, err error) {
+	if p.isOperator("!") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &conditionNotNode{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *conditionParser) parseComparison() (node conditionNode, err error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	// operator
+	var op string
+	switch {
+	case p.isOperator("==") || p.isOperator("!=") || p.isOperator("<") || p.isOperator("<=") || p.isOperator(">") || p.isOperator(">=") || p.isOperator("in"):
+		op = p.next().text
+	case p.isOperator("!") && p.tokens[p.pos+1].kind == conditionTokenOperator && p.tokens[p.pos+1].text == "in":
+		// not in
+		p.next()
+		p.next()
+		op = "not in"
+	default:
+		return left, nil
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &conditionComparisonNode{op: op, left: left, right: right}, nil
+}
+
+func (p *conditionParser) parseOperand() (node conditionNode, err error) {
+	t := p.next()
+	switch t.kind {
+	case conditionTokenString, conditionTokenNumber:
+		return &conditionLiteralNode{value: t.value}, nil
+	case conditionTokenPath:
+		switch t.text {
+		case "true":
+			return &conditionLiteralNode{value: true}, nil
+		case "false":
+			return &conditionLiteralNode{value: false}, nil
+		case "null":
+			return &conditionLiteralNode{value: nil}, nil
+		}
+		return &conditionPathNode{path: t.text}, nil
+	case conditionTokenPunct:
+		switch t.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expectPunct(")"); err != nil {
+				return nil, err
+			}
+			return node, nil
+		case "[":
+			list := &conditionListNode{}
+			for !p.isPunct("]") {
+				item, err := p.parseOperand()
+				if err != nil {
+					return nil, err
+				}
+				list.items = append(list.items, item)
+				if !p.isPunct(",") {
+					break
+				}
+				p.next()
+			}
+			if err := p.expectPunct("]"); err != nil {
+				return nil, err
+			}
+			return list, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("unexpected %s at position %d", t.text, t.pos))
+}
+
+type conditionNode interface {
+	eval(resolve func(path string) interface{}) (value interface{}, err error)
+}
+
+type conditionLiteralNode struct {
+	value interface{}
+}
+
+func (n *conditionLiteralNode) eval(resolve func(path string) interface{}) (value interface{}, err error) {
+	return n.value, nil
+}
+
+type conditionPathNode struct {
+	path string
+}
+
+func (n *conditionPathNode) eval(resolve func(path string) interface{}) (value interface{}, err error) {
+	return normalizeConditionValue(resolve(n.path)), nil
+}
+
+type conditionListNode struct {
+	items []conditionNode
+}
+
+func (n *conditionListNode) eval(resolve func(path string) interface{}) (value interface{}, err error) {
+	var list []interface{}
+	for _, item := range n.items {
+		v, err := item.eval(resolve)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+	}
+	return list, nil
+}
+
+type conditionNotNode struct {
+	operand conditionNode
+}
+
+func (n *conditionNotNode) eval(resolve func(path string) interface{}) (value interface{}, err error) {
+	v, err := n.operand.eval(resolve)
+	if err != nil {
+		return nil, err
+	}
+	return !isTruthy(v), nil
+}
+
+type conditionLogicalNode struct {
+	op    string
+	left  conditionNode
+	right conditionNode
+}
+
+func (n *conditionLogicalNode) eval(resolve func(path string) interface{}) (value interface{}, err error) {
+	left, err := n.left.eval(resolve)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" && !isTruthy(left) {
+		return false, nil
+	}
+	if n.op == "||" && isTruthy(left) {
+		return true, nil
+	}
+	right, err := n.right.eval(resolve)
+	if err != nil {
+		return nil, err
+	}
+	return isTruthy(right), nil
+}
+
+type conditionComparisonNode struct {
+	op    string
+	left  conditionNode
+	right conditionNode
+}
+
+func (n *conditionComparisonNode) eval(resolve func(path string) interface{}) (value interface{}, err error) {
+	left, err := n.left.eval(resolve)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(resolve)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return conditionEqual(left, right), nil
+	case "!=":
+		return !conditionEqual(left, right), nil
+	case "in", "not in":
+		list, ok := right.([]interface{})
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("right operand of %s is not a list", n.op))
+		}
+		found := false
+		for _, item := range list {
+			if conditionEqual(left, item) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in"), nil
+	}
+
+	// ordering of numbers or strings, which is false for missing values
+	if left == nil || right == nil {
+		return false, nil
+	}
+	var res int
+	switch l := left.(type) {
+	case float64:
+		r, ok := right.(float64)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("cannot compare %v with %v", left, right))
+		}
+		switch {
+		case l < r:
+			res = -1
+		case l > r:
+			res = 1
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, errors.New(fmt.Sprintf("cannot compare %v with %v", left, right))
+		}
+		res = strings.Compare(l, r)
+	default:
+		return nil, errors.New(fmt.Sprintf("cannot compare %v with %v", left, right))
+	}
+	switch n.op {
+	case "<":
+		return res < 0, nil
+	case "<=":
+		return res <= 0, nil
+	case ">":
+		return res > 0, nil
+	default:
+		return res >= 0, nil
+	}
+}
+
+func conditionEqual(a, b interface{}) bool {
+	return fmt.Sprintf("%T:%v", a, a) == fmt.Sprintf("%T:%v", b, b)
+}
+
+// normalizeConditionValue converts values of documents to the types of
+// literals, i.e. numbers to float64 and arrays to lists.
+func normalizeConditionValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int32:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	case bson.A:
+		return normalizeConditionValue([]interface{}(v))
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeConditionValue(item)
+		}
+		return list
+	default:
+		return value
+	}
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	doc := map[string]interface{}{
+		"status":                  "error",
+		"priority":                float64(5),
+		"spider.name":             "test-spider",
+		":task_stat.result_count": float64(0),
+		"tags":                    []interface{}{"a", "b"},
+	}
+	resolve := func(path string) interface{} {
+		return doc[path]
+	}
+
+	testCases := []struct {
+		expr    string
+		matched bool
+	}{
+		{`status in ["error", "abnormal"]`, true},
+		{`status not in ["error", "abnormal"]`, false},
+		{`:task_stat.result_count == 0`, true},
+		{`status == "error" && :task_stat.result_count > 0`, false},
+		{`status == 'running' || priority >= 5`, true},
+		{`not (status == "finished") and priority < 10`, true},
+		{`!(priority != 5)`, true},
+		{`"a" in tags`, true},
+		{`spider.name == "test-spider"`, true},
+		{`missing == null`, true},
+		{`missing > 1`, false},
+		{`status`, true},
+		{`priority == "5"`, false},
+	}
+	for _, tc := range testCases {
+		c, err := ParseCondition(tc.expr)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.expr, err)
+			continue
+		}
+		matched, err := c.Match(resolve)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tc.expr, err)
+			continue
+		}
+		if matched != tc.matched {
+			t.Errorf("%s: expected %v, got %v", tc.expr, tc.matched, matched)
+		}
+	}
+}
+
+func TestParseCondition_Error(t *testing.T) {
+	for _, expr := range []string{
+		`status = "error"`,
+		`status == "error`,
+		`status in ["error"`,
+		`(status == "error"`,
+		`status == "error" &&`,
+		`status == "error" "running"`,
+		`status # 1`,
+	} {
+		if _, err := ParseCondition(expr); err == nil {
+			t.Errorf("%s: expected error", expr)
+		}
+	}
+}
+
+func TestCondition_Match_Error(t *testing.T) {
+	c, err := ParseCondition(`status > 1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Match(func(path string) interface{} { return "error" }); err == nil {
+		t.Error("expected error for comparison of string with number")
+	}
+}
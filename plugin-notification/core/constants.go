@@ -6,10 +6,33 @@ const (
 )
 
 const (
-	NotificationTypeMail   = "mail"
-	NotificationTypeMobile = "mobile"
+	NotificationTypeMail     = "mail"
+	NotificationTypeMobile   = "mobile"
+	NotificationTypeWebhook  = "webhook"
+	NotificationTypeSlack    = "slack"
+	NotificationTypeTeams    = "teams"
+	NotificationTypeDiscord  = "discord"
+	NotificationTypeTelegram = "telegram"
 )
 
 const (
-	NotificationSettingsColName = "notification_settings"
+	NotificationSettingsColName   = "notification_settings"
+	NotificationDeliveriesColName = "notification_deliveries"
 )
+
+const (
+	DeliveryStatusSuccess  = "success"
+	DeliveryStatusFailed   = "failed" // status of failed attempts
+	DeliveryStatusRetrying = "retrying"
+	DeliveryStatusSending  = "sending" // in-flight retry or resend
+	DeliveryStatusDead     = "dead"    // dead letter, which is no longer retried
+)
+
+const (
+	PluginEventDependencyDrift = "plugin:dependency:drift"
+)
+
+// pluginEventList is the list of events sent by other plugins
+var pluginEventList = []string{
+	PluginEventDependencyDrift,
+}
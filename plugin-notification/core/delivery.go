@@ -0,0 +1,367 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/apex/log"
+	"github.com/crawlab-team/crawlab-core/controllers"
+	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	"github.com/crawlab-team/go-trace"
+	parser "github.com/crawlab-team/template-parser"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"time"
+)
+
+const (
+	DeliveryMaxAttempts   = 5
+	DeliveryBaseBackoff   = 30 * time.Second
+	DeliveryMaxBackoff    = 30 * time.Minute
+	deliveryRetryInterval = 10 * time.Second
+
+	// deliverySendingTimeout is the duration after which a delivery being
+	// sent is retried, e.g. if the plugin stopped while sending it.
+	deliverySendingTimeout = 5 * time.Minute
+)
+
+var (
+	errDeliverySettingNotFound = errors.New("notification setting of delivery not found")
+	errDeliveryNotResendable   = errors.New("delivery is already sent or being sent")
+)
+
+// getDeliveryBackoff returns the duration to wait before retrying a delivery
+// after the given number of attempts, which doubles with every attempt.
+func getDeliveryBackoff(attempts int) time.Duration {
+	d := DeliveryBaseBackoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= DeliveryMaxBackoff {
+			return DeliveryMaxBackoff
+		}
+	}
+	return d
+}
+
+// record appends an attempt started at ts and updates the status of the
+// delivery. Failed deliveries are scheduled for retry until they run out of
+// attempts and become dead letters.
+func (d *NotificationDelivery) record(ts time.Time, latency time.Duration, err error) {
+	a := NotificationDeliveryAttempt{
+		Ts:      ts,
+		Status:  DeliveryStatusSuccess,
+		Latency: latency.Milliseconds(),
+	}
+	if err != nil {
+		a.Status = DeliveryStatusFailed
+		a.Error = err.Error()
+	}
+	d.Attempts = append(d.Attempts, a)
+	d.Error = a.Error
+	d.Latency = a.Latency
+	d.NextRetryTs = time.Time{}
+	d.UpdateTs = time.Now()
+
+	switch {
+	case err == nil:
+		d.Status = DeliveryStatusSuccess
+	case len(d.Attempts) >= DeliveryMaxAttempts:
+		d.Status = DeliveryStatusDead
+	default:
+		d.Status = DeliveryStatusRetrying
+		d.NextRetryTs = ts.Add(getDeliveryBackoff(len(d.Attempts)))
+	}
+}
+
+// _deliver sends the notification of the setting for the event and records
+// the delivery.
+func (svc *Service) _deliver(s *NotificationSetting, eventName string, doc bson.M, data []byte) (err error) {
+	// title
+	title, err := parser.Parse(s.Title, doc)
+	if err != nil {
+		log.Warnf("parsing 'title' error: %v", err)
+	}
+
+	// delivery
+	d := NotificationDelivery{
+		Id:          primitive.NewObjectID(),
+		SettingId:   s.Id,
+		SettingName: s.Name,
+		Event:       eventName,
+		Type:        s.Type,
+		Title:       title,
+		Data:        string(data),
+		CreateTs:    time.Now(),
+	}
+
+	// send
+	svc._attempt(&d, s, doc)
+
+	// save
+	if _, err := svc.deliveryCol.Insert(d); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// _attempt sends the notification of the delivery once and records the
+// attempt.
+func (svc *Service) _attempt(d *NotificationDelivery, s *NotificationSetting, doc bson.M) {
+	ts := time.Now()
+	err := svc._send(s, doc)
+	d.record(ts, time.Since(ts), err)
+
+	switch d.Status {
+	case DeliveryStatusRetrying:
+		log.Warnf("delivery %s of notification '%s' failed (attempt %d), retrying at %s: %v", d.Id.Hex(), d.SettingName, len(d.Attempts), d.NextRetryTs.Format(time.RFC3339), err)
+	case DeliveryStatusDead:
+		log.Errorf("delivery %s of notification '%s' failed (attempt %d), moved to dead letters: %v", d.Id.Hex(), d.SettingName, len(d.Attempts), err)
+	}
+}
+
+// _send sends the notification of the setting for the event document.
+func (svc *Service) _send(s *NotificationSetting, doc bson.M) (err error) {
+	switch s.Type {
+	case NotificationTypeMail:
+		return svc.sendMail(s, doc)
+	case NotificationTypeMobile:
+		return svc.sendMobile(s, doc)
+	case NotificationTypeWebhook:
+		return svc.sendWebhook(s, doc)
+	case NotificationTypeSlack:
+		return svc.sendSlack(s, doc)
+	case NotificationTypeTeams:
+		return svc.sendTeams(s, doc)
+	case NotificationTypeDiscord:
+		return svc.sendDiscord(s, doc)
+	case NotificationTypeTelegram:
+		return svc.sendTelegram(s, doc)
+	default:
+		return errors.New(fmt.Sprintf("invalid notification type: %s", s.Type))
+	}
+}
+
+// _claim atomically marks the delivery matching the query as being sent, so
+// that it is not sent twice by concurrent retries and resends. ok is false if
+// the delivery no longer matches the query, i.e. it has been claimed by
+// others in the meantime.
+func (svc *Service) _claim(d *NotificationDelivery, query bson.M) (ok bool, err error) {
+	query["_id"] = d.Id
+	ts := time.Now()
+	res, err := mongo2.GetMongoDb("").Collection(svc.deliveryCol.GetName()).UpdateOne(svc.deliveryCol.GetContext(), query, bson.M{
+		"$set": bson.M{
+			"status":    DeliveryStatusSending,
+			"update_ts": ts,
+		},
+	})
+	if err != nil {
+		return false, trace.TraceError(err)
+	}
+	if res.MatchedCount == 0 {
+		return false, nil
+	}
+	d.Status = DeliveryStatusSending
+	d.UpdateTs = ts
+	return true, nil
+}
+
+// _resend attempts the claimed delivery again with the current notification
+// setting.
+func (svc *Service) _resend(d *NotificationDelivery) (err error) {
+	// setting
+	var s NotificationSetting
+	if err := svc.col.FindId(d.SettingId).One(&s); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			// setting was deleted, so the delivery can no longer be sent
+			d.Status = DeliveryStatusDead
+			d.Error = errDeliverySettingNotFound.Error()
+			d.NextRetryTs = time.Time{}
+			d.UpdateTs = time.Now()
+			if err := svc.deliveryCol.ReplaceId(d.Id, d); err != nil {
+				return err
+			}
+			return errDeliverySettingNotFound
+		}
+		return err
+	}
+
+	// event document
+	var doc bson.M
+	if err := json.Unmarshal([]byte(d.Data), &doc); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// send
+	svc._attempt(d, &s, doc)
+
+	// save
+	return svc.deliveryCol.ReplaceId(d.Id, d)
+}
+
+// retryDeliveries periodically retries failed deliveries that are due.
+func (svc *Service) retryDeliveries() {
+	for {
+		time.Sleep(deliveryRetryInterval)
+		if err := svc._retryDeliveries(); err != nil {
+			trace.PrintError(err)
+		}
+	}
+}
+
+// getDueDeliveriesQuery returns the query of deliveries to retry, including
+// those which have been stuck in sending.
+func getDueDeliveriesQuery(ts time.Time) bson.M {
+	return bson.M{
+		"$or": bson.A{
+			bson.M{
+				"status":        DeliveryStatusRetrying,
+				"next_retry_ts": bson.M{"$lte": ts},
+			},
+			bson.M{
+				"status":    DeliveryStatusSending,
+				"update_ts": bson.M{"$lte": ts.Add(-deliverySendingTimeout)},
+			},
+		},
+	}
+}
+
+func (svc *Service) _retryDeliveries() (err error) {
+	// due deliveries
+	ts := time.Now()
+	var deliveries []NotificationDelivery
+	if err := svc.deliveryCol.Find(getDueDeliveriesQuery(ts), &mongo2.FindOptions{
+		Sort: bson.D{{Key: "next_retry_ts", Value: 1}},
+	}).All(&deliveries); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			return nil
+		}
+		return err
+	}
+
+	for _, d := range deliveries {
+		// claim
+		ok, err := svc._claim(&d, getDueDeliveriesQuery(ts))
+		if err != nil {
+			trace.PrintError(err)
+			continue
+		}
+		if !ok {
+			// resent or retried by others
+			continue
+		}
+
+		// resend
+		if err := svc._resend(&d); err != nil && err != errDeliverySettingNotFound {
+			trace.PrintError(err)
+		}
+	}
+
+	return nil
+}
+
+func (svc *Service) getDeliveryList(c *gin.Context) {
+	svc._getDeliveryList(c, controllers.MustGetFilterQuery(c))
+}
+
+// getDeadLetterList returns deliveries that failed all attempts.
+func (svc *Service) getDeadLetterList(c *gin.Context) {
+	query := controllers.MustGetFilterQuery(c)
+	if query == nil {
+		query = bson.M{}
+	}
+	query["status"] = DeliveryStatusDead
+	svc._getDeliveryList(c, query)
+}
+
+func (svc *Service) getDelivery(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var d NotificationDelivery
+	if err := svc.deliveryCol.FindId(id).One(&d); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, d)
+}
+
+// resendDelivery sends the delivery again, e.g. a dead letter after the
+// notification setting has been fixed.
+func (svc *Service) resendDelivery(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+
+	var d NotificationDelivery
+	if err := svc.deliveryCol.FindId(id).One(&d); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	// claim
+	ok, err := svc._claim(&d, bson.M{
+		"status": bson.M{"$in": []string{DeliveryStatusRetrying, DeliveryStatusDead}},
+	})
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+	if !ok {
+		controllers.HandleErrorBadRequest(c, errDeliveryNotResendable)
+		return
+	}
+
+	// resend
+	if err := svc._resend(&d); err != nil {
+		if err == errDeliverySettingNotFound {
+			controllers.HandleErrorBadRequest(c, err)
+		} else {
+			controllers.HandleErrorInternalServerError(c, err)
+		}
+		return
+	}
+
+	controllers.HandleSuccessWithData(c, d)
+}
+
+func (svc *Service) _getDeliveryList(c *gin.Context, query bson.M) {
+	// params
+	pagination := controllers.MustGetPagination(c)
+	sort := controllers.MustGetSortOption(c)
+	if sort == nil {
+		sort = bson.D{{Key: "create_ts", Value: -1}}
+	}
+
+	// get list
+	var list []NotificationDelivery
+	if err := svc.deliveryCol.Find(query, &mongo2.FindOptions{
+		Sort:  sort,
+		Skip:  pagination.Size * (pagination.Page - 1),
+		Limit: pagination.Size,
+	}).All(&list); err != nil {
+		if err.Error() == mongo.ErrNoDocuments.Error() {
+			controllers.HandleSuccessWithListData(c, nil, 0)
+		} else {
+			controllers.HandleErrorInternalServerError(c, err)
+		}
+		return
+	}
+
+	// total count
+	total, err := svc.deliveryCol.Count(query)
+	if err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccessWithListData(c, list, total)
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestGetDeliveryBackoff(t *testing.T) {
+	cases := []struct {
+		attempts int
+		expected time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, 1 * time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{7, 30 * time.Minute},
+		{100, 30 * time.Minute},
+	}
+	for _, c := range cases {
+		if res := getDeliveryBackoff(c.attempts); res != c.expected {
+			t.Errorf("attempts %d: expected %s, got %s", c.attempts, c.expected, res)
+		}
+	}
+}
+
+func TestNotificationDelivery_Record(t *testing.T) {
+	d := &NotificationDelivery{}
+	ts := time.Now()
+	sendErr := errors.New("connection refused")
+
+	// failed attempts are retried with backoff
+	d.record(ts, 120*time.Millisecond, sendErr)
+	if d.Status != DeliveryStatusRetrying {
+		t.Fatalf("expected %s, got %s", DeliveryStatusRetrying, d.Status)
+	}
+	if !d.NextRetryTs.Equal(ts.Add(DeliveryBaseBackoff)) {
+		t.Errorf("unexpected next retry ts: %s", d.NextRetryTs)
+	}
+	if d.Error != sendErr.Error() || d.Latency != 120 {
+		t.Errorf("unexpected error or latency: %s, %d", d.Error, d.Latency)
+	}
+	if d.Attempts[0].Status != DeliveryStatusFailed {
+		t.Errorf("expected attempt status %s, got %s", DeliveryStatusFailed, d.Attempts[0].Status)
+	}
+
+	// dead letter after max attempts
+	for i := 1; i < DeliveryMaxAttempts; i++ {
+		d.record(ts, 0, sendErr)
+	}
+	if d.Status != DeliveryStatusDead {
+		t.Fatalf("expected %s, got %s", DeliveryStatusDead, d.Status)
+	}
+	if !d.NextRetryTs.IsZero() {
+		t.Errorf("expected no next retry, got %s", d.NextRetryTs)
+	}
+
+	// failed resend of dead letter
+	d.record(ts, 0, sendErr)
+	if d.Status != DeliveryStatusDead {
+		t.Fatalf("expected %s, got %s", DeliveryStatusDead, d.Status)
+	}
+
+	// successful resend
+	d.record(ts, 50*time.Millisecond, nil)
+	if d.Status != DeliveryStatusSuccess || d.Error != "" || d.Latency != 50 {
+		t.Errorf("unexpected delivery: %s, %s, %d", d.Status, d.Error, d.Latency)
+	}
+	if len(d.Attempts) != DeliveryMaxAttempts+2 {
+		t.Errorf("expected %d attempts, got %d", DeliveryMaxAttempts+2, len(d.Attempts))
+	}
+}
+
+func TestService_Attempt(t *testing.T) {
+	svr, _, _ := newWebhookTestServer(t, http.StatusInternalServerError, "")
+	svc := &Service{}
+	s := &NotificationSetting{
+		Type:    NotificationTypeWebhook,
+		Webhook: NotificationSettingWebhook{Url: svr.URL},
+	}
+
+	d := &NotificationDelivery{}
+	svc._attempt(d, s, bson.M{})
+	if d.Status != DeliveryStatusRetrying || d.Error == "" {
+		t.Errorf("expected failed attempt to be retried, got %s: %s", d.Status, d.Error)
+	}
+
+	// empty recipient is a failure rather than a successful delivery
+	s.Webhook.Url = ""
+	svc._attempt(d, s, bson.M{})
+	if d.Status != DeliveryStatusRetrying || d.Error != "webhook url is empty" {
+		t.Errorf("expected empty url to fail, got %s: %s", d.Status, d.Error)
+	}
+
+	s.Type = "unknown"
+	svc._attempt(d, s, bson.M{})
+	if d.Error != "invalid notification type: unknown" {
+		t.Errorf("unexpected error: %s", d.Error)
+	}
+}
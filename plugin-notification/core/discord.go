@@ -0,0 +1,17 @@
+package core
+
+import "github.com/imroc/req"
+
+func SendDiscordNotification(webhook string, title string, content string) error {
+	// request data
+	data := req.Param{
+		"embeds": []req.Param{
+			{
+				"title":       truncate(title, 256),
+				"description": truncate(markdownToDiscord(content), 4096),
+			},
+		},
+	}
+
+	return postChatMessage(webhook, &data)
+}
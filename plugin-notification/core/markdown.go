@@ -0,0 +1,91 @@
+package core
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	markdownHeadingRegex        = regexp.MustCompile(`(?m)^#{1,6}[ \t]+(.+?)[ \t]*#*[ \t]*$`)
+	markdownBoldRegex           = regexp.MustCompile(`\*\*(.+?)\*\*|__(.+?)__`)
+	markdownItalicRegex         = regexp.MustCompile(`(^|[^*\w])\*([^*\s][^*]*?)\*([^*\w]|$)`)
+	markdownCodeRegex           = regexp.MustCompile("`([^`]+)`")
+	markdownLinkRegex           = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	markdownListItemRegex       = regexp.MustCompile(`(?m)^([ \t]*)[-*+][ \t]+`)
+	markdownTableSeparatorRegex = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+)
+
+// flattenMarkdownTables converts rows of markdown tables into lines of cells
+// separated by "|", as tables are not supported by chat platforms.
+func flattenMarkdownTables(md string) string {
+	var lines []string
+	for _, line := range strings.Split(md, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if !strings.HasPrefix(trimmed, "|") {
+			lines = append(lines, line)
+			continue
+		}
+		if markdownTableSeparatorRegex.MatchString(trimmed) {
+			continue
+		}
+		var cells []string
+		for _, cell := range strings.Split(strings.Trim(trimmed, "|"), "|") {
+			cells = append(cells, strings.TrimSpace(cell))
+		}
+		lines = append(lines, strings.Join(cells, " | "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// markdownToSlack converts markdown to Slack mrkdwn.
+func markdownToSlack(md string) string {
+	s := flattenMarkdownTables(md)
+
+	// escape control characters
+	s = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+
+	// italic before bold, as both are marked by asterisks
+	s = markdownItalicRegex.ReplaceAllString(s, "${1}_${2}_${3}")
+	s = markdownBoldRegex.ReplaceAllString(s, "*${1}${2}*")
+	s = markdownHeadingRegex.ReplaceAllString(s, "*${1}*")
+	s = markdownLinkRegex.ReplaceAllString(s, "<${2}|${1}>")
+	s = markdownListItemRegex.ReplaceAllString(s, "${1}• ")
+	return s
+}
+
+// markdownToTeams converts markdown to the subset supported by text blocks
+// of adaptive cards, which has no headings or tables.
+func markdownToTeams(md string) string {
+	s := flattenMarkdownTables(md)
+	return markdownHeadingRegex.ReplaceAllString(s, "**${1}**")
+}
+
+// markdownToDiscord converts markdown to Discord markdown, which has no
+// tables.
+func markdownToDiscord(md string) string {
+	return flattenMarkdownTables(md)
+}
+
+// markdownToTelegramHtml converts markdown to the html subset supported by
+// the Telegram Bot API.
+func markdownToTelegramHtml(md string) string {
+	s := flattenMarkdownTables(md)
+	s = html.EscapeString(s)
+	s = markdownCodeRegex.ReplaceAllString(s, "<code>${1}</code>")
+	s = markdownItalicRegex.ReplaceAllString(s, "${1}<i>${2}</i>${3}")
+	s = markdownBoldRegex.ReplaceAllString(s, "<b>${1}${2}</b>")
+	s = markdownHeadingRegex.ReplaceAllString(s, "<b>${1}</b>")
+	s = markdownLinkRegex.ReplaceAllString(s, `<a href="${2}">${1}</a>`)
+	s = markdownListItemRegex.ReplaceAllString(s, "${1}• ")
+	return s
+}
+
+// truncate truncates the string to the max number of characters.
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -1,6 +1,9 @@
 package core
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
 
 type NotificationSetting struct {
 	Id          primitive.ObjectID          `json:"_id" bson:"_id"`
@@ -12,9 +15,15 @@ type NotificationSetting struct {
 	Title       string                      `json:"title,omitempty" bson:"title,omitempty"`
 	Template    string                      `json:"template,omitempty" bson:"template,omitempty"`
 	Triggers    []string                    `json:"triggers" bson:"triggers"`
-	Targets     []NotificationSettingTarget `json:"targets" bson:"targets"` // TODO: implement
+	Condition   string                      `json:"condition,omitempty" bson:"condition,omitempty"` // see Condition
+	Targets     []NotificationSettingTarget `json:"targets" bson:"targets"`                         // ignored if global
 	Mail        NotificationSettingMail     `json:"mail,omitempty" bson:"mail,omitempty"`
 	Mobile      NotificationSettingMobile   `json:"mobile,omitempty" bson:"mobile,omitempty"`
+	Webhook     NotificationSettingWebhook  `json:"webhook,omitempty" bson:"webhook,omitempty"`
+	Slack       NotificationSettingSlack    `json:"slack,omitempty" bson:"slack,omitempty"`
+	Teams       NotificationSettingTeams    `json:"teams,omitempty" bson:"teams,omitempty"`
+	Discord     NotificationSettingDiscord  `json:"discord,omitempty" bson:"discord,omitempty"`
+	Telegram    NotificationSettingTelegram `json:"telegram,omitempty" bson:"telegram,omitempty"`
 }
 
 type NotificationSettingMail struct {
@@ -32,6 +41,42 @@ type NotificationSettingMobile struct {
 	Webhook string `json:"webhook" bson:"webhook"`
 }
 
+// NotificationSettingSlack is an incoming webhook of Slack.
+type NotificationSettingSlack struct {
+	Webhook string `json:"webhook" bson:"webhook"`
+}
+
+// NotificationSettingTeams is an incoming webhook of Microsoft Teams.
+type NotificationSettingTeams struct {
+	Webhook string `json:"webhook" bson:"webhook"`
+}
+
+// NotificationSettingDiscord is a webhook of a Discord channel.
+type NotificationSettingDiscord struct {
+	Webhook string `json:"webhook" bson:"webhook"`
+}
+
+// NotificationSettingTelegram is a chat to send messages to by a bot.
+type NotificationSettingTelegram struct {
+	BotToken string `json:"bot_token" bson:"bot_token"`
+	ChatId   string `json:"chat_id" bson:"chat_id"`
+	ApiUrl   string `json:"api_url,omitempty" bson:"api_url,omitempty"` // https://api.telegram.org if empty
+}
+
+// NotificationSettingWebhook is a generic outbound webhook. The url, header
+// values and body are templates. The body is a json object of the rendered
+// title and content if empty.
+type NotificationSettingWebhook struct {
+	Url                string            `json:"url" bson:"url"`
+	Method             string            `json:"method,omitempty" bson:"method,omitempty"` // POST if empty
+	Headers            map[string]string `json:"headers,omitempty" bson:"headers,omitempty"`
+	Body               string            `json:"body,omitempty" bson:"body,omitempty"`
+	Timeout            int               `json:"timeout,omitempty" bson:"timeout,omitempty"`                           // seconds
+	SuccessStatusCodes []int             `json:"success_status_codes,omitempty" bson:"success_status_codes,omitempty"` // 2xx if empty
+	SuccessJsonPath    string            `json:"success_json_path,omitempty" bson:"success_json_path,omitempty"`
+	SuccessJsonValue   string            `json:"success_json_value,omitempty" bson:"success_json_value,omitempty"`
+}
+
 type NotificationSettingTarget struct {
 	Id    primitive.ObjectID `json:"_id" bson:"_id"`
 	Model string             `json:"model" bson:"model"`
@@ -41,3 +86,30 @@ type NotificationSettingTrigger struct {
 	Name  string `json:"name" bson:"name"`
 	Event string `json:"event" bson:"event"`
 }
+
+// NotificationDelivery is a notification sent to a channel of a setting for
+// an event, which records every attempt of sending it. Failed deliveries are
+// retried with exponential backoff until they succeed or become dead letters.
+type NotificationDelivery struct {
+	Id          primitive.ObjectID            `json:"_id" bson:"_id"`
+	SettingId   primitive.ObjectID            `json:"setting_id" bson:"setting_id"`
+	SettingName string                        `json:"setting_name" bson:"setting_name"`
+	Event       string                        `json:"event" bson:"event"`
+	Type        string                        `json:"type" bson:"type"` // channel
+	Title       string                        `json:"title" bson:"title"`
+	Data        string                        `json:"data" bson:"data"` // event data in json
+	Status      string                        `json:"status" bson:"status"`
+	Error       string                        `json:"error,omitempty" bson:"error,omitempty"` // error of the last attempt
+	Latency     int64                         `json:"latency" bson:"latency"`                 // milliseconds of the last attempt
+	Attempts    []NotificationDeliveryAttempt `json:"attempts" bson:"attempts"`
+	NextRetryTs time.Time                     `json:"next_retry_ts,omitempty" bson:"next_retry_ts,omitempty"`
+	CreateTs    time.Time                     `json:"create_ts" bson:"create_ts"`
+	UpdateTs    time.Time                     `json:"update_ts" bson:"update_ts"`
+}
+
+type NotificationDeliveryAttempt struct {
+	Ts      time.Time `json:"ts" bson:"ts"`
+	Status  string    `json:"status" bson:"status"`
+	Error   string    `json:"error,omitempty" bson:"error,omitempty"`
+	Latency int64     `json:"latency" bson:"latency"` // milliseconds
+}
@@ -1,8 +1,16 @@
 package core
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type SendPayload struct {
 	TaskId primitive.ObjectID `json:"task_id"`
 	Data   string             `json:"data"`
 }
+
+type EventPayload struct {
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
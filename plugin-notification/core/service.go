@@ -2,6 +2,7 @@ package core
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/apex/log"
 	"github.com/crawlab-team/crawlab-core/controllers"
@@ -24,13 +25,17 @@ import (
 
 type Service struct {
 	*plugin.Internal
-	col *mongo2.Col // notification settings
+	col         *mongo2.Col // notification settings
+	deliveryCol *mongo2.Col // notification deliveries
 }
 
 func (svc *Service) Init() (err error) {
 	// handle events
 	go svc.handleEvents()
 
+	// retry failed deliveries
+	go svc.retryDeliveries()
+
 	// api
 	api := svc.GetApi()
 	//api.POST("/send", svc.send)
@@ -42,6 +47,11 @@ func (svc *Service) Init() (err error) {
 	api.DELETE("/settings/:id", svc.deleteSetting)
 	api.POST("/settings/:id/enable", svc.enableSetting)
 	api.POST("/settings/:id/disable", svc.disableSetting)
+	api.POST("/events", svc.postEvent)
+	api.GET("/deliveries", svc.getDeliveryList)
+	api.GET("/deliveries/:id", svc.getDelivery)
+	api.POST("/deliveries/:id/resend", svc.resendDelivery)
+	api.GET("/dead-letters", svc.getDeadLetterList)
 
 	return nil
 }
@@ -52,6 +62,13 @@ func (svc *Service) Start() (err error) {
 		return err
 	}
 
+	// indexes
+	_ = svc.deliveryCol.CreateIndexes([]mongo.IndexModel{
+		{Keys: bson.D{{Key: "setting_id", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_retry_ts", Value: 1}}},
+		{Keys: bson.D{{Key: "create_ts", Value: -1}}},
+	})
+
 	// start api
 	svc.StartApi()
 
@@ -78,6 +95,7 @@ func (svc *Service) initData() (err error) {
 			Id:          primitive.NewObjectID(),
 			Type:        NotificationTypeMail,
 			Enabled:     true,
+			Global:      true,
 			Name:        "Task Change (Mail)",
 			Description: "This is the default mail notification. You can edit it with your own settings",
 			Triggers: []string{
@@ -122,6 +140,7 @@ Please find the task data as below.
 			Id:          primitive.NewObjectID(),
 			Type:        NotificationTypeMobile,
 			Enabled:     true,
+			Global:      true,
 			Name:        "Task Change (Mobile)",
 			Description: "This is the default mobile notification. You can edit it with your own settings",
 			Triggers: []string{
@@ -171,7 +190,7 @@ func (svc *Service) sendMail(s *NotificationSetting, entity bson.M) (err error)
 		log.Warnf("parsing 'to' error: %v", err)
 	}
 	if to == "" {
-		return nil
+		return errors.New("no receiver emails configured")
 	}
 
 	// cc
@@ -207,7 +226,7 @@ func (svc *Service) sendMobile(s *NotificationSetting, entity bson.M) (err error
 		log.Warnf("parsing 'webhook' error: %v", err)
 	}
 	if webhook == "" {
-		return nil
+		return errors.New("webhook is empty")
 	}
 
 	// title
@@ -230,6 +249,129 @@ func (svc *Service) sendMobile(s *NotificationSetting, entity bson.M) (err error
 	return nil
 }
 
+func (svc *Service) sendWebhook(s *NotificationSetting, entity bson.M) (err error) {
+	// url
+	url, err := parser.Parse(s.Webhook.Url, entity)
+	if err != nil {
+		log.Warnf("parsing 'url' error: %v", err)
+	}
+	if url == "" {
+		return errors.New("webhook url is empty")
+	}
+
+	// header
+	header := map[string]string{}
+	for k, v := range s.Webhook.Headers {
+		header[k], err = parser.Parse(v, entity)
+		if err != nil {
+			log.Warnf("parsing header '%s' error: %v", k, err)
+		}
+	}
+
+	// body
+	var body string
+	if s.Webhook.Body != "" {
+		if isJsonContentType(header) {
+			body, err = parseJsonTemplate(s.Webhook.Body, entity)
+		} else {
+			body, err = parser.Parse(s.Webhook.Body, entity)
+		}
+		if err != nil {
+			log.Warnf("parsing 'body' error: %v", err)
+		}
+	} else {
+		// title
+		title, err := parser.Parse(s.Title, entity)
+		if err != nil {
+			log.Warnf("parsing 'title' error: %v", err)
+		}
+
+		// content
+		content, err := parser.Parse(s.Template, entity)
+		if err != nil {
+			log.Warnf("parsing 'content' error: %v", err)
+		}
+
+		data, _ := json.Marshal(map[string]string{
+			"title":   title,
+			"content": content,
+		})
+		body = string(data)
+	}
+
+	// send
+	if err := SendWebhookNotification(&s.Webhook, url, header, body); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (svc *Service) sendSlack(s *NotificationSetting, entity bson.M) (err error) {
+	// webhook
+	webhook, err := parser.Parse(s.Slack.Webhook, entity)
+	if err != nil {
+		log.Warnf("parsing 'webhook' error: %v", err)
+	}
+	if webhook == "" {
+		return errors.New("webhook is empty")
+	}
+
+	// send
+	title, content := svc._renderMessage(s, entity)
+	return SendSlackNotification(webhook, title, content)
+}
+
+func (svc *Service) sendTeams(s *NotificationSetting, entity bson.M) (err error) {
+	// webhook
+	webhook, err := parser.Parse(s.Teams.Webhook, entity)
+	if err != nil {
+		log.Warnf("parsing 'webhook' error: %v", err)
+	}
+	if webhook == "" {
+		return errors.New("webhook is empty")
+	}
+
+	// send
+	title, content := svc._renderMessage(s, entity)
+	return SendTeamsNotification(webhook, title, content)
+}
+
+func (svc *Service) sendDiscord(s *NotificationSetting, entity bson.M) (err error) {
+	// webhook
+	webhook, err := parser.Parse(s.Discord.Webhook, entity)
+	if err != nil {
+		log.Warnf("parsing 'webhook' error: %v", err)
+	}
+	if webhook == "" {
+		return errors.New("webhook is empty")
+	}
+
+	// send
+	title, content := svc._renderMessage(s, entity)
+	return SendDiscordNotification(webhook, title, content)
+}
+
+func (svc *Service) sendTelegram(s *NotificationSetting, entity bson.M) (err error) {
+	// chat id
+	chatId, err := parser.Parse(s.Telegram.ChatId, entity)
+	if err != nil {
+		log.Warnf("parsing 'chat_id' error: %v", err)
+	}
+	if s.Telegram.BotToken == "" {
+		return errors.New("telegram bot token is empty")
+	}
+	if chatId == "" {
+		return errors.New("telegram chat id is empty")
+	}
+	t := s.Telegram
+	t.ChatId = chatId
+
+	// send
+	title, content := svc._renderMessage(s, entity)
+	return SendTelegramNotification(&t, title, content)
+}
+
 func (svc *Service) getTriggerList(c *gin.Context) {
 	modelList := []string{
 		interfaces.ModelColNameTag,
@@ -263,6 +405,7 @@ func (svc *Service) getTriggerList(c *gin.Context) {
 			triggers = append(triggers, fmt.Sprintf("model:%s:%s", m, a))
 		}
 	}
+	triggers = append(triggers, pluginEventList...)
 
 	controllers.HandleSuccessWithListData(c, triggers, len(triggers))
 }
@@ -320,6 +463,14 @@ func (svc *Service) putSetting(c *gin.Context) {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
+	if err := validateTargets(s.Targets); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+	if err := validateCondition(s.Condition); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
 
 	s.Id = primitive.NewObjectID()
 	if _, err := svc.col.Insert(s); err != nil {
@@ -347,6 +498,14 @@ func (svc *Service) postSetting(c *gin.Context) {
 		controllers.HandleErrorInternalServerError(c, err)
 		return
 	}
+	if err := validateTargets(s.Targets); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+	if err := validateCondition(s.Condition); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
 	s.Id = id
 
 	if err := svc.col.ReplaceId(id, s); err != nil {
@@ -424,20 +583,8 @@ func (svc *Service) handleEvents() {
 				continue
 			}
 
-			// event name
-			eventName := data.Events[0]
-
-			// settings
-			var settings []NotificationSetting
-			if err := svc.col.Find(bson.M{
-				"enabled":  true,
-				"triggers": eventName,
-			}, nil).All(&settings); err != nil || len(settings) == 0 {
-				continue
-			}
-
-			// handle events
-			if err := svc._handleEventModel(settings, data.Data); err != nil {
+			// handle event
+			if err := svc._handleEvent(data.Events[0], data.Data); err != nil {
 				trace.PrintError(err)
 			}
 		default:
@@ -446,21 +593,60 @@ func (svc *Service) handleEvents() {
 	}
 }
 
-func (svc *Service) _handleEventModel(settings []NotificationSetting, data []byte) (err error) {
+// postEvent receives events sent by other plugins, such as dependency drift
+// alerts, and handles them in the same way as events of the event stream.
+func (svc *Service) postEvent(c *gin.Context) {
+	var payload EventPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		controllers.HandleErrorBadRequest(c, err)
+		return
+	}
+	if payload.Event == "" {
+		controllers.HandleErrorBadRequest(c, errors.New("empty event"))
+		return
+	}
+
+	if err := svc._handleEvent(payload.Event, payload.Data); err != nil {
+		controllers.HandleErrorInternalServerError(c, err)
+		return
+	}
+
+	controllers.HandleSuccess(c)
+}
+
+func (svc *Service) _handleEvent(eventName string, data []byte) (err error) {
+	// settings
+	var settings []NotificationSetting
+	if err := svc.col.Find(bson.M{
+		"enabled":  true,
+		"triggers": eventName,
+	}, nil).All(&settings); err != nil || len(settings) == 0 {
+		return nil
+	}
+
+	// handle events
+	return svc._handleEventModel(eventName, settings, data)
+}
+
+func (svc *Service) _handleEventModel(eventName string, settings []NotificationSetting, data []byte) (err error) {
 	var doc bson.M
 	if err := json.Unmarshal(data, &doc); err != nil {
 		return err
 	}
 
 	for _, s := range settings {
-		switch s.Type {
-		case NotificationTypeMail:
-			err = svc.sendMail(&s, doc)
-		case NotificationTypeMobile:
-			// TODO: implement
-			err = svc.sendMobile(&s, doc)
+		// targets
+		if !svc._matchTargets(&s, eventName, doc) {
+			continue
 		}
-		if err != nil {
+
+		// condition
+		if !svc._matchCondition(&s, doc) {
+			continue
+		}
+
+		// send and record delivery
+		if err := svc._deliver(&s, eventName, doc, data); err != nil {
 			trace.PrintError(err)
 		}
 	}
@@ -468,6 +654,23 @@ func (svc *Service) _handleEventModel(settings []NotificationSetting, data []byt
 	return nil
 }
 
+// _renderMessage renders the title and the markdown template of the setting.
+func (svc *Service) _renderMessage(s *NotificationSetting, entity bson.M) (title, content string) {
+	// title
+	title, err := parser.Parse(s.Title, entity)
+	if err != nil {
+		log.Warnf("parsing 'title' error: %v", err)
+	}
+
+	// content
+	content, err = parser.Parse(s.Template, entity)
+	if err != nil {
+		log.Warnf("parsing 'content' error: %v", err)
+	}
+
+	return title, content
+}
+
 func (svc *Service) _toggleSettingFunc(value bool) func(c *gin.Context) {
 	return func(c *gin.Context) {
 		id, err := primitive.ObjectIDFromHex(c.Param("id"))
@@ -492,8 +695,9 @@ func (svc *Service) _toggleSettingFunc(value bool) func(c *gin.Context) {
 func NewService() *Service {
 	// service
 	svc := &Service{
-		Internal: plugin.NewInternal(),
-		col:      mongo2.GetMongoCol(NotificationSettingsColName),
+		Internal:    plugin.NewInternal(),
+		col:         mongo2.GetMongoCol(NotificationSettingsColName),
+		deliveryCol: mongo2.GetMongoCol(NotificationDeliveriesColName),
 	}
 
 	if err := svc.Init(); err != nil {
@@ -17,3 +17,19 @@ func TestService_sendMobile(t *testing.T) {
 	e.POST("/send/mobile").WithJSON(data).
 		Expect().Status(http.StatusOK)
 }
+
+func TestService_postEvent(t *testing.T) {
+	T.Setup(t)
+	e := T.NewExpect(t)
+	time.Sleep(1 * time.Second)
+
+	data := map[string]interface{}{
+		"event": PluginEventDependencyDrift,
+		"data": map[string]interface{}{
+			"type":  "python",
+			"total": 0,
+		},
+	}
+	e.POST("/events").WithJSON(data).
+		Expect().Status(http.StatusOK)
+}
@@ -0,0 +1,37 @@
+package core
+
+import "github.com/imroc/req"
+
+// slackSectionMaxLength is the max length of texts of section blocks.
+const slackSectionMaxLength = 3000
+
+func SendSlackNotification(webhook string, title string, content string) error {
+	// blocks
+	var blocks []req.Param
+	if title != "" {
+		blocks = append(blocks, req.Param{
+			"type": "header",
+			"text": req.Param{
+				"type": "plain_text",
+				"text": truncate(title, 150),
+			},
+		})
+	}
+	for _, text := range splitText(markdownToSlack(content), slackSectionMaxLength) {
+		blocks = append(blocks, req.Param{
+			"type": "section",
+			"text": req.Param{
+				"type": "mrkdwn",
+				"text": text,
+			},
+		})
+	}
+
+	// request data
+	data := req.Param{
+		"text":   title,
+		"blocks": blocks,
+	}
+
+	return postChatMessage(webhook, &data)
+}
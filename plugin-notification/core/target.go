@@ -0,0 +1,115 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/crawlab-core/interfaces"
+	mongo2 "github.com/crawlab-team/crawlab-db/mongo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strings"
+)
+
+// targetFieldMap maps models of targets to fields of event documents that
+// reference them.
+var targetFieldMap = map[string]string{
+	interfaces.ModelColNameSpider:   "spider_id",
+	interfaces.ModelColNameProject:  "project_id",
+	interfaces.ModelColNameSchedule: "schedule_id",
+	interfaces.ModelColNameNode:     "node_id",
+}
+
+// _matchTargets returns whether the event document matches any target of
+// the setting. Global settings and settings without targets match all
+// documents.
+func (svc *Service) _matchTargets(s *NotificationSetting, eventName string, doc bson.M) bool {
+	if s.Global || len(s.Targets) == 0 {
+		return true
+	}
+
+	// model of the event, e.g. "spiders" of "model:spiders:change"
+	var eventModel string
+	if parts := strings.Split(eventName, ":"); len(parts) == 3 && parts[0] == "model" {
+		eventModel = parts[1]
+	}
+
+	// project of the spider, which is looked up only if needed
+	var projectId primitive.ObjectID
+	projectIdLoaded := false
+	getProjectId := func() primitive.ObjectID {
+		if projectIdLoaded {
+			return projectId
+		}
+		projectIdLoaded = true
+		projectId = svc._getSpiderProjectId(doc)
+		return projectId
+	}
+
+	for _, t := range s.Targets {
+		// document of the target model itself
+		if t.Model == eventModel {
+			if id, ok := getObjectId(doc["_id"]); ok && id == t.Id {
+				return true
+			}
+			continue
+		}
+
+		// referenced document
+		if id, ok := getObjectId(doc[targetFieldMap[t.Model]]); ok && id == t.Id {
+			return true
+		}
+
+		// project of the referenced spider
+		if t.Model == interfaces.ModelColNameProject && getProjectId() == t.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// _getSpiderProjectId returns the project id of the spider referenced by the
+// "spider_id" field of the event document, e.g. a task.
+func (svc *Service) _getSpiderProjectId(doc bson.M) (id primitive.ObjectID) {
+	spiderId, ok := getObjectId(doc["spider_id"])
+	if !ok {
+		return id
+	}
+	var spider struct {
+		ProjectId primitive.ObjectID `bson:"project_id"`
+	}
+	if err := mongo2.GetMongoCol(interfaces.ModelColNameSpider).FindId(spiderId).One(&spider); err != nil {
+		return id
+	}
+	return spider.ProjectId
+}
+
+// validateTargets validates models and ids of targets.
+func validateTargets(targets []NotificationSettingTarget) (err error) {
+	for _, t := range targets {
+		if _, ok := targetFieldMap[t.Model]; !ok {
+			return errors.New(fmt.Sprintf("invalid target model: %s", t.Model))
+		}
+		if t.Id.IsZero() {
+			return errors.New(fmt.Sprintf("empty target id of %s", t.Model))
+		}
+	}
+	return nil
+}
+
+// getObjectId returns the object id of a value of event documents, which is
+// either an object id or its hex string.
+func getObjectId(value interface{}) (id primitive.ObjectID, ok bool) {
+	switch v := value.(type) {
+	case primitive.ObjectID:
+		return v, !v.IsZero()
+	case string:
+		id, err := primitive.ObjectIDFromHex(v)
+		if err != nil {
+			return id, false
+		}
+		return id, !id.IsZero()
+	default:
+		return id, false
+	}
+}
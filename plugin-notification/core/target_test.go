@@ -0,0 +1,100 @@
+package core
+
+import (
+	"github.com/crawlab-team/crawlab-core/interfaces"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"testing"
+)
+
+func TestService_matchTargets(t *testing.T) {
+	svc := &Service{}
+	spiderId := primitive.NewObjectID()
+	scheduleId := primitive.NewObjectID()
+	projectId := primitive.NewObjectID()
+	doc := bson.M{
+		"_id":         primitive.NewObjectID().Hex(),
+		"spider_id":   spiderId.Hex(),
+		"schedule_id": scheduleId.Hex(),
+		"project_id":  projectId.Hex(),
+	}
+
+	testCases := []struct {
+		name    string
+		s       NotificationSetting
+		event   string
+		doc     bson.M
+		matched bool
+	}{
+		{
+			name:    "no targets",
+			s:       NotificationSetting{},
+			event:   "model:tasks:change",
+			doc:     doc,
+			matched: true,
+		},
+		{
+			name: "global",
+			s: NotificationSetting{
+				Global:  true,
+				Targets: []NotificationSettingTarget{{Model: interfaces.ModelColNameSpider, Id: primitive.NewObjectID()}},
+			},
+			event:   "model:tasks:change",
+			doc:     doc,
+			matched: true,
+		},
+		{
+			name: "spider",
+			s: NotificationSetting{
+				Targets: []NotificationSettingTarget{{Model: interfaces.ModelColNameSpider, Id: spiderId}},
+			},
+			event:   "model:tasks:change",
+			doc:     doc,
+			matched: true,
+		},
+		{
+			name: "schedule",
+			s: NotificationSetting{
+				Targets: []NotificationSettingTarget{
+					{Model: interfaces.ModelColNameNode, Id: primitive.NewObjectID()},
+					{Model: interfaces.ModelColNameSchedule, Id: scheduleId},
+				},
+			},
+			event:   "model:tasks:change",
+			doc:     doc,
+			matched: true,
+		},
+		{
+			name: "project",
+			s: NotificationSetting{
+				Targets: []NotificationSettingTarget{{Model: interfaces.ModelColNameProject, Id: projectId}},
+			},
+			event:   "model:spiders:change",
+			doc:     bson.M{"_id": spiderId.Hex(), "project_id": projectId.Hex()},
+			matched: true,
+		},
+		{
+			name: "document of the target model",
+			s: NotificationSetting{
+				Targets: []NotificationSettingTarget{{Model: interfaces.ModelColNameSpider, Id: spiderId}},
+			},
+			event:   "model:spiders:change",
+			doc:     bson.M{"_id": spiderId.Hex()},
+			matched: true,
+		},
+		{
+			name: "other spider",
+			s: NotificationSetting{
+				Targets: []NotificationSettingTarget{{Model: interfaces.ModelColNameSpider, Id: primitive.NewObjectID()}},
+			},
+			event:   "model:tasks:change",
+			doc:     bson.M{"spider_id": spiderId.Hex()},
+			matched: false,
+		},
+	}
+	for _, tc := range testCases {
+		if matched := svc._matchTargets(&tc.s, tc.event, tc.doc); matched != tc.matched {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.matched, matched)
+		}
+	}
+}
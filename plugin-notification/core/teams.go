@@ -0,0 +1,52 @@
+package core
+
+import (
+	"github.com/imroc/req"
+	"strings"
+)
+
+func SendTeamsNotification(webhook string, title string, content string) error {
+	// text blocks, one per line as line breaks within a block are not
+	// rendered consistently
+	body := []req.Param{
+		{
+			"type":   "TextBlock",
+			"text":   title,
+			"size":   "Large",
+			"weight": "Bolder",
+			"wrap":   true,
+		},
+	}
+	spacing := "Medium"
+	for _, line := range strings.Split(markdownToTeams(content), "\n") {
+		if strings.TrimSpace(line) == "" {
+			spacing = "Medium"
+			continue
+		}
+		body = append(body, req.Param{
+			"type":    "TextBlock",
+			"text":    line,
+			"wrap":    true,
+			"spacing": spacing,
+		})
+		spacing = "None"
+	}
+
+	// request data
+	data := req.Param{
+		"type": "message",
+		"attachments": []req.Param{
+			{
+				"contentType": "application/vnd.microsoft.card.adaptive",
+				"content": req.Param{
+					"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+					"type":    "AdaptiveCard",
+					"version": "1.4",
+					"body":    body,
+				},
+			},
+		},
+	}
+
+	return postChatMessage(webhook, &data)
+}
@@ -0,0 +1,68 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	"github.com/imroc/req"
+	"html"
+	"strings"
+)
+
+const DefaultTelegramApiUrl = "https://api.telegram.org"
+
+// telegramMessageMaxLength is the max length of texts of messages.
+const telegramMessageMaxLength = 4096
+
+type TelegramResBody struct {
+	Ok          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+func SendTelegramNotification(t *NotificationSettingTelegram, title string, content string) error {
+	// api url
+	apiUrl := t.ApiUrl
+	if apiUrl == "" {
+		apiUrl = DefaultTelegramApiUrl
+	}
+	requestUrl := fmt.Sprintf("%s/bot%s/sendMessage", strings.TrimSuffix(apiUrl, "/"), t.BotToken)
+
+	// request header
+	header := req.Header{
+		"Content-Type": "application/json; charset=utf-8",
+	}
+
+	// request data
+	text := fmt.Sprintf("<b>%s</b>\n\n%s", html.EscapeString(title), markdownToTelegramHtml(content))
+	data := req.Param{
+		"chat_id":                  t.ChatId,
+		"text":                     text,
+		"parse_mode":               "HTML",
+		"disable_web_page_preview": true,
+	}
+
+	// plain text for long messages, as truncated html may be invalid
+	if len([]rune(text)) > telegramMessageMaxLength {
+		data["text"] = truncate(title+"\n\n"+flattenMarkdownTables(content), telegramMessageMaxLength)
+		delete(data, "parse_mode")
+	}
+
+	// perform request
+	res, err := req.Post(requestUrl, header, req.BodyJSON(&data))
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// parse response
+	var resBody TelegramResBody
+	if err := res.ToJSON(&resBody); err != nil {
+		return trace.TraceError(err)
+	}
+
+	// validate response
+	if !resBody.Ok {
+		return errors.New(resBody.Description)
+	}
+
+	return nil
+}
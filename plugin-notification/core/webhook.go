@@ -0,0 +1,200 @@
+package core
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/crawlab-team/go-trace"
+	parser "github.com/crawlab-team/template-parser"
+	"github.com/imroc/req"
+	"go.mongodb.org/mongo-driver/bson"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DefaultWebhookTimeout = 30 // seconds
+
+func SendWebhookNotification(w *NotificationSettingWebhook, url string, header map[string]string, body string) error {
+	// method
+	method := strings.ToUpper(w.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	// request header
+	reqHeader := req.Header{}
+	for k, v := range header {
+		reqHeader[k] = v
+	}
+	if _, ok := getHeader(reqHeader, "Content-Type"); !ok {
+		reqHeader["Content-Type"] = "application/json; charset=utf-8"
+	}
+
+	// validate json body, e.g. in case of a malformed body template
+	if isJsonContentType(header) && body != "" {
+		if !json.Valid([]byte(body)) {
+			return errors.New("rendered body is not valid json")
+		}
+	}
+
+	// timeout
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DefaultWebhookTimeout
+	}
+	r := req.New()
+	r.SetTimeout(time.Duration(timeout) * time.Second)
+
+	// perform request
+	res, err := r.Do(method, url, reqHeader, body)
+	if err != nil {
+		return trace.TraceError(err)
+	}
+
+	// validate response
+	return validateWebhookResponse(w, res.Response().StatusCode, res.Bytes())
+}
+
+// validateWebhookResponse checks the response against success criteria of
+// the webhook, i.e. status codes and the value at the json path.
+func validateWebhookResponse(w *NotificationSettingWebhook, statusCode int, body []byte) error {
+	// status code
+	if len(w.SuccessStatusCodes) == 0 {
+		if statusCode < 200 || statusCode >= 300 {
+			return errors.New(fmt.Sprintf("unexpected status code %d: %s", statusCode, string(body)))
+		}
+	} else {
+		ok := false
+		for _, code := range w.SuccessStatusCodes {
+			if code == statusCode {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return errors.New(fmt.Sprintf("unexpected status code %d: %s", statusCode, string(body)))
+		}
+	}
+
+	// json path
+	if w.SuccessJsonPath == "" {
+		return nil
+	}
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return errors.New(fmt.Sprintf("invalid json response: %s", string(body)))
+	}
+	value, ok := getJsonPathValue(doc, w.SuccessJsonPath)
+	if !ok {
+		return errors.New(fmt.Sprintf("%s not found in response: %s", w.SuccessJsonPath, string(body)))
+	}
+	if w.SuccessJsonValue == "" {
+		if !isTruthy(value) {
+			return errors.New(fmt.Sprintf("%s is %v in response: %s", w.SuccessJsonPath, value, string(body)))
+		}
+	} else if formatJsonValue(value) != w.SuccessJsonValue {
+		return errors.New(fmt.Sprintf("%s is %v instead of %s in response: %s", w.SuccessJsonPath, formatJsonValue(value), w.SuccessJsonValue, string(body)))
+	}
+
+	return nil
+}
+
+// getJsonPathValue returns the value at a dot-separated path such as
+// "$.data.items.0.ok", where numbers are indexes of arrays.
+func getJsonPathValue(doc interface{}, path string) (value interface{}, ok bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	value = doc
+	if path == "" {
+		return value, true
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value, ok = v[key]
+			if !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func formatJsonValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return "null"
+	default:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+}
+
+func isTruthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+// isJsonContentType returns true if the content type of the header is json,
+// which is the default content type of webhooks.
+func isJsonContentType(header map[string]string) bool {
+	contentType, ok := getHeader(header, "Content-Type")
+	return !ok || strings.Contains(contentType, "json")
+}
+
+var templateTagRegexp = regexp.MustCompile(`\{\{ *[$.\w\[\]:]+ *\}\}`)
+
+// parseJsonTemplate renders a json template such as {"text": "{{$.name}}"},
+// where rendered values of tags are escaped as json strings, so that values
+// with quotes or line breaks do not break the json.
+func parseJsonTemplate(template string, doc bson.M) (content string, err error) {
+	content = templateTagRegexp.ReplaceAllStringFunc(template, func(tag string) string {
+		value, _err := parser.Parse(tag, doc)
+		if _err != nil && err == nil {
+			err = _err
+		}
+		data, _ := json.Marshal(value)
+		return string(data[1 : len(data)-1])
+	})
+	if err != nil {
+		return content, err
+	}
+
+	// math expressions
+	if strings.Contains(content, "{#") {
+		return parser.Parse(content, doc)
+	}
+
+	return content, nil
+}
+
+func getHeader(header map[string]string, key string) (value string, ok bool) {
+	for k, v := range header {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"encoding/json"
+	"go.mongodb.org/mongo-driver/bson"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func newWebhookTestServer(t *testing.T, statusCode int, resBody string) (svr *httptest.Server, reqs chan *http.Request, bodies chan string) {
+	reqs = make(chan *http.Request, 1)
+	bodies = make(chan string, 1)
+	svr = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		select {
+		case reqs <- r:
+			bodies <- string(data)
+		default:
+		}
+		w.WriteHeader(statusCode)
+		_, _ = w.Write([]byte(resBody))
+	}))
+	t.Cleanup(svr.Close)
+	return svr, reqs, bodies
+}
+
+func TestSendWebhookNotification(t *testing.T) {
+	svr, reqs, bodies := newWebhookTestServer(t, http.StatusOK, `{"ok": true}`)
+
+	w := &NotificationSettingWebhook{
+		Method: "put",
+	}
+	header := map[string]string{
+		"X-Token": "token",
+	}
+	if err := SendWebhookNotification(w, svr.URL+"/hook", header, `{"text": "hello"}`); err != nil {
+		t.Fatal(err)
+	}
+
+	r := <-reqs
+	if r.Method != http.MethodPut {
+		t.Errorf("expected method PUT, got %s", r.Method)
+	}
+	if r.URL.Path != "/hook" {
+		t.Errorf("expected path /hook, got %s", r.URL.Path)
+	}
+	if r.Header.Get("X-Token") != "token" {
+		t.Errorf("expected header X-Token, got %s", r.Header.Get("X-Token"))
+	}
+	if r.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Errorf("unexpected content type %s", r.Header.Get("Content-Type"))
+	}
+	var body map[string]string
+	if err := json.Unmarshal([]byte(<-bodies), &body); err != nil || body["text"] != "hello" {
+		t.Errorf("unexpected body %v", body)
+	}
+}
+
+func TestSendWebhookNotification_StatusCodes(t *testing.T) {
+	svr, _, _ := newWebhookTestServer(t, http.StatusAccepted, "")
+
+	// 2xx by default
+	if err := SendWebhookNotification(&NotificationSettingWebhook{}, svr.URL, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// configured status codes
+	w := &NotificationSettingWebhook{
+		SuccessStatusCodes: []int{http.StatusOK},
+	}
+	if err := SendWebhookNotification(w, svr.URL, nil, ""); err == nil {
+		t.Fatal("expected error for status code not in success status codes")
+	}
+}
+
+func TestSendWebhookNotification_ErrorStatusCode(t *testing.T) {
+	svr, _, _ := newWebhookTestServer(t, http.StatusInternalServerError, "error")
+
+	if err := SendWebhookNotification(&NotificationSettingWebhook{}, svr.URL, nil, ""); err == nil {
+		t.Fatal("expected error for status code 500")
+	}
+}
+
+func TestSendWebhookNotification_JsonPath(t *testing.T) {
+	svr, _, _ := newWebhookTestServer(t, http.StatusOK, `{"result": {"items": [{"code": 0, "ok": true}]}}`)
+
+	testCases := []struct {
+		path    string
+		value   string
+		success bool
+	}{
+		{"$.result.items.0.ok", "", true},
+		{"result.items.0.code", "0", true},
+		{"result.items.0.code", "1", false},
+		{"result.items.0.code", "", false},
+		{"result.items.1.code", "", false},
+		{"result.missing", "", false},
+	}
+	for _, tc := range testCases {
+		w := &NotificationSettingWebhook{
+			SuccessJsonPath:  tc.path,
+			SuccessJsonValue: tc.value,
+		}
+		err := SendWebhookNotification(w, svr.URL, nil, "")
+		if tc.success && err != nil {
+			t.Errorf("%s=%s: unexpected error: %v", tc.path, tc.value, err)
+		}
+		if !tc.success && err == nil {
+			t.Errorf("%s=%s: expected error", tc.path, tc.value)
+		}
+	}
+}
+
+func TestSendWebhookNotification_InvalidJsonBody(t *testing.T) {
+	svr, _, _ := newWebhookTestServer(t, http.StatusOK, "")
+
+	if err := SendWebhookNotification(&NotificationSettingWebhook{}, svr.URL, nil, `{"text": "a "quoted" value"}`); err == nil {
+		t.Fatal("expected error for invalid json body")
+	}
+
+	// non-json content type
+	header := map[string]string{
+		"content-type": "text/plain",
+	}
+	if err := SendWebhookNotification(&NotificationSettingWebhook{}, svr.URL, header, `a "quoted" value`); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseJsonTemplate(t *testing.T) {
+	doc := bson.M{
+		"name":  `a "quoted" value`,
+		"error": "line 1\nline 2\t\\",
+		"count": 3,
+	}
+
+	testCases := []struct {
+		template string
+		expected map[string]interface{}
+	}{
+		{`{"text": "{{$.name}}"}`, map[string]interface{}{"text": `a "quoted" value`}},
+		{`{"text": "{{ $.name }}: {{$.error}}"}`, map[string]interface{}{"text": "a \"quoted\" value: line 1\nline 2\t\\"}},
+		{`{"count": {{$.count}}}`, map[string]interface{}{"count": float64(3)}},
+	}
+	for _, tc := range testCases {
+		content, err := parseJsonTemplate(tc.template, doc)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.template, err)
+		}
+		var res map[string]interface{}
+		if err := json.Unmarshal([]byte(content), &res); err != nil {
+			t.Fatalf("%s: invalid json %s: %v", tc.template, content, err)
+		}
+		if !reflect.DeepEqual(res, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.template, tc.expected, res)
+		}
+	}
+}